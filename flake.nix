@@ -16,7 +16,7 @@
           pname = "pj";
           version = self.rev or "dev";
           src = ./.;
-          vendorHash = "sha256-rya2afSV9Y1hmUZU0wyR9NETBl3TXD/OTHv0zvVl8v8=";
+          vendorHash = "sha256-OFGj8JiBMWIGWZpySYxzQF32he5F5DY6zOC7InUUOY4=";
 
           ldflags = [
             "-X main.version=${self.rev or "dev"}"
@@ -4,6 +4,9 @@ go 1.23.0
 
 require (
 	github.com/alecthomas/kong v1.6.0
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/sabhiram/go-gitignore v0.0.0-20210923224102-525f6e181f06
 	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/sys v0.13.0 // indirect
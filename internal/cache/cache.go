@@ -2,8 +2,8 @@ package cache
 
 import (
 	"crypto/sha256"
-	"encoding/json"
 	"fmt"
+	"hash"
 	"os"
 	"path/filepath"
 	"sort"
@@ -13,6 +13,7 @@ import (
 
 	"github.com/josephschmitt/pj/internal/config"
 	"github.com/josephschmitt/pj/internal/discover"
+	"github.com/josephschmitt/pj/internal/fsutil"
 )
 
 // Manager handles caching of discovery results
@@ -34,6 +35,7 @@ func New(cfg *config.Config, verbose bool) *Manager {
 
 // Get retrieves cached projects if valid
 func (m *Manager) Get() ([]discover.Project, error) {
+	m.migrateResults()
 	cachePath := m.getCachePath()
 
 	info, err := os.Stat(cachePath)
@@ -52,17 +54,34 @@ func (m *Manager) Get() ([]discover.Project, error) {
 		return nil, fmt.Errorf("cache expired")
 	}
 
-	data, err := os.ReadFile(cachePath)
+	return m.readResults()
+}
+
+// readResults reads the combined results cache, rejecting it if its header doesn't
+// match the running pj and current settings
+func (m *Manager) readResults() ([]discover.Project, error) {
+	data, err := os.ReadFile(m.getCachePath())
 	if err != nil {
 		return nil, err
 	}
 
-	var projects []discover.Project
-	if err := json.Unmarshal(data, &projects); err != nil {
+	var file resultsFile
+	if err := decode(m.cacheFormat(), data, &file); err != nil {
+		// Treat a damaged file (e.g. from a crash mid-write before writes were
+		// atomic) as a miss; it is replaced by the next successful discovery
+		if m.verbose {
+			fmt.Fprintf(os.Stderr, "Ignoring corrupt cache file %s: %v\n", m.getCachePath(), err)
+		}
+		return nil, fmt.Errorf("cache corrupt: %w", err)
+	}
+	if err := checkHeader(file.Header, m.resultsHeader()); err != nil {
+		if m.verbose {
+			fmt.Fprintf(os.Stderr, "Discarding cache: %v\n", err)
+		}
 		return nil, err
 	}
 
-	return projects, nil
+	return file.Projects, nil
 }
 
 // Set caches discovery results
@@ -73,12 +92,66 @@ func (m *Manager) Set(projects []discover.Project) error {
 
 	cachePath := m.getCachePath()
 
-	data, err := json.MarshalIndent(projects, "", "  ")
+	file := resultsFile{Header: m.resultsHeader(), Profile: m.config.Profile, Roots: m.config.SearchPaths, Projects: projects}
+	data, err := encode(m.cacheFormat(), file, true)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(cachePath, data, 0644)
+	return fsutil.WriteFileAtomic(cachePath, data)
+}
+
+// LoadShard retrieves the cached walk state of a single search root, reporting
+// whether one was found and whether it is still within the TTL. Expired shards
+// are still returned so they can be revalidated instead of walked from scratch.
+func (m *Manager) LoadShard(root string) (discover.WalkState, bool, bool) {
+	m.migrate(func(format string) string { return m.shardPath(root, format) }, &shardFile{}, false)
+	shardPath := m.getShardPath(root)
+
+	info, err := os.Stat(shardPath)
+	if err != nil {
+		return discover.WalkState{}, false, false
+	}
+
+	data, err := os.ReadFile(shardPath)
+	if err != nil {
+		return discover.WalkState{}, false, false
+	}
+
+	var file shardFile
+	if err := decode(m.cacheFormat(), data, &file); err != nil || file.Walk.Root != root {
+		if m.verbose {
+			fmt.Fprintf(os.Stderr, "Ignoring corrupt cache shard %s for %s\n", shardPath, root)
+		}
+		return discover.WalkState{}, false, false
+	}
+	if err := checkHeader(file.Header, m.shardHeader()); err != nil {
+		if m.verbose {
+			fmt.Fprintf(os.Stderr, "Discarding cache shard for %s: %v\n", root, err)
+		}
+		return discover.WalkState{}, false, false
+	}
+	state := file.Walk
+
+	fresh := time.Since(info.ModTime()).Seconds() <= float64(m.config.CacheTTL)
+	if m.verbose && fresh {
+		fmt.Fprintf(os.Stderr, "Using cached shard for %s (%d projects)\n", root, len(state.Projects))
+	}
+	return state, true, fresh
+}
+
+// SetShard caches the walk state of a single search root
+func (m *Manager) SetShard(state discover.WalkState) error {
+	if err := os.MkdirAll(m.cacheDir, 0755); err != nil {
+		return err
+	}
+
+	data, err := encode(m.cacheFormat(), shardFile{Header: m.shardHeader(), Profile: m.config.Profile, Walk: state}, false)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(m.getShardPath(state.Root), data)
 }
 
 // Clear removes all cache files
@@ -86,21 +159,74 @@ func (m *Manager) Clear() error {
 	return os.RemoveAll(m.cacheDir)
 }
 
+// Key identifies the current settings; files for other settings live alongside
+func (m *Manager) Key() string {
+	return m.computeConfigHash()
+}
+
 // getCachePath returns the cache file path based on config hash
 func (m *Manager) getCachePath() string {
+	return m.cachePath(m.cacheFormat())
+}
+
+// cachePath returns the path of the combined results cache written in format
+func (m *Manager) cachePath(format string) string {
 	hash := m.computeConfigHash()
-	return filepath.Join(m.cacheDir, fmt.Sprintf("cache-%s.json", hash))
+	return filepath.Join(m.cacheDir, fmt.Sprintf("cache-%s.%s", hash, format))
+}
+
+// migrateResults converts a combined results cache written in another format
+func (m *Manager) migrateResults() {
+	m.migrate(m.cachePath, &resultsFile{}, true)
+}
+
+// getShardPath returns the shard file path for a search root. Shards are keyed by
+// the root and the settings that affect its walk, so adding or removing other
+// search paths doesn't invalidate them.
+func (m *Manager) getShardPath(root string) string {
+	return m.shardPath(root, m.cacheFormat())
+}
+
+// shardPath returns the path of a search root's shard written in format
+func (m *Manager) shardPath(root, format string) string {
+	h := sha256.New()
+	h.Write([]byte(root))
+	m.writeWalkSettings(h)
+	return filepath.Join(m.cacheDir, fmt.Sprintf("shard-%x.%s", h.Sum(nil)[:8], format))
 }
 
 // computeConfigHash creates a hash of the configuration
 func (m *Manager) computeConfigHash() string {
 	h := sha256.New()
 
-	paths := make([]string, len(m.config.SearchPaths))
-	copy(paths, m.config.SearchPaths)
-	sort.Strings(paths)
-	h.Write([]byte(strings.Join(paths, "|")))
+	h.Write([]byte(strings.Join(m.searchRoots(), "|")))
+
+	m.writeWalkSettings(h)
+
+	for _, p := range m.config.Projects {
+		h.Write([]byte(strings.Join([]string{p.Path, p.Name, p.Marker, p.Label, p.Icon, strings.Join(p.Tags, ",")}, "|")))
+	}
+
+	// Each profile gets its own results cache, even if its settings match another's
+	if m.config.Profile != "" {
+		h.Write([]byte("profile:" + m.config.Profile))
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
 
+// searchRoots returns the sorted directories the search paths currently expand to.
+// Hashing these rather than the configured strings keeps results found with one
+// value of an environment variable, or before a directory matched a glob, from
+// being returned for another.
+func (m *Manager) searchRoots() []string {
+	roots := discover.Roots(m.config)
+	sort.Strings(roots)
+	return roots
+}
+
+// writeWalkSettings hashes the settings that affect what walking a search root finds
+func (m *Manager) writeWalkSettings(h hash.Hash) {
 	markers := make([]string, len(m.config.Markers))
 	copy(markers, m.config.Markers)
 	sort.Strings(markers)
@@ -116,8 +242,6 @@ func (m *Manager) computeConfigHash() string {
 	h.Write([]byte(strconv.FormatBool(m.config.Nested)))
 	h.Write([]byte(strconv.FormatBool(m.config.Worktrees)))
 	h.Write([]byte(strconv.FormatBool(m.config.NoWorktrees)))
-
-	return fmt.Sprintf("%x", h.Sum(nil))[:16]
 }
 
 // getCacheDir returns the cache directory using XDG_CACHE_HOME
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"testing"
 	"time"
 
@@ -36,9 +38,12 @@ func TestGetCacheDir(t *testing.T) {
 }
 
 func TestComputeConfigHash(t *testing.T) {
+	// Hashes cover the directories search paths expand to, so they must exist
+	path1, path2 := t.TempDir(), t.TempDir()
+
 	t.Run("same config produces same hash", func(t *testing.T) {
 		cfg := &config.Config{
-			SearchPaths: []string{"/path1", "/path2"},
+			SearchPaths: []string{path1, path2},
 			Markers:     []string{".git", "go.mod"},
 			Excludes:    []string{"node_modules"},
 			MaxDepth:    3,
@@ -57,14 +62,14 @@ func TestComputeConfigHash(t *testing.T) {
 
 	t.Run("different configs produce different hashes", func(t *testing.T) {
 		cfg1 := &config.Config{
-			SearchPaths: []string{"/path1"},
+			SearchPaths: []string{path1},
 			Markers:     []string{".git"},
 			Excludes:    []string{"node_modules"},
 			MaxDepth:    3,
 		}
 
 		cfg2 := &config.Config{
-			SearchPaths: []string{"/path2"},
+			SearchPaths: []string{path2},
 			Markers:     []string{".git"},
 			Excludes:    []string{"node_modules"},
 			MaxDepth:    3,
@@ -83,14 +88,14 @@ func TestComputeConfigHash(t *testing.T) {
 
 	t.Run("order-independent hashing", func(t *testing.T) {
 		cfg1 := &config.Config{
-			SearchPaths: []string{"/path1", "/path2"},
+			SearchPaths: []string{path1, path2},
 			Markers:     []string{".git", "go.mod"},
 			Excludes:    []string{"node_modules", "vendor"},
 			MaxDepth:    3,
 		}
 
 		cfg2 := &config.Config{
-			SearchPaths: []string{"/path2", "/path1"},
+			SearchPaths: []string{path2, path1},
 			Markers:     []string{"go.mod", ".git"},
 			Excludes:    []string{"vendor", "node_modules"},
 			MaxDepth:    3,
@@ -107,16 +112,50 @@ func TestComputeConfigHash(t *testing.T) {
 		}
 	})
 
+	t.Run("pinned projects affect hash", func(t *testing.T) {
+		cfg1 := &config.Config{
+			SearchPaths: []string{path1},
+			Markers:     []string{".git"},
+			MaxDepth:    3,
+		}
+
+		cfg2 := &config.Config{
+			SearchPaths: []string{path1},
+			Markers:     []string{".git"},
+			MaxDepth:    3,
+			Projects:    []config.PinnedProject{{Path: "/srv/infra"}},
+		}
+
+		m1 := &Manager{config: cfg1}
+		m2 := &Manager{config: cfg2}
+
+		if m1.computeConfigHash() == m2.computeConfigHash() {
+			t.Error("Pinning a project should change the hash")
+		}
+	})
+
+	t.Run("profile affects hash", func(t *testing.T) {
+		cfg1 := &config.Config{SearchPaths: []string{path1}, Markers: []string{".git"}, MaxDepth: 3}
+		cfg2 := &config.Config{SearchPaths: []string{path1}, Markers: []string{".git"}, MaxDepth: 3, Profile: "work"}
+
+		m1 := &Manager{config: cfg1}
+		m2 := &Manager{config: cfg2}
+
+		if m1.computeConfigHash() == m2.computeConfigHash() {
+			t.Error("Profiles with the same settings should still get their own hash")
+		}
+	})
+
 	t.Run("different max depth produces different hash", func(t *testing.T) {
 		cfg1 := &config.Config{
-			SearchPaths: []string{"/path1"},
+			SearchPaths: []string{path1},
 			Markers:     []string{".git"},
 			Excludes:    []string{},
 			MaxDepth:    3,
 		}
 
 		cfg2 := &config.Config{
-			SearchPaths: []string{"/path1"},
+			SearchPaths: []string{path1},
 			Markers:     []string{".git"},
 			Excludes:    []string{},
 			MaxDepth:    5,
@@ -135,7 +174,7 @@ func TestComputeConfigHash(t *testing.T) {
 
 	t.Run("different Worktrees produces different hash", func(t *testing.T) {
 		cfg1 := &config.Config{
-			SearchPaths: []string{"/path1"},
+			SearchPaths: []string{path1},
 			Markers:     []string{".git"},
 			Excludes:    []string{},
 			MaxDepth:    3,
@@ -143,7 +182,7 @@ func TestComputeConfigHash(t *testing.T) {
 		}
 
 		cfg2 := &config.Config{
-			SearchPaths: []string{"/path1"},
+			SearchPaths: []string{path1},
 			Markers:     []string{".git"},
 			Excludes:    []string{},
 			MaxDepth:    3,
@@ -163,7 +202,7 @@ func TestComputeConfigHash(t *testing.T) {
 
 	t.Run("different NoWorktrees produces different hash", func(t *testing.T) {
 		cfg1 := &config.Config{
-			SearchPaths: []string{"/path1"},
+			SearchPaths: []string{path1},
 			Markers:     []string{".git"},
 			Excludes:    []string{},
 			MaxDepth:    3,
@@ -171,7 +210,7 @@ func TestComputeConfigHash(t *testing.T) {
 		}
 
 		cfg2 := &config.Config{
-			SearchPaths: []string{"/path1"},
+			SearchPaths: []string{path1},
 			Markers:     []string{".git"},
 			Excludes:    []string{},
 			MaxDepth:    3,
@@ -191,7 +230,7 @@ func TestComputeConfigHash(t *testing.T) {
 
 	t.Run("different Nested produces different hash", func(t *testing.T) {
 		cfg1 := &config.Config{
-			SearchPaths: []string{"/path1"},
+			SearchPaths: []string{path1},
 			Markers:     []string{".git"},
 			Excludes:    []string{},
 			MaxDepth:    3,
@@ -199,7 +238,7 @@ func TestComputeConfigHash(t *testing.T) {
 		}
 
 		cfg2 := &config.Config{
-			SearchPaths: []string{"/path1"},
+			SearchPaths: []string{path1},
 			Markers:     []string{".git"},
 			Excludes:    []string{},
 			MaxDepth:    3,
@@ -364,7 +403,7 @@ func TestGet(t *testing.T) {
 			{Path: "/test/project1", Marker: ".git", Priority: 1},
 			{Path: "/test/project2", Marker: "go.mod", Priority: 10},
 		}
-		data, _ := json.MarshalIndent(expectedProjects, "", "  ")
+		data, _ := json.MarshalIndent(resultsFile{Header: m.resultsHeader(), Projects: expectedProjects}, "", "  ")
 		cachePath := m.getCachePath()
 		if err := os.WriteFile(cachePath, data, 0644); err != nil {
 			t.Fatal(err)
@@ -428,10 +467,14 @@ func TestSet(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		var readProjects []discover.Project
-		if err := json.Unmarshal(data, &readProjects); err != nil {
+		var file resultsFile
+		if err := json.Unmarshal(data, &file); err != nil {
 			t.Fatalf("Cache file contains invalid JSON: %v", err)
 		}
+		if file.Header != m.resultsHeader() {
+			t.Errorf("Cache header = %+v, want %+v", file.Header, m.resultsHeader())
+		}
+		readProjects := file.Projects
 
 		if len(readProjects) != len(projects) {
 			t.Errorf("Cache contains %d projects, want %d", len(readProjects), len(projects))
@@ -572,3 +615,219 @@ func TestRoundTrip(t *testing.T) {
 		}
 	}
 }
+
+func TestCacheHeader(t *testing.T) {
+	baseConfig := func() *config.Config {
+		return &config.Config{
+			SearchPaths: []string{"/test"},
+			Markers:     []string{".git", "go.mod"},
+			Priorities:  map[string]int{".git": 1, "go.mod": 10},
+			MaxDepth:    3,
+			CacheTTL:    300,
+			Nested:      true,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		change  func(cfg *config.Config)
+		version string
+		wantHit bool
+		// Settings that only affect the combined results leave search root shards valid
+		resultsOnly bool
+	}{
+		{name: "unchanged", change: func(cfg *config.Config) {}, wantHit: true},
+		{name: "priority changed", change: func(cfg *config.Config) { cfg.Priorities["go.mod"] = 3 }},
+		{name: "marker type changed", change: func(cfg *config.Config) { cfg.MarkerTypes = map[string]string{"go.mod": config.MarkerTypeDir} }},
+		{name: "per-marker nested changed", change: func(cfg *config.Config) { cfg.MarkerNested = map[string]bool{".git": false} }},
+		{name: "stop marker added", change: func(cfg *config.Config) { cfg.StopMarkers = map[string]bool{".git": true} }},
+		{name: "pj upgraded", change: func(cfg *config.Config) {}, version: "v9.9.9"},
+		{name: "source added", change: func(cfg *config.Config) {
+			cfg.Sources = []config.SourceConfig{{Name: "remote", Type: config.SourceCommand, Command: "cat repos.txt"}}
+		}, resultsOnly: true},
+		{name: "editor recents enabled", change: func(cfg *config.Config) { cfg.EditorRecents.Zed = true }, resultsOnly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+			defer func(v string) { Version = v }(Version)
+
+			m := New(baseConfig(), false)
+			projects := []discover.Project{{Path: "/test/a", Marker: "go.mod", Priority: 10}}
+			if err := m.Set(projects); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.SetShard(discover.WalkState{Root: "/test"}); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := baseConfig()
+			tt.change(cfg)
+			if tt.version != "" {
+				Version = tt.version
+			}
+			m = New(cfg, false)
+
+			_, err := m.Get()
+			if hit := err == nil; hit != tt.wantHit {
+				t.Errorf("Get() hit = %v (err %v), want %v", hit, err, tt.wantHit)
+			}
+			if _, ok, _ := m.LoadShard("/test"); ok != (tt.wantHit || tt.resultsOnly) {
+				t.Errorf("LoadShard() ok = %v, want %v", ok, tt.wantHit || tt.resultsOnly)
+			}
+		})
+	}
+
+	t.Run("unversioned cache file", func(t *testing.T) {
+		t.Setenv("XDG_CACHE_HOME", t.TempDir())
+		m := New(baseConfig(), false)
+		if err := os.MkdirAll(m.cacheDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal([]discover.Project{{Path: "/test/a", Marker: "go.mod"}})
+		if err := os.WriteFile(m.getCachePath(), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Get(); err == nil {
+			t.Error("Get() should reject a cache file without a header")
+		}
+	})
+}
+
+func TestShards(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", tmpDir)
+
+	cfg := &config.Config{
+		SearchPaths: []string{"/test"},
+		Markers:     []string{".git"},
+		MaxDepth:    3,
+		CacheTTL:    300,
+	}
+	m := New(cfg, false)
+
+	if _, ok, _ := m.LoadShard("/test"); ok {
+		t.Error("LoadShard() should report no shard before one is saved")
+	}
+
+	state := discover.WalkState{
+		Root:     "/test",
+		Projects: []discover.WalkProject{{Project: discover.Project{Path: "/test/a", Marker: ".git"}, Origin: "/test/a"}},
+		Watched:  []discover.WatchedPath{{Path: "/test", ModTime: 42}, {Path: "/test/a/.gitignore", ModTime: 7, Dir: "/test/a"}},
+	}
+	if err := m.SetShard(state); err != nil {
+		t.Fatalf("SetShard() error = %v", err)
+	}
+
+	got, ok, fresh := m.LoadShard("/test")
+	if !ok || !fresh {
+		t.Fatalf("LoadShard() ok = %v, fresh = %v, want true, true", ok, fresh)
+	}
+	if !reflect.DeepEqual(got, state) {
+		t.Errorf("LoadShard() = %+v, want %+v", got, state)
+	}
+
+	// Shards are shared by configs that differ only in their other search paths
+	wider := New(&config.Config{
+		SearchPaths: []string{"/test", "/other"},
+		Markers:     []string{".git"},
+		MaxDepth:    3,
+		CacheTTL:    300,
+	}, false)
+	if _, ok, _ := wider.LoadShard("/test"); !ok {
+		t.Error("adding a search path should keep existing roots' shards")
+	}
+
+	// ...but not by configs that walk differently
+	deeper := New(&config.Config{
+		SearchPaths: []string{"/test"},
+		Markers:     []string{".git"},
+		MaxDepth:    5,
+		CacheTTL:    300,
+	}, false)
+	if _, ok, _ := deeper.LoadShard("/test"); ok {
+		t.Error("changing max depth should not reuse shards")
+	}
+
+	// Expired shards are still returned for revalidation
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(m.getShardPath("/test"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, fresh := m.LoadShard("/test"); !ok || fresh {
+		t.Errorf("expired LoadShard() ok = %v, fresh = %v, want true, false", ok, fresh)
+	}
+}
+
+func TestRefreshLock(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+		t.Skip("refresh lock is a no-op on this platform")
+	}
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", tmpDir)
+
+	cfg := &config.Config{
+		SearchPaths: []string{"/test"},
+		Markers:     []string{".git"},
+		MaxDepth:    3,
+		CacheTTL:    300,
+	}
+	m := New(cfg, false)
+
+	lock, err := m.TryLockRefresh()
+	if err != nil || lock == nil {
+		t.Fatalf("TryLockRefresh() = %v, %v, want a lock", lock, err)
+	}
+	if other, err := m.TryLockRefresh(); err != nil || other != nil {
+		t.Errorf("second TryLockRefresh() = %v, %v, want nil, nil", other, err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+
+	// A lock file left behind, as by a refresher that exited, doesn't block the next one
+	if _, err := os.Stat(m.getRefreshLockPath()); err != nil {
+		t.Fatalf("lock file should be kept: %v", err)
+	}
+	lock, err = m.TryLockRefresh()
+	if err != nil || lock == nil {
+		t.Fatalf("TryLockRefresh() after unlock = %v, %v, want a lock", lock, err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+}
+
+func TestGetStale(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", tmpDir)
+
+	cfg := &config.Config{
+		SearchPaths: []string{"/test"},
+		Markers:     []string{".git"},
+		MaxDepth:    3,
+		CacheTTL:    1,
+	}
+	m := New(cfg, false)
+
+	projects := []discover.Project{{Path: "/test/project1", Marker: ".git", Priority: 1}}
+	if err := m.Set(projects); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(m.getCachePath(), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Get(); err == nil {
+		t.Error("Get() should return error when cache expired")
+	}
+	got, err := m.GetStale()
+	if err != nil {
+		t.Fatalf("GetStale() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, projects) {
+		t.Errorf("GetStale() = %+v, want %+v", got, projects)
+	}
+}
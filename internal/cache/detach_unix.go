@@ -0,0 +1,11 @@
+//go:build !windows
+
+package cache
+
+import "syscall"
+
+// detachedProcAttr starts the refresher in its own session so it outlives the
+// terminal or shell keybinding that spawned it
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package cache
+
+import "syscall"
+
+// detachedProcess is the DETACHED_PROCESS process creation flag
+const detachedProcess = 0x00000008
+
+// detachedProcAttr starts the refresher without a console in its own process group
+// so it outlives the terminal that spawned it
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP}
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/josephschmitt/pj/internal/config"
+	"github.com/josephschmitt/pj/internal/fsutil"
+)
+
+// cacheFormats lists every encoding cache files can be written in. Format names
+// double as file extensions.
+var cacheFormats = []string{config.CacheFormatJSON, config.CacheFormatGob}
+
+// cacheFormat returns the configured encoding, defaulting to JSON
+func (m *Manager) cacheFormat() string {
+	if m.config.CacheFormat == config.CacheFormatGob {
+		return config.CacheFormatGob
+	}
+	return config.CacheFormatJSON
+}
+
+// encode serializes v in the given format; indent only applies to JSON
+func encode(format string, v any, indent bool) ([]byte, error) {
+	switch {
+	case format == config.CacheFormatGob:
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case indent:
+		return json.MarshalIndent(v, "", "  ")
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// decode deserializes data written in the given format into v
+func decode(format string, data []byte, v any) error {
+	if format == config.CacheFormatGob {
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// migrate converts a cache file written in another format to the configured one, so
+// changing cache_format doesn't throw away a valid cache. pathFor returns the file's
+// path for a format and v is a pointer to the file's type. The converted file keeps
+// the old modification time, so it expires when the old one would have.
+func (m *Manager) migrate(pathFor func(format string) string, v any, indent bool) {
+	want := m.cacheFormat()
+	newPath := pathFor(want)
+	if _, err := os.Stat(newPath); err == nil {
+		return
+	}
+
+	for _, format := range cacheFormats {
+		if format == want {
+			continue
+		}
+		oldPath := pathFor(format)
+		info, err := os.Stat(oldPath)
+		if err != nil {
+			continue
+		}
+
+		// Unreadable files are left for the next write to replace or Clear to remove
+		data, err := os.ReadFile(oldPath)
+		if err != nil || decode(format, data, v) != nil {
+			continue
+		}
+		if data, err = encode(want, v, indent); err != nil {
+			continue
+		}
+		if err := fsutil.WriteFileAtomic(newPath, data); err != nil {
+			if m.verbose {
+				fmt.Fprintf(os.Stderr, "Warning: failed to migrate cache file %s: %v\n", oldPath, err)
+			}
+			return
+		}
+		_ = os.Chtimes(newPath, info.ModTime(), info.ModTime())
+		_ = os.Remove(oldPath)
+
+		if m.verbose {
+			fmt.Fprintf(os.Stderr, "Migrated cache file %s to %s\n", oldPath, newPath)
+		}
+		return
+	}
+}
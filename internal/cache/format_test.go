@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/josephschmitt/pj/internal/config"
+	"github.com/josephschmitt/pj/internal/discover"
+)
+
+func TestCacheFormats(t *testing.T) {
+	projects := []discover.Project{
+		{Path: "/test/app", Marker: ".git", Priority: 1, VCS: "git", Owner: "me", Repo: "app"},
+		{Path: "/test/app/lib", Marker: "go.mod", Priority: 10, ParentProject: "/test/app", Depth: 1, Tags: []string{"go"}},
+	}
+	state := discover.WalkState{
+		Root:     "/test",
+		Projects: []discover.WalkProject{{Project: projects[0], Origin: "/test/app"}},
+		Watched:  []discover.WatchedPath{{Path: "/test", ModTime: 42}, {Path: "/test/app/.gitignore", ModTime: 7, Dir: "/test/app"}},
+	}
+
+	for _, format := range []string{config.CacheFormatJSON, config.CacheFormatGob} {
+		t.Run(format, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+			cfg := &config.Config{SearchPaths: []string{"/test"}, Markers: []string{".git", "go.mod"}, MaxDepth: 3, CacheTTL: 300, CacheFormat: format}
+			m := New(cfg, false)
+
+			if err := m.Set(projects); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			got, err := m.Get()
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, projects) {
+				t.Errorf("Get() = %+v, want %+v", got, projects)
+			}
+
+			if err := m.SetShard(state); err != nil {
+				t.Fatalf("SetShard() error = %v", err)
+			}
+			shard, ok, fresh := m.LoadShard("/test")
+			if !ok || !fresh {
+				t.Fatalf("LoadShard() ok = %v, fresh = %v, want true, true", ok, fresh)
+			}
+			if !reflect.DeepEqual(shard, state) {
+				t.Errorf("LoadShard() = %+v, want %+v", shard, state)
+			}
+		})
+	}
+}
+
+func TestCacheFormatMigration(t *testing.T) {
+	tests := []struct {
+		from, to string
+	}{
+		{from: config.CacheFormatJSON, to: config.CacheFormatGob},
+		{from: config.CacheFormatGob, to: config.CacheFormatJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+			projects := []discover.Project{{Path: "/test/app", Marker: ".git", Priority: 1}}
+			state := discover.WalkState{Root: "/test", Projects: []discover.WalkProject{{Project: projects[0], Origin: "/test/app"}}}
+
+			cfg := &config.Config{SearchPaths: []string{"/test"}, Markers: []string{".git"}, MaxDepth: 3, CacheTTL: 300, CacheFormat: tt.from}
+			old := New(cfg, false)
+			if err := old.Set(projects); err != nil {
+				t.Fatal(err)
+			}
+			if err := old.SetShard(state); err != nil {
+				t.Fatal(err)
+			}
+			oldPaths := []string{old.getCachePath(), old.getShardPath("/test")}
+			written := time.Now().Add(-time.Minute).Truncate(time.Second)
+			if err := os.Chtimes(oldPaths[0], written, written); err != nil {
+				t.Fatal(err)
+			}
+
+			m := New(&config.Config{SearchPaths: []string{"/test"}, Markers: []string{".git"}, MaxDepth: 3, CacheTTL: 300, CacheFormat: tt.to}, false)
+			got, err := m.Get()
+			if err != nil {
+				t.Fatalf("Get() after format change error = %v", err)
+			}
+			if !reflect.DeepEqual(got, projects) {
+				t.Errorf("Get() = %+v, want %+v", got, projects)
+			}
+			if _, ok, _ := m.LoadShard("/test"); !ok {
+				t.Error("LoadShard() after format change found no shard")
+			}
+
+			for _, path := range oldPaths {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("%s still exists after migration", path)
+				}
+			}
+			info, err := os.Stat(m.getCachePath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(written) {
+				t.Errorf("migrated cache mtime = %v, want %v", info.ModTime(), written)
+			}
+		})
+	}
+}
+
+// BenchmarkGet compares loading a large results cache in each format
+func BenchmarkGet(b *testing.B) {
+	const count = 40000
+	projects := make([]discover.Project, count)
+	for i := range projects {
+		projects[i] = discover.Project{
+			Path:      fmt.Sprintf("/home/build/src/team-%d/service-%d", i%100, i),
+			Marker:    ".git",
+			Priority:  1,
+			VCS:       "git",
+			RemoteURL: fmt.Sprintf("git@github.com:team-%d/service-%d.git", i%100, i),
+			Host:      "github.com",
+			Owner:     fmt.Sprintf("team-%d", i%100),
+			Repo:      fmt.Sprintf("service-%d", i),
+		}
+	}
+
+	for _, format := range []string{config.CacheFormatJSON, config.CacheFormatGob} {
+		b.Run(format, func(b *testing.B) {
+			b.Setenv("XDG_CACHE_HOME", b.TempDir())
+			cfg := &config.Config{SearchPaths: []string{"/home/build/src"}, Markers: []string{".git"}, MaxDepth: 3, CacheTTL: 300, CacheFormat: format}
+			m := New(cfg, false)
+			if err := m.Set(projects); err != nil {
+				b.Fatal(err)
+			}
+			if info, err := os.Stat(m.getCachePath()); err == nil {
+				b.ReportMetric(float64(info.Size()), "file-bytes")
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := m.Get(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/josephschmitt/pj/internal/config"
+	"github.com/josephschmitt/pj/internal/discover"
+)
+
+// schemaVersion is bumped whenever the layout of cache files changes
+const schemaVersion = 3
+
+// Version is the pj version recorded in cache headers. Caches written by another
+// version are discarded, since new releases can change default markers and how
+// projects are detected. main sets it from the build version.
+var Version = "dev"
+
+// Header identifies what produced a cache file. Files whose header doesn't match
+// the running pj and its current settings are treated as missing.
+type Header struct {
+	Schema   int    `json:"schema"`
+	Version  string `json:"version"`
+	Settings string `json:"settings"` // Digest of every setting that affects the cached results
+}
+
+// resultsFile is the on-disk format of the combined results cache
+type resultsFile struct {
+	Header   Header             `json:"header"`
+	Profile  string             `json:"profile,omitempty"` // Config profile that wrote it, for `pj cache gc`
+	Roots    []string           `json:"roots"`             // Search paths, for `pj cache info`
+	Projects []discover.Project `json:"projects"`
+}
+
+// shardFile is the on-disk format of a single search root's cache shard
+type shardFile struct {
+	Header  Header             `json:"header"`
+	Profile string             `json:"profile,omitempty"` // Config profile that last wrote it
+	Walk    discover.WalkState `json:"walk"`
+}
+
+// resultsHeader returns the header expected on the combined results cache
+func (m *Manager) resultsHeader() Header {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "paths:%s\n", strings.Join(m.searchRoots(), "|"))
+
+	for _, p := range m.config.Projects {
+		fmt.Fprintf(h, "pin:%s\n", strings.Join([]string{p.Path, p.Name, p.Marker, p.Label, p.Icon, strings.Join(p.Tags, ",")}, "|"))
+	}
+
+	for _, s := range m.config.Sources {
+		fmt.Fprintf(h, "source:%s\n", strings.Join([]string{s.Name, s.Type, strings.Join(s.Paths, ","), s.Command, fmt.Sprint(s.Timeout)}, "|"))
+	}
+	fmt.Fprintf(h, "editors:%s\n", strings.Join(m.config.EditorRecents.Enabled(), ","))
+
+	m.writeMarkerSettings(h)
+	m.writeWalkSettings(h)
+
+	return Header{Schema: schemaVersion, Version: Version, Settings: fmt.Sprintf("%x", h.Sum(nil))}
+}
+
+// Fingerprint identifies the pj version and every setting that affects the results,
+// so results from another source (like the daemon) can be checked against them
+func (m *Manager) Fingerprint() string {
+	h := m.resultsHeader()
+	return fmt.Sprintf("%d/%s/%s", h.Schema, h.Version, h.Settings)
+}
+
+// shardHeader returns the header expected on search root shards, which only depend
+// on how roots are walked
+func (m *Manager) shardHeader() Header {
+	h := sha256.New()
+	m.writeMarkerSettings(h)
+	m.writeWalkSettings(h)
+	return Header{Schema: schemaVersion, Version: Version, Settings: fmt.Sprintf("%x", h.Sum(nil))}
+}
+
+// writeMarkerSettings hashes the per-marker settings that decide which marker wins
+// and where discovery stops, which the file name hash leaves out
+func (m *Manager) writeMarkerSettings(h hash.Hash) {
+	markers := make([]string, len(m.config.Markers))
+	copy(markers, m.config.Markers)
+	sort.Strings(markers)
+
+	for _, marker := range markers {
+		fmt.Fprintf(h, "marker:%s|priority=%d|type=%s|pattern=%t|descend=%t|stop=%t\n",
+			marker,
+			m.config.Priorities[marker],
+			m.config.GetMarkerType(marker),
+			config.IsPatternMarker(marker),
+			m.config.ShouldDescend(marker),
+			m.config.StopMarkers[marker],
+		)
+	}
+}
+
+// checkHeader returns an error describing why a cache file's header doesn't match
+func checkHeader(got, want Header) error {
+	switch {
+	case got.Schema != want.Schema:
+		return fmt.Errorf("cache format %d is not %d", got.Schema, want.Schema)
+	case got.Version != want.Version:
+		return fmt.Errorf("cache written by pj %s", got.Version)
+	case got.Settings != want.Settings:
+		return fmt.Errorf("cache written with different settings")
+	}
+	return nil
+}
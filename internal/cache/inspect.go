@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/josephschmitt/pj/internal/fsutil"
+)
+
+// Kinds of files found in the cache directory
+const (
+	KindResults = "results" // Combined results for a set of search paths
+	KindShard   = "shard"   // Walk state of a single search root
+	KindLock    = "lock"    // Discovery or refresh lock
+	KindTemp    = "temp"    // Leftover from an interrupted atomic write
+)
+
+// tempFileTimeout is how old a temporary file must be before gc assumes the write
+// that created it was interrupted rather than still in progress
+const tempFileTimeout = 10 * time.Minute
+
+// Entry describes a file in the cache directory
+type Entry struct {
+	Path     string    `json:"path"`
+	Kind     string    `json:"kind"`
+	Roots    []string  `json:"roots,omitempty"`   // Search paths the entry was written for
+	Version  string    `json:"version,omitempty"` // pj version that wrote the entry
+	Profile  string    `json:"profile,omitempty"` // Config profile that wrote the entry
+	Projects int       `json:"projects"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+	Current  bool      `json:"current"`         // Usable with the current config and pj version
+	Error    string    `json:"error,omitempty"` // Why the entry couldn't be read
+}
+
+// Dir returns the cache directory
+func (m *Manager) Dir() string {
+	return m.cacheDir
+}
+
+// Entries lists the files in the cache directory, oldest first
+func (m *Manager) Entries() ([]Entry, error) {
+	files, err := os.ReadDir(m.cacheDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		entry, ok := m.inspect(filepath.Join(m.cacheDir, file.Name()), info)
+		if ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ModTime.Before(entries[j].ModTime)
+	})
+	return entries, nil
+}
+
+// inspect describes a single cache file, reporting false for files pj didn't write
+func (m *Manager) inspect(path string, info os.FileInfo) (Entry, bool) {
+	name := info.Name()
+	entry := Entry{Path: path, Size: info.Size(), ModTime: info.ModTime()}
+	hash := m.computeConfigHash()
+
+	switch {
+	case strings.Contains(name, ".tmp-"):
+		entry.Kind = KindTemp
+	case strings.HasSuffix(name, ".lock"):
+		entry.Kind = KindLock
+		entry.Current = strings.HasSuffix(name, "-"+hash+".lock")
+	case strings.HasPrefix(name, "cache-"):
+		entry.Kind = KindResults
+		var file resultsFile
+		if err := readFile(path, &file); err != nil {
+			entry.Error = err.Error()
+			break
+		}
+		entry.Roots = file.Roots
+		entry.Version = file.Header.Version
+		entry.Profile = file.Profile
+		entry.Projects = len(file.Projects)
+		entry.Current = strings.HasPrefix(name, "cache-"+hash+".") && checkHeader(file.Header, m.resultsHeader()) == nil
+	case strings.HasPrefix(name, "shard-"):
+		entry.Kind = KindShard
+		var file shardFile
+		if err := readFile(path, &file); err != nil {
+			entry.Error = err.Error()
+			break
+		}
+		entry.Roots = []string{file.Walk.Root}
+		entry.Version = file.Header.Version
+		entry.Profile = file.Profile
+		entry.Projects = len(file.Walk.Projects)
+		entry.Current = checkHeader(file.Header, m.shardHeader()) == nil
+	default:
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// readFile decodes a cache file in the format given by its extension
+func readFile(path string, v any) error {
+	format := strings.TrimPrefix(filepath.Ext(path), ".")
+	known := false
+	for _, f := range cacheFormats {
+		known = known || f == format
+	}
+	if !known {
+		return fmt.Errorf("unknown cache format %q", format)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := decode(format, data, v); err != nil {
+		return fmt.Errorf("cache corrupt: %w", err)
+	}
+	return nil
+}
+
+// GC removes cache entries that haven't been written within maxAge or can't be used
+// with the current config and pj version, and returns the removed entries. Entries
+// for other search roots stay as long as they were written with the current
+// settings, so shards of piped paths survive. Entries another config profile wrote
+// are only removed once they're older than maxAge.
+func (m *Manager) GC(maxAge time.Duration) ([]Entry, error) {
+	entries, err := m.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []Entry
+	for _, entry := range entries {
+		if !m.collectable(entry, maxAge) {
+			continue
+		}
+		if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		if m.verbose {
+			fmt.Fprintf(os.Stderr, "Removed %s\n", entry.Path)
+		}
+		removed = append(removed, entry)
+	}
+	return removed, nil
+}
+
+// collectable reports whether gc should remove an entry
+func (m *Manager) collectable(entry Entry, maxAge time.Duration) bool {
+	age := time.Since(entry.ModTime)
+
+	switch {
+	case entry.Kind == KindTemp:
+		return age > tempFileTimeout
+	case entry.Kind == KindLock:
+		// Lock files never change after they're created, so age says nothing about
+		// whether they're in use. Only remove other configs' locks nobody holds.
+		return !entry.Current && !fsutil.Locked(entry.Path)
+	case entry.Profile != m.config.Profile:
+		// Entries another profile wrote are checked against its settings, not ours
+		return age > maxAge
+	default:
+		return age > maxAge || !entry.Current
+	}
+}
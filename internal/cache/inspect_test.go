@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/josephschmitt/pj/internal/config"
+	"github.com/josephschmitt/pj/internal/discover"
+)
+
+func TestGC(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	newConfig := func(paths ...string) *config.Config {
+		return &config.Config{SearchPaths: paths, Markers: []string{".git"}, MaxDepth: 3, CacheTTL: 300}
+	}
+
+	a, b := t.TempDir(), t.TempDir()
+	m := New(newConfig(a), false)
+	other := New(newConfig(b), false)
+	for _, manager := range []*Manager{m, other} {
+		if err := manager.Set([]discover.Project{{Path: manager.config.SearchPaths[0] + "/app", Marker: ".git"}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := manager.SetShard(discover.WalkState{Root: manager.config.SearchPaths[0]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A shard written with different settings, an old shard and an abandoned write
+	changed := New(&config.Config{SearchPaths: []string{"/c"}, Markers: []string{".git", "go.mod"}, MaxDepth: 3}, false)
+	if err := changed.SetShard(discover.WalkState{Root: "/c"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetShard(discover.WalkState{Root: "/old"}); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	if err := os.Chtimes(m.getShardPath("/old"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	tmp := filepath.Join(m.cacheDir, "cache-0123.json.tmp-42")
+	if err := os.WriteFile(tmp, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(tmp, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := m.Entries()
+	if err != nil {
+		t.Fatalf("Entries() error = %v", err)
+	}
+	if len(entries) != 7 {
+		t.Fatalf("Entries() = %d entries, want 7", len(entries))
+	}
+
+	removed, err := m.GC(30 * 24 * time.Hour)
+	if err != nil {
+		t.Fatalf("GC() error = %v", err)
+	}
+	var got []string
+	for _, e := range removed {
+		got = append(got, e.Path)
+	}
+	sort.Strings(got)
+	want := []string{other.getCachePath(), changed.getShardPath("/c"), m.getShardPath("/old"), tmp}
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("GC() removed %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("GC() removed %v, want %v", got, want)
+			break
+		}
+	}
+
+	for _, path := range []string{m.getCachePath(), m.getShardPath(a), m.getShardPath(b)} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s was removed, want it kept", path)
+		}
+	}
+
+	t.Run("other profiles", func(t *testing.T) {
+		work := newConfig("/w")
+		work.Profile = "work"
+		wm := New(work, false)
+		if err := wm.Set(nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := wm.SetShard(discover.WalkState{Root: "/w"}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Not current for the base config, but only age removes another profile's entries
+		removed, err := m.GC(30 * 24 * time.Hour)
+		if err != nil {
+			t.Fatalf("GC() error = %v", err)
+		}
+		if len(removed) != 0 {
+			t.Errorf("GC() removed %v, want the work profile's entries kept", removed)
+		}
+
+		if err := os.Chtimes(wm.getCachePath(), old, old); err != nil {
+			t.Fatal(err)
+		}
+		removed, err = m.GC(30 * 24 * time.Hour)
+		if err != nil {
+			t.Fatalf("GC() error = %v", err)
+		}
+		if len(removed) != 1 || removed[0].Path != wm.getCachePath() || removed[0].Profile != "work" {
+			t.Errorf("GC() removed %v, want the work profile's old results", removed)
+		}
+	})
+}
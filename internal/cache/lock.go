@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/josephschmitt/pj/internal/fsutil"
+)
+
+// Lock is an advisory lock held on a file in the cache directory. Locks are
+// released automatically if the process holding them exits.
+type Lock = fsutil.Lock
+
+// TryLockDiscovery takes the lock that lets a single process rediscover projects for
+// the current settings while other invocations wait or read the previous results.
+// It returns a nil Lock and no error if another process holds the lock.
+func (m *Manager) TryLockDiscovery() (*Lock, error) {
+	return m.lockDiscovery(false)
+}
+
+// LockDiscovery waits until the discovery lock is free and takes it
+func (m *Manager) LockDiscovery() (*Lock, error) {
+	return m.lockDiscovery(true)
+}
+
+func (m *Manager) lockDiscovery(wait bool) (*Lock, error) {
+	return m.lock(m.getDiscoveryLockPath(), wait)
+}
+
+// lock takes the lock on the file at path in the cache directory
+func (m *Manager) lock(path string, wait bool) (*Lock, error) {
+	if err := os.MkdirAll(m.cacheDir, 0755); err != nil {
+		return nil, err
+	}
+	return fsutil.LockFile(path, wait)
+}
+
+// getDiscoveryLockPath returns the discovery lock file path based on config hash
+func (m *Manager) getDiscoveryLockPath() string {
+	hash := m.computeConfigHash()
+	return filepath.Join(m.cacheDir, fmt.Sprintf("discover-%s.lock", hash))
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/josephschmitt/pj/internal/config"
+)
+
+func TestDiscoveryLock(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+		t.Skip("discovery lock is a no-op on this platform")
+	}
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", tmpDir)
+
+	cfg := &config.Config{SearchPaths: []string{"/test"}, Markers: []string{".git"}, MaxDepth: 3, CacheTTL: 300}
+	m := New(cfg, false)
+
+	lock, err := m.TryLockDiscovery()
+	if err != nil || lock == nil {
+		t.Fatalf("TryLockDiscovery() = %v, %v, want a lock", lock, err)
+	}
+	if other, err := m.TryLockDiscovery(); err != nil || other != nil {
+		t.Errorf("TryLockDiscovery() while locked = %v, %v, want nil, nil", other, err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+
+	lock, err = m.LockDiscovery()
+	if err != nil || lock == nil {
+		t.Fatalf("LockDiscovery() after unlock = %v, %v, want a lock", lock, err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+
+	var none *Lock
+	if err := none.Unlock(); err != nil {
+		t.Errorf("Unlock() on nil lock error = %v, want nil", err)
+	}
+}
+
+func TestGetCorrupt(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", tmpDir)
+
+	cfg := &config.Config{SearchPaths: []string{"/test"}, Markers: []string{".git"}, MaxDepth: 3, CacheTTL: 300}
+	m := New(cfg, false)
+	if err := os.MkdirAll(m.cacheDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A truncated file, as left by a writer that crashed before atomic writes
+	if err := os.WriteFile(m.getCachePath(), []byte(`{"schema": 1, "projects": [{"pa`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get(); err == nil || !strings.Contains(err.Error(), "cache corrupt") {
+		t.Errorf("Get() error = %v, want cache corrupt error", err)
+	}
+}
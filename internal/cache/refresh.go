@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/josephschmitt/pj/internal/discover"
+)
+
+// GetStale retrieves cached projects regardless of their age, for serving an expired
+// cache while it is refreshed in the background
+func (m *Manager) GetStale() ([]discover.Project, error) {
+	m.migrateResults()
+	return m.readResults()
+}
+
+// TryLockRefresh takes the lock held while refreshing the cache in the background,
+// so that concurrent invocations serving a stale cache don't each run a refresher.
+// It returns a nil Lock and no error if another refresher holds the lock. Like the
+// discovery lock, it is released when the refresher exits, however it exits.
+func (m *Manager) TryLockRefresh() (*Lock, error) {
+	return m.lock(m.getRefreshLockPath(), false)
+}
+
+// RefreshInBackground starts a detached copy of the current executable with args to
+// refresh the cache, unless a refresh is already running. The refresher must take
+// the refresh lock itself with TryLockRefresh, and exit if another one holds it.
+func (m *Manager) RefreshInBackground(args []string) error {
+	lock, err := m.TryLockRefresh()
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		if m.verbose {
+			fmt.Fprintf(os.Stderr, "Cache refresh already in progress\n")
+		}
+		return nil
+	}
+	if err := lock.Unlock(); err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// Leaving Stdin, Stdout and Stderr nil connects them to the null device, so the
+	// refresher can't write into the caller's terminal or pipeline
+	cmd := exec.Command(executable, args...)
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if m.verbose {
+		fmt.Fprintf(os.Stderr, "Refreshing cache in background (pid %d)\n", cmd.Process.Pid)
+	}
+	return cmd.Process.Release()
+}
+
+// getRefreshLockPath returns the refresh lock file path based on config hash
+func (m *Manager) getRefreshLockPath() string {
+	hash := m.computeConfigHash()
+	return filepath.Join(m.cacheDir, fmt.Sprintf("refresh-%s.lock", hash))
+}
@@ -18,11 +18,60 @@ type MarkerConfig struct {
 	Icon        string `yaml:"icon,omitempty"`
 	Color       string `yaml:"color,omitempty"`
 	Priority    int    `yaml:"priority,omitempty"`
+	Type        string `yaml:"type,omitempty"` // file, dir, or any (see GetMarkerType for defaults)
+	Nested      *bool  `yaml:"nested,omitempty"` // Overrides Config.Nested when this marker wins
+	Stop        bool   `yaml:"stop,omitempty"`   // Never descend into a directory containing this marker
 	HasIcon     bool   `yaml:"-"` // True if icon field was explicitly set in config
 	HasColor    bool   `yaml:"-"` // True if color field was explicitly set in config
 	HasPriority bool   `yaml:"-"` // True if priority field was explicitly set in config
 }
 
+// Marker types restrict whether a marker matches files, directories, or both
+const (
+	MarkerTypeFile = "file"
+	MarkerTypeDir  = "dir"
+	MarkerTypeAny  = "any"
+)
+
+// Cache modes control what happens when the cache has expired
+const (
+	CacheModeBlocking             = "blocking"               // Rediscover before printing (default)
+	CacheModeStaleWhileRevalidate = "stale-while-revalidate" // Print the expired results and refresh in the background
+)
+
+// Cache formats select how cache files are encoded on disk
+const (
+	CacheFormatJSON = "json" // Human-readable (default)
+	CacheFormatGob  = "gob"  // Compact binary, faster to load for very large project sets
+)
+
+// EditorRecents toggles reading each editor's recently opened projects
+type EditorRecents struct {
+	VSCode    bool `yaml:"vscode"`    // VS Code, VS Code Insiders and VSCodium
+	JetBrains bool `yaml:"jetbrains"` // IntelliJ IDEA, GoLand, PyCharm and the other JetBrains IDEs
+	Zed       bool `yaml:"zed"`
+	Neovim    bool `yaml:"neovim"` // Files in the shada file (:oldfiles, marks and jumps)
+}
+
+// Enabled returns the names of the enabled editors, in a fixed order
+func (e EditorRecents) Enabled() []string {
+	var names []string
+	for _, editor := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"vscode", e.VSCode},
+		{"jetbrains", e.JetBrains},
+		{"zed", e.Zed},
+		{"neovim", e.Neovim},
+	} {
+		if editor.enabled {
+			names = append(names, editor.name)
+		}
+	}
+	return names
+}
+
 // MarkerList handles unmarshaling both old format ([]string) and new format ([]MarkerConfig)
 type MarkerList []MarkerConfig
 
@@ -49,6 +98,11 @@ func (m *MarkerList) UnmarshalYAML(value *yaml.Node) error {
 			if mc.Marker == "" {
 				return fmt.Errorf("marker config must have a 'marker' field")
 			}
+			switch mc.Type {
+			case "", MarkerTypeFile, MarkerTypeDir, MarkerTypeAny:
+			default:
+				return fmt.Errorf("marker %q has invalid type %q (must be file, dir, or any)", mc.Marker, mc.Type)
+			}
 			// Check if icon/color/priority fields were explicitly present
 			for i := 0; i < len(item.Content); i += 2 {
 				switch item.Content[i].Value {
@@ -77,10 +131,22 @@ type Config struct {
 	MaxDepth    int               `yaml:"max_depth"`
 	Excludes    []string          `yaml:"excludes"`
 	CacheTTL    int               `yaml:"cache_ttl"` // seconds
+	CacheMode   string            `yaml:"cache_mode"` // blocking or stale-while-revalidate
+	CacheFormat string            `yaml:"cache_format"` // json or gob
 	NoIgnore    bool              `yaml:"no_ignore"` // Don't respect .gitignore and .ignore files
 	Nested      bool              `yaml:"nested"`    // Continue discovery inside projects
 	Worktrees   bool              `yaml:"worktrees"`    // Actively discover worktrees from parent repos
 	NoWorktrees bool              `yaml:"no_worktrees"` // Filter out worktrees even if found during walk
+	// Projects are pinned directories that always appear in results
+	Projects []PinnedProject `yaml:"projects,omitempty"`
+	// Profiles are named sets of settings that overlay the rest of the config
+	Profiles map[string]yaml.Node `yaml:"profiles,omitempty"`
+	// Profile is the name of the profile in effect, if any
+	Profile string `yaml:"-"`
+	// Sources are extra places projects come from, besides the search paths
+	Sources []SourceConfig `yaml:"sources,omitempty"`
+	// EditorRecents selects the editors whose recently opened projects are merged into results
+	EditorRecents EditorRecents `yaml:"editor_recents,omitempty"`
 	// Deprecated: Use the new markers format with icon field instead.
 	// This field is kept for backward compatibility.
 	Icons map[string]string `yaml:"icons,omitempty"`
@@ -96,6 +162,13 @@ type Config struct {
 	// DisplayLabels maps marker names to their human-readable display labels (derived from RawMarkers)
 	DisplayLabels map[string]string `yaml:"-"`
 
+	// MarkerTypes maps marker names to an explicit file/dir/any type (derived from RawMarkers)
+	MarkerTypes map[string]string `yaml:"-"`
+	// MarkerNested maps marker names to an explicit nested-discovery setting (derived from RawMarkers)
+	MarkerNested map[string]bool `yaml:"-"`
+	// StopMarkers contains markers that halt descent whenever present (derived from RawMarkers)
+	StopMarkers map[string]bool `yaml:"-"`
+
 	// ExactMarkers contains markers without glob patterns (checked via os.Stat)
 	ExactMarkers []string `yaml:"-"`
 	// PatternMarkers contains markers with glob patterns (checked via directory listing)
@@ -136,6 +209,28 @@ func (c *Config) GetDisplayLabels() map[string]string {
 	return c.DisplayLabels
 }
 
+// GetMarkerType returns whether a marker matches files, directories, or both.
+// Markers without an explicit type keep the historical behaviour: pattern markers
+// only match files, exact markers match anything os.Stat finds.
+func (c *Config) GetMarkerType(marker string) string {
+	if t := c.MarkerTypes[marker]; t != "" {
+		return t
+	}
+	if IsPatternMarker(marker) {
+		return MarkerTypeFile
+	}
+	return MarkerTypeAny
+}
+
+// ShouldDescend reports whether discovery continues inside a project whose winning
+// marker is the given marker. A per-marker nested setting overrides Config.Nested.
+func (c *Config) ShouldDescend(marker string) bool {
+	if nested, ok := c.MarkerNested[marker]; ok {
+		return nested
+	}
+	return c.Nested
+}
+
 // EnsureMarkerCategories ensures ExactMarkers and PatternMarkers are populated from Markers.
 // This is useful when Config is created directly (e.g., in tests) without using Load().
 func (c *Config) EnsureMarkerCategories() {
@@ -168,6 +263,12 @@ func Load(configPath string) (*Config, error) {
 
 // LoadWithVerbose loads configuration and optionally emits deprecation warnings
 func LoadWithVerbose(configPath string, verbose bool) (*Config, error) {
+	return LoadProfile(configPath, "", verbose)
+}
+
+// LoadProfile loads configuration with the named profile overlaid on it. An empty
+// profile name loads the base configuration.
+func LoadProfile(configPath, profile string, verbose bool) (*Config, error) {
 	cfg := defaults()
 	cfg.processMarkers() // Build default icons and priorities from RawMarkers
 
@@ -179,32 +280,67 @@ func LoadWithVerbose(configPath string, verbose bool) (*Config, error) {
 	defaultDisplayLabels := cfg.DisplayLabels
 	defaultRawMarkers := cfg.RawMarkers
 
-	if configPath == "" {
-		configPath = defaultConfigPath()
-	}
-
-	if len(configPath) > 0 && configPath[0] == '~' {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return nil, err
-		}
-		configPath = filepath.Join(home, configPath[1:])
+	configPath, err := ResolvePath(configPath)
+	if err != nil {
+		return nil, err
 	}
 
-	data, err := os.ReadFile(configPath)
+	files, err := configFiles(configPath)
 	if err != nil {
-		// If file doesn't exist, use defaults (already processed)
-		if os.IsNotExist(err) {
-			return cfg, nil
-		}
 		return nil, err
 	}
+	// If there's no config file or fragment, use defaults (already processed)
+	if len(files) == 0 {
+		if profile != "" {
+			return nil, fmt.Errorf("unknown profile %q (%s doesn't exist)", profile, configPath)
+		}
+		return cfg, nil
+	}
 
 	// Reset fields before unmarshal so we can detect what YAML provides
 	cfg.Icons = nil
 	cfg.RawMarkers = nil
 
-	if err := yaml.Unmarshal(data, cfg); err != nil {
+	// Fragments in conf.d count as included by the config file, for cycle detection
+	mainPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		var chain []string
+		if file != configPath {
+			chain = []string{mainPath}
+		}
+		if err := cfg.loadFile(file, chain); err != nil {
+			return nil, err
+		}
+	}
+
+	if profile != "" {
+		if err := cfg.applyProfile(profile); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, project := range cfg.Projects {
+		if project.Path == "" {
+			return nil, fmt.Errorf("pinned project must have a 'path' field")
+		}
+	}
+
+	switch cfg.CacheMode {
+	case CacheModeBlocking, CacheModeStaleWhileRevalidate:
+	default:
+		return nil, fmt.Errorf("invalid cache_mode %q (must be %s or %s)", cfg.CacheMode, CacheModeBlocking, CacheModeStaleWhileRevalidate)
+	}
+
+	switch cfg.CacheFormat {
+	case CacheFormatJSON, CacheFormatGob:
+	default:
+		return nil, fmt.Errorf("invalid cache_format %q (must be %s or %s)", cfg.CacheFormat, CacheFormatJSON, CacheFormatGob)
+	}
+
+	if err := validateSources(cfg.Sources); err != nil {
 		return nil, err
 	}
 
@@ -218,6 +354,24 @@ func LoadWithVerbose(configPath string, verbose bool) (*Config, error) {
 	return cfg, nil
 }
 
+// ResolvePath returns the config file path to use, falling back to the default
+// location when configPath is empty and expanding a leading ~
+func ResolvePath(configPath string) (string, error) {
+	if configPath == "" {
+		configPath = defaultConfigPath()
+	}
+
+	if len(configPath) > 0 && configPath[0] == '~' {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configPath = filepath.Join(home, configPath[1:])
+	}
+
+	return configPath, nil
+}
+
 // IsPatternMarker returns true if the marker contains glob pattern characters
 func IsPatternMarker(marker string) bool {
 	return strings.ContainsAny(marker, "*?[]")
@@ -272,6 +426,26 @@ func (c *Config) processMarkers() {
 			c.DisplayLabels[mc.Marker] = mc.DisplayLabel
 		}
 	}
+	c.buildMarkerBehaviors()
+}
+
+// buildMarkerBehaviors builds the MarkerTypes, MarkerNested and StopMarkers maps from RawMarkers.
+// RawMarkers already has YAML entries merged over defaults, so no extra merging is needed.
+func (c *Config) buildMarkerBehaviors() {
+	c.MarkerTypes = make(map[string]string)
+	c.MarkerNested = make(map[string]bool)
+	c.StopMarkers = make(map[string]bool)
+	for _, mc := range c.RawMarkers {
+		if mc.Type != "" {
+			c.MarkerTypes[mc.Marker] = mc.Type
+		}
+		if mc.Nested != nil {
+			c.MarkerNested[mc.Marker] = *mc.Nested
+		}
+		if mc.Stop {
+			c.StopMarkers[mc.Marker] = true
+		}
+	}
 }
 
 // processMarkersWithDefaults builds Markers/Icons/Colors/Priorities/Labels/DisplayLabels, merging with defaults
@@ -394,6 +568,8 @@ func (c *Config) processMarkersWithDefaults(defaultIcons map[string]string, defa
 		finalDisplayLabels[k] = v
 	}
 	c.DisplayLabels = finalDisplayLabels
+
+	c.buildMarkerBehaviors()
 }
 
 // mergeMarkers combines default markers with YAML markers
@@ -505,6 +681,7 @@ func (c *Config) MergeFlags(cli interface{}) error {
 	if noNestedField := v.FieldByName("NoNested"); noNestedField.IsValid() && noNestedField.Kind() == reflect.Bool {
 		if noNestedField.Bool() {
 			c.Nested = false
+			c.MarkerNested = nil // --no-nested also overrides per-marker nested settings
 		}
 	}
 
@@ -548,6 +725,13 @@ func defaults() *Config {
 			{Marker: ".zed", Label: "zed", DisplayLabel: "Zed", Color: "blue", HasColor: true, Priority: 5, HasPriority: true},
 			{Marker: "tsconfig.json", Label: "typescript", DisplayLabel: "TypeScript", Icon: "\ue628", HasIcon: true, Color: "blue", HasColor: true, Priority: 10, HasPriority: true},
 			{Marker: "Dockerfile", Label: "docker", DisplayLabel: "Docker", Icon: "\ue7b0", HasIcon: true, Color: "cyan", HasColor: true, Priority: 7, HasPriority: true},
+			{Marker: ".jj", Label: "jj", DisplayLabel: "Jujutsu", Icon: "\U000f062c", HasIcon: true, Color: "bright-magenta", HasColor: true, Priority: 1, HasPriority: true},
+			{Marker: ".hg", Label: "hg", DisplayLabel: "Mercurial", Icon: "\U000f062c", HasIcon: true, Color: "bright-white", HasColor: true, Priority: 1, HasPriority: true},
+			// Fossil's checkout files; not ".fossil", which is the user's settings database in ~
+			{Marker: ".fslckout", Label: "fossil", DisplayLabel: "Fossil", Icon: "\U000f062c", HasIcon: true, Color: "bright-cyan", HasColor: true, Priority: 1, HasPriority: true},
+			{Marker: "_FOSSIL_", Label: "fossil", DisplayLabel: "Fossil", Icon: "\U000f062c", HasIcon: true, Color: "bright-cyan", HasColor: true, Priority: 1, HasPriority: true},
+			{Marker: ".pijul", Label: "pijul", DisplayLabel: "Pijul", Icon: "\U000f062c", HasIcon: true, Color: "bright-green", HasColor: true, Priority: 1, HasPriority: true},
+			{Marker: ".svn", Label: "svn", DisplayLabel: "Subversion", Icon: "\U000f062c", HasIcon: true, Color: "bright-blue", HasColor: true, Priority: 1, HasPriority: true},
 		},
 		MaxDepth: 3,
 		Excludes: []string{
@@ -555,11 +739,17 @@ func defaults() *Config {
 			".terraform",
 			"vendor",
 			".git",
+			".jj",
+			".hg",
+			".pijul",
+			".svn",
 			"target",
 			"dist",
 			"build",
 		},
 		CacheTTL:     300, // 5 minutes
+		CacheMode:    CacheModeBlocking,
+		CacheFormat:  CacheFormatJSON,
 		Nested:       true,
 		Icons:        make(map[string]string),
 		Colors:       make(map[string]string),
@@ -580,3 +770,30 @@ func defaultConfigPath() string {
 	}
 	return filepath.Join(configHome, "pj", "config.yaml")
 }
+
+// ExpandPath expands a leading ~ and environment variables ($VAR or ${VAR}) in a path.
+// Unset variables expand to the empty string, as in a shell.
+func ExpandPath(path string) string {
+	if len(path) > 0 && path[0] == '~' {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	return os.ExpandEnv(path)
+}
+
+// ExpandSearchPath expands ~ and environment variables in a search path, then expands
+// shell-style globs (*, ?, [...]) into one path per match. Paths without glob
+// characters are returned as-is (whether or not they exist); a glob with no matches
+// returns an empty slice.
+func ExpandSearchPath(path string) []string {
+	path = ExpandPath(path)
+	if !IsPatternMarker(path) {
+		return []string{path}
+	}
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return nil
+	}
+	return matches
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -52,6 +54,12 @@ func TestDefaults(t *testing.T) {
 		".zed",
 		"tsconfig.json",
 		"Dockerfile",
+		".jj",
+		".hg",
+		".fslckout",
+		"_FOSSIL_",
+		".pijul",
+		".svn",
 	}
 	if len(cfg.RawMarkers) != len(expectedMarkers) {
 		t.Errorf("RawMarkers length = %d, want %d", len(cfg.RawMarkers), len(expectedMarkers))
@@ -116,6 +124,12 @@ func TestDefaults(t *testing.T) {
 		".zed":            5,
 		"tsconfig.json":   10,
 		"Dockerfile":      7,
+		".jj":             1,
+		".hg":             1,
+		".fslckout":       1,
+		"_FOSSIL_":        1,
+		".pijul":          1,
+		".svn":            1,
 	}
 	for marker, expectedPriority := range expectedPriorities {
 		if cfg.Priorities[marker] != expectedPriority {
@@ -142,6 +156,12 @@ func TestDefaults(t *testing.T) {
 		".zed":            "zed",
 		"tsconfig.json":   "typescript",
 		"Dockerfile":      "docker",
+		".jj":             "jj",
+		".hg":             "hg",
+		".fslckout":       "fossil",
+		"_FOSSIL_":        "fossil",
+		".pijul":          "pijul",
+		".svn":            "svn",
 	}
 	for marker, expectedLabel := range expectedLabels {
 		if cfg.Labels[marker] != expectedLabel {
@@ -168,6 +188,12 @@ func TestDefaults(t *testing.T) {
 		".zed":            "Zed",
 		"tsconfig.json":   "TypeScript",
 		"Dockerfile":      "Docker",
+		".jj":             "Jujutsu",
+		".hg":             "Mercurial",
+		".fslckout":       "Fossil",
+		"_FOSSIL_":        "Fossil",
+		".pijul":          "Pijul",
+		".svn":            "Subversion",
 	}
 	for marker, expectedDisplayLabel := range expectedDisplayLabels {
 		if cfg.DisplayLabels[marker] != expectedDisplayLabel {
@@ -548,8 +574,8 @@ func TestMarkerConfigFormats(t *testing.T) {
 		}
 
 		// Check that markers merge with defaults (13 defaults, these 3 overlap)
-		if len(cfg.Markers) != 14 {
-			t.Errorf("Markers length = %d, want 14 (merged with defaults)", len(cfg.Markers))
+		if len(cfg.Markers) != 20 {
+			t.Errorf("Markers length = %d, want 20 (merged with defaults)", len(cfg.Markers))
 		}
 
 		// Check icons are populated from new format (overriding defaults)
@@ -587,8 +613,8 @@ icons:
 		}
 
 		// Check that markers merge with defaults
-		if len(cfg.Markers) != 14 {
-			t.Errorf("Markers length = %d, want 14 (merged with defaults)", len(cfg.Markers))
+		if len(cfg.Markers) != 20 {
+			t.Errorf("Markers length = %d, want 20 (merged with defaults)", len(cfg.Markers))
 		}
 
 		// Check icons from old format
@@ -652,8 +678,8 @@ icons:
 		}
 
 		// Check that markers merge with defaults
-		if len(cfg.Markers) != 14 {
-			t.Errorf("Markers length = %d, want 14 (merged with defaults)", len(cfg.Markers))
+		if len(cfg.Markers) != 20 {
+			t.Errorf("Markers length = %d, want 20 (merged with defaults)", len(cfg.Markers))
 		}
 
 		// go.mod should have the custom icon from config
@@ -679,6 +705,59 @@ icons:
 		}
 	})
 
+	t.Run("marker type", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "config.yaml")
+
+		yamlContent := `markers:
+  - marker: "*.xcodeproj"
+    type: dir
+  - marker: "*.code-workspace"
+    type: any
+  - marker: .project
+    type: file
+`
+		if err := os.WriteFile(configPath, []byte(yamlContent), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg, err := Load(configPath)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+
+		tests := map[string]string{
+			"*.xcodeproj":      MarkerTypeDir,
+			"*.code-workspace": MarkerTypeAny,
+			".project":         MarkerTypeFile,
+			"*.csproj":         MarkerTypeFile, // pattern default
+			"go.mod":           MarkerTypeAny,  // exact default
+		}
+		for marker, want := range tests {
+			if got := cfg.GetMarkerType(marker); got != want {
+				t.Errorf("GetMarkerType(%q) = %q, want %q", marker, got, want)
+			}
+		}
+	})
+
+	t.Run("invalid marker type", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "config.yaml")
+
+		yamlContent := `markers:
+  - marker: "*.xcodeproj"
+    type: folder
+`
+		if err := os.WriteFile(configPath, []byte(yamlContent), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := Load(configPath)
+		if err == nil || !strings.Contains(err.Error(), "invalid type") {
+			t.Errorf("Load() error = %v, want invalid type error", err)
+		}
+	})
+
 	t.Run("default icons preserved for markers not in config", func(t *testing.T) {
 		tmpDir := t.TempDir()
 		configPath := filepath.Join(tmpDir, "config.yaml")
@@ -1164,6 +1243,323 @@ func TestWorktreeConfigYAML(t *testing.T) {
 	}
 }
 
+func TestCacheMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", yaml: "max_depth: 3\n", want: CacheModeBlocking},
+		{name: "blocking", yaml: "cache_mode: blocking\n", want: CacheModeBlocking},
+		{name: "stale-while-revalidate", yaml: "cache_mode: stale-while-revalidate\n", want: CacheModeStaleWhileRevalidate},
+		{name: "invalid", yaml: "cache_mode: lazy\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "invalid cache_mode") {
+					t.Errorf("Load() error = %v, want invalid cache_mode error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.CacheMode != tt.want {
+				t.Errorf("CacheMode = %q, want %q", cfg.CacheMode, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", yaml: "max_depth: 3\n", want: CacheFormatJSON},
+		{name: "json", yaml: "cache_format: json\n", want: CacheFormatJSON},
+		{name: "gob", yaml: "cache_format: gob\n", want: CacheFormatGob},
+		{name: "invalid", yaml: "cache_format: xml\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "invalid cache_format") {
+					t.Errorf("Load() error = %v, want invalid cache_format error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.CacheFormat != tt.want {
+				t.Errorf("CacheFormat = %q, want %q", cfg.CacheFormat, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditorRecents(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []string
+	}{
+		{name: "default", yaml: "max_depth: 3\n", want: nil},
+		{name: "some", yaml: "editor_recents:\n  zed: true\n  vscode: true\n", want: []string{"vscode", "zed"}},
+		{name: "all", yaml: "editor_recents:\n  vscode: true\n  jetbrains: true\n  zed: true\n  neovim: true\n", want: []string{"vscode", "jetbrains", "zed", "neovim"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load(configPath)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got := cfg.EditorRecents.Enabled(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EditorRecents.Enabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{name: "valid", yaml: `sources:
+  - name: work
+    type: walk
+    paths: [~/work]
+  - name: infra
+    type: list
+    paths: [/srv/infra, /srv/tools]
+  - name: gh
+    type: command
+    command: gh repo list --json name
+    timeout: 60
+`},
+		{name: "missing name", yaml: "sources:\n  - type: walk\n    paths: [~/work]\n", wantErr: "source must have a 'name' field"},
+		{name: "duplicate name", yaml: "sources:\n  - {name: a, type: list, paths: [/a]}\n  - {name: a, type: list, paths: [/b]}\n", wantErr: `duplicate source name "a"`},
+		{name: "invalid type", yaml: "sources:\n  - {name: a, type: http}\n", wantErr: `source "a" has invalid type "http"`},
+		{name: "walk without paths", yaml: "sources:\n  - {name: a, type: walk}\n", wantErr: `source "a" must have a 'paths' field`},
+		{name: "command without command", yaml: "sources:\n  - {name: a, type: command}\n", wantErr: `source "a" must have a 'command' field`},
+		{name: "negative timeout", yaml: "sources:\n  - {name: a, type: command, command: ls, timeout: -1}\n", wantErr: "negative timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if len(cfg.Sources) != 3 || cfg.Sources[2].Timeout != 60 || len(cfg.Sources[1].Paths) != 2 {
+				t.Errorf("Sources = %+v", cfg.Sources)
+			}
+		})
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	yamlConfig := `search_paths: [~/personal]
+excludes: [node_modules]
+max_depth: 4
+markers:
+  - marker: go.mod
+    icon: G
+profiles:
+  work:
+    search_paths: [~/work, ~/oss]
+    excludes: [node_modules, vendor]
+    markers:
+      - marker: BUILD.bazel
+        icon: B
+      - marker: go.mod
+        color: cyan
+  empty:
+  nested:
+    profiles:
+      inner: {}
+  invalid: [a, b]
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(yamlConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := LoadProfile(configPath, "", false)
+	if err != nil {
+		t.Fatalf("LoadProfile() error = %v", err)
+	}
+	if base.Profile != "" || !reflect.DeepEqual(base.SearchPaths, []string{"~/personal"}) {
+		t.Errorf("base config = profile %q, search paths %v", base.Profile, base.SearchPaths)
+	}
+
+	work, err := LoadProfile(configPath, "work", false)
+	if err != nil {
+		t.Fatalf("LoadProfile(work) error = %v", err)
+	}
+	if work.Profile != "work" {
+		t.Errorf("Profile = %q, want work", work.Profile)
+	}
+	if !reflect.DeepEqual(work.SearchPaths, []string{"~/work", "~/oss"}) {
+		t.Errorf("SearchPaths = %v, want the profile's", work.SearchPaths)
+	}
+	if !reflect.DeepEqual(work.Excludes, []string{"node_modules", "vendor"}) {
+		t.Errorf("Excludes = %v, want the profile's", work.Excludes)
+	}
+	if work.MaxDepth != 4 {
+		t.Errorf("MaxDepth = %d, want the base config's 4", work.MaxDepth)
+	}
+	// Markers are merged by name: the profile adds BUILD.bazel and its go.mod entry
+	// replaces the base one, so go.mod's icon is back to the default
+	if work.Icons["BUILD.bazel"] != "B" || work.Colors["go.mod"] != "cyan" {
+		t.Errorf("profile markers not applied: icons %v, colors %v", work.Icons, work.Colors)
+	}
+	if base.Icons["go.mod"] != "G" || work.Icons["go.mod"] == "G" {
+		t.Errorf("go.mod icon = %q in base, %q in work; want G only in base", base.Icons["go.mod"], work.Icons["go.mod"])
+	}
+
+	empty, err := LoadProfile(configPath, "empty", false)
+	if err != nil {
+		t.Fatalf("LoadProfile(empty) error = %v", err)
+	}
+	if empty.Profile != "empty" || !reflect.DeepEqual(empty.SearchPaths, base.SearchPaths) {
+		t.Errorf("empty profile = %q, %v; want the base config", empty.Profile, empty.SearchPaths)
+	}
+
+	for profile, wantErr := range map[string]string{
+		"missing": `unknown profile "missing" (defined: empty, invalid, nested, work)`,
+		"nested":  `profile "nested" can't define profiles`,
+		"invalid": `profile "invalid" must be a mapping`,
+	} {
+		if _, err := LoadProfile(configPath, profile, false); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("LoadProfile(%s) error = %v, want %q", profile, err, wantErr)
+		}
+	}
+
+	if _, err := LoadProfile(filepath.Join(t.TempDir(), "none.yaml"), "work", false); err == nil || !strings.Contains(err.Error(), "unknown profile") {
+		t.Errorf("LoadProfile() without a config file error = %v, want unknown profile", err)
+	}
+}
+
+func TestMarkerNestedPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	yamlContent := `nested: true
+markers:
+  - marker: .git
+    nested: false
+  - marker: go.mod
+    nested: true
+  - marker: .idea
+    stop: true
+`
+	if err := os.WriteFile(configPath, []byte(yamlContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.ShouldDescend(".git") {
+		t.Error("ShouldDescend(.git) should be false when marker sets nested: false")
+	}
+	if !cfg.ShouldDescend("go.mod") {
+		t.Error("ShouldDescend(go.mod) should be true")
+	}
+	if !cfg.ShouldDescend("package.json") {
+		t.Error("ShouldDescend(package.json) should fall back to global nested: true")
+	}
+	if !cfg.StopMarkers[".idea"] || cfg.StopMarkers[".git"] {
+		t.Errorf("StopMarkers = %v, want only .idea", cfg.StopMarkers)
+	}
+
+	type cliFlags struct {
+		NoNested bool
+	}
+	if err := cfg.MergeFlags(&cliFlags{NoNested: true}); err != nil {
+		t.Fatalf("MergeFlags() error = %v", err)
+	}
+	if cfg.ShouldDescend("go.mod") {
+		t.Error("--no-nested should override per-marker nested: true")
+	}
+}
+
+func TestExpandSearchPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("USERPROFILE", tmpDir)
+	t.Setenv("PJ_TEST_SRC", filepath.Join(tmpDir, "src"))
+
+	for _, dir := range []string{"src/one", "src/two", "other"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected []string
+	}{
+		{"tilde", "~/other", []string{filepath.Join(tmpDir, "other")}},
+		{"env var", "$PJ_TEST_SRC/one", []string{filepath.Join(tmpDir, "src", "one")}},
+		{"braced env var", "${PJ_TEST_SRC}/two", []string{filepath.Join(tmpDir, "src", "two")}},
+		{"glob", "~/src/*", []string{filepath.Join(tmpDir, "src", "one"), filepath.Join(tmpDir, "src", "two")}},
+		{"unmatched glob", "~/nope-*", nil},
+		{"non-existent plain path", "~/missing", []string{filepath.Join(tmpDir, "missing")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExpandSearchPath(tt.path)
+			if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("ExpandSearchPath(%q) = %v, want %v", tt.path, got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestMergeFlagsWorktrees(t *testing.T) {
 	t.Run("Worktrees flag", func(t *testing.T) {
 		cfg := &Config{Worktrees: false}
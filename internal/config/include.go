@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// confDirName is the directory next to the config file whose *.yaml fragments are
+// loaded after it
+const confDirName = "conf.d"
+
+// configFiles returns the config file, if it exists, followed by the fragments in
+// the conf.d directory next to it in lexical order
+func configFiles(configPath string) ([]string, error) {
+	var files []string
+	if _, err := os.Stat(configPath); err == nil {
+		files = append(files, configPath)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Glob only fails on malformed patterns, and returns matches sorted
+	fragments, _ := filepath.Glob(filepath.Join(filepath.Dir(configPath), confDirName, "*.yaml"))
+	return append(files, fragments...), nil
+}
+
+// loadFile decodes a config file over c, after the files its include list names.
+// Relative includes are resolved against the including file's directory. chain
+// holds the files that led to this one, to detect include cycles.
+func (c *Config) loadFile(path string, chain []string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for _, parent := range chain {
+		if parent == path {
+			return fmt.Errorf("include cycle: %s", strings.Join(append(chain, path), " -> "))
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil // Empty file
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: config must be a mapping of settings", path)
+	}
+
+	var header struct {
+		Include []string `yaml:"include"`
+	}
+	if err := root.Decode(&header); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	next := append(chain[:len(chain):len(chain)], path)
+	for _, include := range header.Include {
+		includePath := ExpandPath(include)
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(filepath.Dir(path), includePath)
+		}
+		if _, err := os.Stat(includePath); err != nil {
+			return fmt.Errorf("%s: include %s: %w", path, include, err)
+		}
+		if err := c.loadFile(includePath, next); err != nil {
+			return err
+		}
+	}
+
+	// Pinned projects add up across files, so a fragment's pins don't hide the
+	// ones pj pin writes to the config file
+	projects := c.Projects
+	c.Projects = nil
+	if err := c.overlay(root); err != nil {
+		c.Projects = projects
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	c.Projects = mergeProjects(projects, c.Projects)
+	return nil
+}
+
+// mergeProjects adds pinned projects to base; an entry for a directory base
+// already pins replaces base's
+func mergeProjects(base, projects []PinnedProject) []PinnedProject {
+	merged := append([]PinnedProject(nil), base...)
+	for _, project := range projects {
+		replaced := false
+		for i := range merged {
+			if samePath(merged[i].Path, project.Path) {
+				merged[i] = project
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, project)
+		}
+	}
+	return merged
+}
+
+// pinningFragment returns the conf.d fragment that pins path, or "" if none does.
+// Fragments load after the config file, so a fragment's pin wins over the config
+// file's for the same directory.
+func pinningFragment(configPath, path string) (string, error) {
+	files, err := configFiles(configPath)
+	if err != nil {
+		return "", err
+	}
+	mainPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if file == configPath {
+			continue
+		}
+		var fragment Config
+		if err := fragment.loadFile(file, []string{mainPath}); err != nil {
+			return "", err
+		}
+		for _, project := range fragment.Projects {
+			if samePath(project.Path, path) {
+				return file, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// overlay decodes a mapping of settings over c. Each setting replaces c's, except
+// markers, which are merged by name the way config markers are merged over the
+// defaults: new markers are added and an entry for an existing one replaces it.
+func (c *Config) overlay(node *yaml.Node) error {
+	base := c.RawMarkers
+	c.RawMarkers = nil
+	if err := node.Decode(c); err != nil {
+		c.RawMarkers = base
+		return err
+	}
+	if c.RawMarkers != nil {
+		c.RawMarkers = mergeMarkers(base, c.RawMarkers)
+	} else {
+		c.RawMarkers = base
+	}
+	return nil
+}
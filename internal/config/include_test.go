@@ -0,0 +1,205 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes each file's content under dir, creating parent directories
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	dir := t.TempDir()
+	shared := t.TempDir()
+	writeFiles(t, shared, map[string]string{
+		"team.yaml": `include: [icons.yaml]
+excludes: [node_modules, bazel-out]
+max_depth: 5
+markers:
+  - marker: BUILD.bazel
+    icon: B
+    priority: 8
+  - marker: go.mod
+    icon: T
+`,
+		"icons.yaml": `markers:
+  - marker: WORKSPACE
+    icon: W
+`,
+	})
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `include: [` + filepath.Join(shared, "team.yaml") + `]
+search_paths: [~/src]
+markers:
+  - marker: go.mod
+    icon: G
+`,
+		"conf.d/10-depth.yaml": "max_depth: 7\n",
+		"conf.d/20-depth.yaml": "max_depth: 9\nprofiles:\n  deep:\n    max_depth: 20\n",
+		"conf.d/notes.txt":     "not: [yaml",
+	})
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(cfg.SearchPaths, []string{"~/src"}) {
+		t.Errorf("SearchPaths = %v, want the config file's", cfg.SearchPaths)
+	}
+	if !reflect.DeepEqual(cfg.Excludes, []string{"node_modules", "bazel-out"}) {
+		t.Errorf("Excludes = %v, want the included file's", cfg.Excludes)
+	}
+	if cfg.MaxDepth != 9 {
+		t.Errorf("MaxDepth = %d, want 9 from the last conf.d fragment", cfg.MaxDepth)
+	}
+	// Markers from every file are merged by name; the config file's go.mod wins
+	if cfg.Icons["WORKSPACE"] != "W" || cfg.Icons["BUILD.bazel"] != "B" || cfg.Icons["go.mod"] != "G" {
+		t.Errorf("Icons = %v, want WORKSPACE, BUILD.bazel and go.mod from their files", cfg.Icons)
+	}
+	if cfg.GetPriorities()["BUILD.bazel"] != 8 {
+		t.Errorf("BUILD.bazel priority = %d, want 8", cfg.GetPriorities()["BUILD.bazel"])
+	}
+
+	deep, err := LoadProfile(filepath.Join(dir, "config.yaml"), "deep", false)
+	if err != nil {
+		t.Fatalf("LoadProfile(deep) error = %v", err)
+	}
+	if deep.MaxDepth != 20 {
+		t.Errorf("MaxDepth = %d, want 20 from the profile defined in conf.d", deep.MaxDepth)
+	}
+}
+
+func TestIncludesWithoutConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"conf.d/paths.yaml": "search_paths: [/srv]\n"})
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(cfg.SearchPaths, []string{"/srv"}) {
+		t.Errorf("SearchPaths = %v, want the fragment's", cfg.SearchPaths)
+	}
+	if len(cfg.Markers) != len(defaults().RawMarkers) {
+		t.Errorf("Markers = %v, want the defaults", cfg.Markers)
+	}
+}
+
+func TestIncludesMergeProjects(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"team.yaml":            "projects:\n  - path: /srv/shared\n    name: team\n",
+		"config.yaml":          "include: [team.yaml]\nprojects:\n  - path: /srv/mine\n  - path: /srv/shared\n    name: mine\n",
+		"conf.d/10-work.yaml":  "projects:\n  - path: /srv/work\n",
+		"conf.d/20-empty.yaml": "projects: []\n",
+	})
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := []PinnedProject{{Path: "/srv/shared", Name: "mine"}, {Path: "/srv/mine"}, {Path: "/srv/work"}}
+	if !reflect.DeepEqual(cfg.Projects, want) {
+		t.Errorf("Projects = %+v, want %+v", cfg.Projects, want)
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		// Substrings of the error; {dir} is replaced with the config directory
+		want []string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml]\n",
+				"a.yaml":      "include: [sub/b.yaml]\n",
+				"sub/b.yaml":  "include: [../a.yaml]\n",
+			},
+			want: []string{"include cycle: {dir}/config.yaml -> {dir}/a.yaml -> {dir}/sub/b.yaml -> {dir}/a.yaml"},
+		},
+		{
+			name: "self include",
+			files: map[string]string{
+				"config.yaml": "include: [config.yaml]\n",
+			},
+			want: []string{"include cycle: {dir}/config.yaml -> {dir}/config.yaml"},
+		},
+		{
+			name: "fragment including the config file",
+			files: map[string]string{
+				"config.yaml":       "max_depth: 3\n",
+				"conf.d/local.yaml": "include: [../config.yaml]\n",
+			},
+			want: []string{"include cycle: {dir}/config.yaml -> {dir}/conf.d/local.yaml -> {dir}/config.yaml"},
+		},
+		{
+			name: "missing include",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml]\n",
+				"a.yaml":      "include: [team.yaml]\n",
+			},
+			want: []string{"{dir}/a.yaml: include team.yaml:"},
+		},
+		{
+			name: "invalid yaml",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml]\n",
+				"a.yaml":      "max_depth: [3\n",
+			},
+			want: []string{"{dir}/a.yaml: yaml:"},
+		},
+		{
+			name: "invalid marker",
+			files: map[string]string{
+				"config.yaml":      "max_depth: 3\n",
+				"conf.d/team.yaml": "markers:\n  - marker: go.mod\n    type: folder\n",
+			},
+			want: []string{"{dir}/conf.d/team.yaml:", `invalid type "folder"`},
+		},
+		{
+			name: "not a mapping",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml]\n",
+				"a.yaml":      "- go.mod\n",
+			},
+			want: []string{"{dir}/a.yaml: config must be a mapping"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			_, err := Load(filepath.Join(dir, "config.yaml"))
+			if err == nil {
+				t.Fatal("Load() should fail")
+			}
+			for _, want := range tt.want {
+				want = strings.ReplaceAll(want, "{dir}/", dir+string(filepath.Separator))
+				want = strings.ReplaceAll(want, "/", string(filepath.Separator))
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load() error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/josephschmitt/pj/internal/fsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// PinnedProject is a directory that always appears in results, whether or not it
+// lives under a search path or contains a marker
+type PinnedProject struct {
+	Path   string   `yaml:"path"`
+	Name   string   `yaml:"name,omitempty"`
+	Marker string   `yaml:"marker,omitempty"`
+	Label  string   `yaml:"label,omitempty"`
+	Icon   string   `yaml:"icon,omitempty"`
+	Tags   []string `yaml:"tags,omitempty"`
+}
+
+// Pin adds a pinned project to the config file at configPath, replacing any entry
+// for the same path. The file is created if it doesn't exist; comments and
+// formatting outside the projects section are preserved. It's an error if a conf.d
+// fragment pins the same directory, since the fragment's entry would win.
+func Pin(configPath string, project PinnedProject) error {
+	if err := checkFragmentPin(configPath, project.Path); err != nil {
+		return err
+	}
+	data, doc, err := readConfigNode(configPath)
+	if err != nil {
+		return err
+	}
+
+	var item yaml.Node
+	if err := item.Encode(project); err != nil {
+		return err
+	}
+
+	projects := mappingValue(doc.Content[0], "projects")
+	switch {
+	case projects == nil:
+		projects = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		doc.Content[0].Content = append(doc.Content[0].Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "projects"},
+			projects,
+		)
+	case projects.Kind == yaml.ScalarNode && projects.Tag == "!!null":
+		// "projects:" without a value; keep the node so its comments stay put
+		projects.Kind = yaml.SequenceNode
+		projects.Tag = "!!seq"
+		projects.Value = ""
+		projects.Style = 0
+	case projects.Kind != yaml.SequenceNode:
+		return fmt.Errorf("%s: projects must be a list", configPath)
+	}
+
+	replaced := false
+	for i, existing := range projects.Content {
+		if samePath(pinnedNodePath(existing), project.Path) {
+			projects.Content[i] = &item
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		projects.Content = append(projects.Content, &item)
+	}
+
+	return writeConfigNode(configPath, data, doc)
+}
+
+// Unpin removes the pinned project for path from the config file at configPath,
+// and the projects key along with the last one. It returns false if no pinned
+// project matched. It's an error if a conf.d fragment pins path.
+func Unpin(configPath, path string) (bool, error) {
+	if err := checkFragmentPin(configPath, path); err != nil {
+		return false, err
+	}
+	data, doc, err := readConfigNode(configPath)
+	if err != nil {
+		return false, err
+	}
+
+	projects := mappingValue(doc.Content[0], "projects")
+	if projects == nil || projects.Kind != yaml.SequenceNode {
+		return false, nil
+	}
+
+	for i, existing := range projects.Content {
+		if samePath(pinnedNodePath(existing), path) {
+			projects.Content = append(projects.Content[:i], projects.Content[i+1:]...)
+			if len(projects.Content) == 0 {
+				root := doc.Content[0]
+				key := mappingKey(root, "projects")
+				root.Content = append(root.Content[:key], root.Content[key+2:]...)
+			}
+			return true, writeConfigNode(configPath, data, doc)
+		}
+	}
+
+	return false, nil
+}
+
+// checkFragmentPin returns an error naming the conf.d fragment that pins path, as
+// the config file's pins can't change it
+func checkFragmentPin(configPath, path string) error {
+	fragment, err := pinningFragment(configPath, path)
+	if err != nil {
+		return err
+	}
+	if fragment != "" {
+		return fmt.Errorf("%s is pinned in %s, which overrides %s; edit it there", path, fragment, configPath)
+	}
+	return nil
+}
+
+// readConfigNode reads the config file and parses it into a YAML document node,
+// returning an empty mapping document if the file doesn't exist or is empty
+func readConfigNode(configPath string) ([]byte, *yaml.Node, error) {
+	empty := &yaml.Node{
+		Kind:    yaml.DocumentNode,
+		Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+	}
+
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil, empty, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", configPath, err)
+	}
+	if len(doc.Content) == 0 {
+		return data, empty, nil
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("%s: config must be a mapping", configPath)
+	}
+	return data, &doc, nil
+}
+
+// writeConfigNode writes a YAML document node back to the config file, whose
+// current contents are data. Only the lines of the projects section are replaced,
+// since re-encoding the whole document would drop blank lines and reflow comments;
+// if the edited file wouldn't read back as doc, the whole document is written.
+func writeConfigNode(configPath string, data []byte, doc *yaml.Node) error {
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return err
+	}
+
+	out, ok := spliceProjects(data, doc)
+	if !ok {
+		var err error
+		if out, err = encodeNode(doc); err != nil {
+			return err
+		}
+	}
+	return fsutil.WriteFileAtomic(configPath, out)
+}
+
+// spliceProjects replaces the lines of the projects section in data with doc's
+// projects section, appending it if data has none and dropping it if doc has none.
+// It returns false if the result doesn't decode to the same settings as doc.
+func spliceProjects(data []byte, doc *yaml.Node) ([]byte, bool) {
+	var orig yaml.Node
+	if err := yaml.Unmarshal(data, &orig); err != nil || len(orig.Content) == 0 {
+		return nil, false
+	}
+	if root := orig.Content[0]; root.Kind != yaml.MappingNode || root.Style&yaml.FlowStyle != 0 {
+		return nil, false
+	}
+
+	var section []byte
+	if i := mappingKey(doc.Content[0], "projects"); i >= 0 {
+		// The key's head comment stays in place above the replaced lines
+		key := *doc.Content[0].Content[i]
+		key.HeadComment = ""
+		var err error
+		section, err = encodeNode(&yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{&key, doc.Content[0].Content[i+1]}})
+		if err != nil {
+			return nil, false
+		}
+	}
+
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	var out []byte
+	if i := mappingKey(orig.Content[0], "projects"); i >= 0 {
+		start := orig.Content[0].Content[i].Line - 1
+		end := sectionEnd(lines, lastLine(orig.Content[0].Content[i+1]))
+		if section == nil {
+			// Don't leave the blank lines around a dropped section doubled up
+			for start > 0 && end < len(lines) && len(bytes.TrimSpace(lines[start-1])) == 0 && len(bytes.TrimSpace(lines[end])) == 0 {
+				end++
+			}
+		}
+		out = append(out, bytes.Join(lines[:start], nil)...)
+		out = append(out, section...)
+		out = append(out, bytes.Join(lines[end:], nil)...)
+	} else {
+		out = append(out, data...)
+		if len(out) > 0 && out[len(out)-1] != '\n' {
+			out = append(out, '\n')
+		}
+		out = append(out, section...)
+	}
+
+	// A file left with only comments decodes to nil rather than an empty mapping
+	got, want := map[string]any{}, map[string]any{}
+	if yaml.Unmarshal(out, &got) != nil || doc.Decode(&want) != nil || !reflect.DeepEqual(got, want) {
+		return nil, false
+	}
+	return out, true
+}
+
+// sectionEnd returns the index of the first line after a top-level section whose
+// last node is on line last (1-based). Indented comments that follow belong to the
+// section; blank lines at its end don't.
+func sectionEnd(lines [][]byte, last int) int {
+	end := last
+	for end < len(lines) {
+		trimmed := bytes.TrimSpace(lines[end])
+		indented := len(lines[end]) > 0 && (lines[end][0] == ' ' || lines[end][0] == '\t')
+		if len(trimmed) != 0 && !(indented && trimmed[0] == '#') {
+			break
+		}
+		end++
+	}
+	for end > last && len(bytes.TrimSpace(lines[end-1])) == 0 {
+		end--
+	}
+	return end
+}
+
+// lastLine returns the last line any node of a YAML subtree starts on
+func lastLine(node *yaml.Node) int {
+	last := node.Line
+	for _, child := range node.Content {
+		last = max(last, lastLine(child))
+	}
+	return last
+}
+
+// encodeNode encodes a YAML node the way pj writes its config
+func encodeNode(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mappingKey returns the index of key's key node in a mapping node, or -1
+func mappingKey(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// mappingValue returns the value node for key in a mapping node, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if i := mappingKey(mapping, key); i >= 0 {
+		return mapping.Content[i+1]
+	}
+	return nil
+}
+
+// pinnedNodePath returns the path of a pinned project node
+func pinnedNodePath(node *yaml.Node) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+	if value := mappingValue(node, "path"); value != nil {
+		return value.Value
+	}
+	return ""
+}
+
+// samePath reports whether two paths refer to the same location after expanding ~
+// and environment variables
+func samePath(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return filepath.Clean(ExpandPath(a)) == filepath.Clean(ExpandPath(b))
+}
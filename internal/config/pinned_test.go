@@ -0,0 +1,282 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPin(t *testing.T) {
+	t.Run("creates config file when missing", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "pj", "config.yaml")
+
+		if err := Pin(configPath, PinnedProject{Path: "/srv/infra", Name: "infra", Tags: []string{"ops"}}); err != nil {
+			t.Fatalf("Pin() error = %v", err)
+		}
+
+		cfg, err := Load(configPath)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if len(cfg.Projects) != 1 {
+			t.Fatalf("Projects length = %d, want 1", len(cfg.Projects))
+		}
+		p := cfg.Projects[0]
+		if p.Path != "/srv/infra" || p.Name != "infra" || len(p.Tags) != 1 || p.Tags[0] != "ops" {
+			t.Errorf("Projects[0] = %+v, want path /srv/infra, name infra, tags [ops]", p)
+		}
+	})
+
+	t.Run("preserves existing config and comments", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		yamlContent := `# My search paths
+search_paths:
+  - ~/code
+max_depth: 4
+`
+		if err := os.WriteFile(configPath, []byte(yamlContent), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Pin(configPath, PinnedProject{Path: "~/dotfiles", Marker: ".git"}); err != nil {
+			t.Fatalf("Pin() error = %v", err)
+		}
+
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "# My search paths") {
+			t.Errorf("Pin() should preserve comments, got:\n%s", data)
+		}
+
+		cfg, err := Load(configPath)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if cfg.MaxDepth != 4 || len(cfg.SearchPaths) != 1 {
+			t.Errorf("Pin() should preserve existing settings, got max_depth %d, search_paths %v", cfg.MaxDepth, cfg.SearchPaths)
+		}
+		if len(cfg.Projects) != 1 || cfg.Projects[0].Marker != ".git" {
+			t.Errorf("Projects = %+v, want one project with marker .git", cfg.Projects)
+		}
+	})
+
+	t.Run("replaces existing pin for same path", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+
+		if err := Pin(configPath, PinnedProject{Path: "/srv/infra", Name: "old"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := Pin(configPath, PinnedProject{Path: "/srv/infra/", Name: "new"}); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg, err := Load(configPath)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if len(cfg.Projects) != 1 || cfg.Projects[0].Name != "new" {
+			t.Errorf("Projects = %+v, want a single project named new", cfg.Projects)
+		}
+	})
+
+	t.Run("projects key without a value", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(configPath, []byte("max_depth: 4\nprojects: # Pinned below\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Pin(configPath, PinnedProject{Path: "/srv/infra"}); err != nil {
+			t.Fatalf("Pin() error = %v", err)
+		}
+
+		cfg, err := Load(configPath)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if len(cfg.Projects) != 1 || cfg.Projects[0].Path != "/srv/infra" {
+			t.Errorf("Projects = %+v, want the pinned project", cfg.Projects)
+		}
+	})
+
+	t.Run("rewrites only the projects section", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		before := `# Where my code lives
+
+search_paths:
+    - ~/code    # Work
+    - ~/oss
+
+`
+		after := `
+# Tuning
+max_depth:   4
+`
+		content := before + "# Pins\nprojects:\n  # Dotfiles\n  - path: ~/dotfiles\n    tags: [config]\n  # Kept with the list\n" + after
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Pin(configPath, PinnedProject{Path: "/srv/infra"}); err != nil {
+			t.Fatalf("Pin() error = %v", err)
+		}
+
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(data)
+		if !strings.HasPrefix(got, before+"# Pins\nprojects:\n") || !strings.HasSuffix(got, after) {
+			t.Errorf("Pin() changed the file outside the projects section:\n%s", got)
+		}
+		for _, want := range []string{"# Dotfiles", "# Kept with the list", "- path: /srv/infra"} {
+			if strings.Count(got, want) != 1 {
+				t.Errorf("Pin() output has %d of %q, want 1:\n%s", strings.Count(got, want), want, got)
+			}
+		}
+
+		cfg, err := Load(configPath)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if len(cfg.Projects) != 2 || cfg.MaxDepth != 4 || len(cfg.SearchPaths) != 2 {
+			t.Errorf("Load() = %+v, want both pins and the other settings", cfg)
+		}
+	})
+
+	t.Run("flow style config", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(configPath, []byte("{max_depth: 4, projects: [{path: /srv/a}]}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Pin(configPath, PinnedProject{Path: "/srv/b"}); err != nil {
+			t.Fatalf("Pin() error = %v", err)
+		}
+
+		cfg, err := Load(configPath)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if len(cfg.Projects) != 2 || cfg.MaxDepth != 4 {
+			t.Errorf("Load() = %+v, want both pins and max_depth 4", cfg)
+		}
+	})
+
+	t.Run("projects that isn't a list", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		content := "projects: /srv/infra\n"
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		err := Pin(configPath, PinnedProject{Path: "/srv/infra"})
+		if err == nil || !strings.Contains(err.Error(), "projects must be a list") {
+			t.Errorf("Pin() error = %v, want projects must be a list", err)
+		}
+		if data, _ := os.ReadFile(configPath); string(data) != content {
+			t.Errorf("Pin() changed the config file to:\n%s", data)
+		}
+	})
+}
+
+func TestUnpin(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+
+	for _, path := range []string{"/srv/a", "/srv/b"} {
+		if err := Pin(configPath, PinnedProject{Path: path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := Unpin(configPath, "/srv/a")
+	if err != nil {
+		t.Fatalf("Unpin() error = %v", err)
+	}
+	if !removed {
+		t.Error("Unpin() should report the project was removed")
+	}
+
+	removed, err = Unpin(configPath, "/srv/missing")
+	if err != nil {
+		t.Fatalf("Unpin() error = %v", err)
+	}
+	if removed {
+		t.Error("Unpin() should report false for a path that isn't pinned")
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Projects) != 1 || cfg.Projects[0].Path != "/srv/b" {
+		t.Errorf("Projects = %+v, want only /srv/b", cfg.Projects)
+	}
+}
+
+func TestLoadPinnedProjectWithoutPath(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	yamlContent := `projects:
+  - name: no-path
+`
+	if err := os.WriteFile(configPath, []byte(yamlContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(configPath); err == nil {
+		t.Error("Load() should return error for pinned project without 'path' field")
+	}
+}
+
+func TestUnpinLast(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := "max_depth: 4\n\nprojects:\n  - path: /srv/a\n\ncache_ttl: 60\n"
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := Unpin(configPath, "/srv/a")
+	if err != nil || !removed {
+		t.Fatalf("Unpin() = %v, %v, want true", removed, err)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "max_depth: 4\n\ncache_ttl: 60\n"; string(data) != want {
+		t.Errorf("Unpin() left:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestPinWithConfD(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	fragment := filepath.Join(dir, "conf.d", "10-work.yaml")
+	writeFiles(t, dir, map[string]string{"conf.d/10-work.yaml": "projects:\n  - path: /srv/work\n"})
+
+	// Pins in the config file add to the fragment's
+	if err := Pin(configPath, PinnedProject{Path: "/srv/mine"}); err != nil {
+		t.Fatalf("Pin() error = %v", err)
+	}
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Projects) != 2 {
+		t.Errorf("Projects = %+v, want the config file's and the fragment's pins", cfg.Projects)
+	}
+
+	// A fragment's pin can't be changed from the config file
+	if err := Pin(configPath, PinnedProject{Path: "/srv/work", Name: "work"}); err == nil || !strings.Contains(err.Error(), fragment) {
+		t.Errorf("Pin() error = %v, want one naming %s", err, fragment)
+	}
+	if removed, err := Unpin(configPath, "/srv/work/"); removed || err == nil || !strings.Contains(err.Error(), fragment) {
+		t.Errorf("Unpin() = %v, %v, want an error naming %s", removed, err, fragment)
+	}
+	if data, _ := os.ReadFile(configPath); strings.Contains(string(data), "/srv/work") {
+		t.Errorf("config file pins the fragment's project:\n%s", data)
+	}
+}
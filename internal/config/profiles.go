@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// applyProfile overlays the named profile on the config (see overlay)
+func (c *Config) applyProfile(name string) error {
+	node, ok := c.Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q (%s)", name, describeProfiles(c.Profiles))
+	}
+
+	// An empty profile ("work:" with no settings) is the base config
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i < len(node.Content); i += 2 {
+			if node.Content[i].Value == "profiles" {
+				return fmt.Errorf("profile %q can't define profiles", name)
+			}
+		}
+
+		if err := c.overlay(&node); err != nil {
+			return fmt.Errorf("profile %q: %w", name, err)
+		}
+	} else if node.Tag != "!!null" {
+		return fmt.Errorf("profile %q must be a mapping of settings", name)
+	}
+
+	c.Profile = name
+	return nil
+}
+
+// describeProfiles lists the defined profile names for error messages
+func describeProfiles(profiles map[string]yaml.Node) string {
+	if len(profiles) == 0 {
+		return "no profiles are defined"
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "defined: " + strings.Join(names, ", ")
+}
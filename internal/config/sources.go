@@ -0,0 +1,52 @@
+package config
+
+import "fmt"
+
+// Source types select where a configured source's projects come from
+const (
+	SourceWalk    = "walk"    // Walk paths for markers, like search_paths
+	SourceList    = "list"    // Use the listed directories as projects
+	SourceCommand = "command" // Run a command that prints project paths or JSON
+)
+
+// SourceConfig is an extra place projects come from. Projects only a source
+// found are tagged with its name.
+type SourceConfig struct {
+	Name    string   `yaml:"name"`
+	Type    string   `yaml:"type"`
+	Paths   []string `yaml:"paths,omitempty"`   // walk and list: supports ~, environment variables and globs
+	Command string   `yaml:"command,omitempty"` // command: run by the shell (sh -c, or cmd /C on Windows)
+	Timeout int      `yaml:"timeout,omitempty"` // command: seconds before it's killed (default 30)
+}
+
+// validateSources checks that every source has a unique name, a known type and
+// the fields its type needs
+func validateSources(sources []SourceConfig) error {
+	names := make(map[string]bool, len(sources))
+	for _, s := range sources {
+		if s.Name == "" {
+			return fmt.Errorf("source must have a 'name' field")
+		}
+		if names[s.Name] {
+			return fmt.Errorf("duplicate source name %q", s.Name)
+		}
+		names[s.Name] = true
+
+		switch s.Type {
+		case SourceWalk, SourceList:
+			if len(s.Paths) == 0 {
+				return fmt.Errorf("source %q must have a 'paths' field", s.Name)
+			}
+		case SourceCommand:
+			if s.Command == "" {
+				return fmt.Errorf("source %q must have a 'command' field", s.Name)
+			}
+		default:
+			return fmt.Errorf("source %q has invalid type %q (must be %s, %s, or %s)", s.Name, s.Type, SourceWalk, SourceList, SourceCommand)
+		}
+		if s.Timeout < 0 {
+			return fmt.Errorf("source %q has negative timeout %d", s.Name, s.Timeout)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package daemon
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/josephschmitt/pj/internal/discover"
+)
+
+// ErrNotRunning is returned by Query when no daemon is listening
+var ErrNotRunning = errors.New("daemon not running")
+
+// Query asks the daemon listening on socketPath for its index. It fails quickly
+// when no daemon is running, or when the daemon's version or settings don't match
+// fingerprint, so callers can fall back to the cache.
+func Query(socketPath, fingerprint string) ([]discover.Project, error) {
+	conn, err := net.DialTimeout("unix", socketPath, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotRunning, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(queryTimeout))
+
+	if err := gob.NewEncoder(conn).Encode(request{Fingerprint: fingerprint}); err != nil {
+		return nil, err
+	}
+	var resp response
+	if err := gob.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	if resp.Projects == nil {
+		// gob doesn't distinguish empty from nil; an empty index is still an answer
+		resp.Projects = []discover.Project{}
+	}
+	return resp.Projects, nil
+}
@@ -0,0 +1,296 @@
+// Package daemon keeps the project index in memory, updates it as the search roots
+// change on disk, and answers queries from pj over a Unix socket.
+package daemon
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/josephschmitt/pj/internal/cache"
+	"github.com/josephschmitt/pj/internal/config"
+	"github.com/josephschmitt/pj/internal/discover"
+)
+
+const (
+	debounce     = 200 * time.Millisecond // Quiet period after a change before the index is updated
+	dialTimeout  = 100 * time.Millisecond
+	queryTimeout = 2 * time.Second
+)
+
+// request is sent by pj; the fingerprint identifies its version and settings
+type request struct {
+	Fingerprint string
+}
+
+// response carries the index, or why the daemon can't answer
+type response struct {
+	Projects []discover.Project
+	Error    string
+}
+
+// SocketPath returns the socket of the daemon serving the manager's settings.
+// Each combination of settings gets its own socket, like the cache files.
+func SocketPath(m *cache.Manager) string {
+	return filepath.Join(m.Dir(), fmt.Sprintf("daemon-%s.sock", m.Key()))
+}
+
+// Server holds the in-memory index
+type Server struct {
+	config      *config.Config
+	cache       *cache.Manager
+	discoverer  *discover.Discoverer
+	verbose     bool
+	socketPath  string
+	fingerprint string
+
+	mu       sync.RWMutex
+	projects []discover.Project
+
+	// Only used by the goroutine that refreshes the index
+	states  []discover.WalkState
+	watcher *fsnotify.Watcher
+	watched map[string]bool
+}
+
+// New creates a daemon for the given settings. The cache seeds the first index and
+// is kept up to date so pj can fall back to it when the daemon stops.
+func New(cfg *config.Config, cacheManager *cache.Manager, verbose bool) *Server {
+	return &Server{
+		config:      cfg,
+		cache:       cacheManager,
+		discoverer:  discover.New(cfg, verbose),
+		verbose:     verbose,
+		socketPath:  SocketPath(cacheManager),
+		fingerprint: cacheManager.Fingerprint(),
+		watched:     make(map[string]bool),
+	}
+}
+
+// Run builds the index and serves queries until ctx is cancelled
+func (s *Server) Run(ctx context.Context) error {
+	if conn, err := net.DialTimeout("unix", s.socketPath, dialTimeout); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("daemon already running on %s", s.socketPath)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	s.watcher = watcher
+
+	// Start from the cached walks so only what changed since they were written is re-walked
+	err = s.refresh(func(root string) (discover.WalkState, bool, bool) {
+		state, ok, _ := s.cache.LoadShard(root)
+		return state, ok, false
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.socketPath), 0755); err != nil {
+		return err
+	}
+	// A socket nobody answers on was left behind by a daemon that didn't exit cleanly
+	_ = os.Remove(s.socketPath)
+	listener, err := net.Listen("unix", s.socketPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(s.socketPath)
+	defer listener.Close()
+
+	if s.verbose {
+		fmt.Fprintf(os.Stderr, "Listening on %s\n", s.socketPath)
+	}
+
+	go s.watch(ctx)
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.serve(conn)
+	}
+}
+
+// serve answers a single query
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(queryTimeout))
+
+	var req request
+	if err := gob.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+
+	var resp response
+	if req.Fingerprint != s.fingerprint {
+		resp.Error = "daemon is running a different pj version or settings"
+	} else {
+		s.mu.RLock()
+		resp.Projects = s.projects
+		s.mu.RUnlock()
+	}
+	_ = gob.NewEncoder(conn).Encode(resp)
+}
+
+// watch updates the index shortly after changes under the search roots settle. The
+// index is also revalidated every cache TTL, which catches changes in directories
+// that couldn't be watched (e.g. past the inotify watch limit).
+func (s *Server) watch(ctx context.Context) {
+	interval := time.Duration(s.config.CacheTTL) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			// The index is written back to the cache, which may lie under a search root
+			if strings.HasPrefix(event.Name, s.cache.Dir()+string(os.PathSeparator)) {
+				continue
+			}
+			if pending == nil {
+				pending = time.After(debounce)
+			}
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			// Usually a queue overflow, after which events may have been lost
+			if s.verbose {
+				fmt.Fprintf(os.Stderr, "Warning: watch error: %v\n", err)
+			}
+			if pending == nil {
+				pending = time.After(debounce)
+			}
+		case <-pending:
+			pending = nil
+			s.revalidate()
+		case <-ticker.C:
+			s.revalidate()
+		}
+	}
+}
+
+// revalidate re-walks the subtrees whose watched paths changed since the last update
+func (s *Server) revalidate() {
+	states := s.states
+	err := s.refresh(func(root string) (discover.WalkState, bool, bool) {
+		for _, state := range states {
+			if state.Root == root {
+				return state, true, false
+			}
+		}
+		return discover.WalkState{}, false, false
+	})
+	if err != nil && s.verbose {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update index: %v\n", err)
+	}
+}
+
+// refresh rebuilds the index from the walk states load returns. States are always
+// reported stale, so each one is revalidated and comes back for watching.
+func (s *Server) refresh(load discover.WalkLoader) error {
+	projects, states, err := s.discoverer.DiscoverIncremental(load)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.projects = projects
+	s.mu.Unlock()
+	s.states = states
+	s.updateWatches()
+
+	for _, state := range states {
+		if err := s.cache.SetShard(state); err != nil && s.verbose {
+			fmt.Fprintf(os.Stderr, "Warning: failed to cache walk of %s: %v\n", state.Root, err)
+		}
+	}
+	if err := s.cache.Set(projects); err != nil && s.verbose {
+		fmt.Fprintf(os.Stderr, "Warning: failed to cache results: %v\n", err)
+	}
+
+	if s.verbose {
+		fmt.Fprintf(os.Stderr, "Index updated (%d projects, %d directories watched)\n", len(projects), len(s.watched))
+	}
+	return nil
+}
+
+// updateWatches watches the directories holding every path the walk states depend on
+func (s *Server) updateWatches() {
+	want := make(map[string]bool)
+	for _, state := range s.states {
+		want[state.Root] = true
+		for _, w := range state.Watched {
+			if dir := watchDir(w.Path); dir != "" {
+				want[dir] = true
+			}
+		}
+	}
+
+	for dir := range s.watched {
+		if !want[dir] {
+			// Fails harmlessly for directories that were deleted, which drops their watch
+			_ = s.watcher.Remove(dir)
+		}
+	}
+
+	failed := 0
+	var lastErr error
+	for dir := range want {
+		if s.watched[dir] {
+			continue
+		}
+		if err := s.watcher.Add(dir); err != nil {
+			delete(want, dir)
+			failed++
+			lastErr = err
+		}
+	}
+	if failed > 0 && s.verbose {
+		fmt.Fprintf(os.Stderr, "Warning: couldn't watch %d directories: %v\n", failed, lastErr)
+	}
+
+	s.watched = want
+}
+
+// watchDir returns the directory to watch for changes to path: path itself if it is
+// a directory, otherwise its parent, which also sees the path being created
+func watchDir(path string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return path
+	}
+	parent := filepath.Dir(path)
+	if info, err := os.Stat(parent); err == nil && info.IsDir() {
+		return parent
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/josephschmitt/pj/internal/cache"
+	"github.com/josephschmitt/pj/internal/config"
+	"github.com/josephschmitt/pj/internal/discover"
+)
+
+// waitFor polls Query until check accepts the result or the deadline passes
+func waitFor(t *testing.T, socketPath, fingerprint string, check func([]discover.Project) bool) []discover.Project {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		projects, err := Query(socketPath, fingerprint)
+		if err == nil && check(projects) {
+			return projects
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for daemon, last result %+v, %v", projects, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestDaemon(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a", ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{SearchPaths: []string{root}, Markers: []string{".git"}, MaxDepth: 3, CacheTTL: 300}
+	cacheManager := cache.New(cfg, false)
+	socketPath := SocketPath(cacheManager)
+	fingerprint := cacheManager.Fingerprint()
+
+	if _, err := Query(socketPath, fingerprint); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Query() without daemon error = %v, want ErrNotRunning", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- New(cfg, cacheManager, false).Run(ctx) }()
+
+	waitFor(t, socketPath, fingerprint, func(p []discover.Project) bool { return len(p) == 1 })
+
+	if err := New(cfg, cacheManager, false).Run(context.Background()); err == nil {
+		t.Error("second daemon Run() succeeded, want already running error")
+	}
+	if _, err := Query(socketPath, "other"); err == nil || errors.Is(err, ErrNotRunning) {
+		t.Errorf("Query() with different fingerprint error = %v, want settings mismatch", err)
+	}
+
+	// Projects appear and disappear as directories change
+	nested := filepath.Join(root, "group", "b", ".git")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, socketPath, fingerprint, func(p []discover.Project) bool { return len(p) == 2 })
+	if err := os.RemoveAll(filepath.Join(root, "a")); err != nil {
+		t.Fatal(err)
+	}
+	projects := waitFor(t, socketPath, fingerprint, func(p []discover.Project) bool { return len(p) == 1 })
+	if want := filepath.Join(root, "group", "b"); projects[0].Path != want {
+		t.Errorf("projects = %+v, want only %s", projects, want)
+	}
+
+	// The index is written back so pj falls back to an up to date cache
+	if cached, err := cacheManager.Get(); err != nil || len(cached) != 1 {
+		t.Errorf("cache Get() = %+v, %v, want the daemon's index", cached, err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("socket %s still exists after shutdown", socketPath)
+	}
+}
@@ -11,15 +11,38 @@ import (
 	"sync"
 
 	"github.com/josephschmitt/pj/internal/config"
+	"github.com/josephschmitt/pj/internal/editors"
 )
 
 // Project represents a discovered project directory
 type Project struct {
 	Path           string `json:"path"`
-	Marker         string `json:"marker"`
+	Marker         string `json:"marker"`                // Configured marker (the pattern for glob markers)
+	MatchedFile    string `json:"matchedFile,omitempty"` // File or directory that satisfied the marker, relative to Path
 	Priority       int    `json:"priority"`
 	IsWorktree     bool   `json:"isWorktree,omitempty"`
 	WorktreeParent string `json:"worktreeParent,omitempty"`
+	VCS            string `json:"vcs,omitempty"`           // Version control system at Path, independent of Marker
+	ParentProject  string `json:"parentProject,omitempty"` // Nearest enclosing project (nested discovery only)
+	Depth          int    `json:"depth,omitempty"`         // Number of enclosing projects
+	Source         string `json:"source,omitempty"`        // Configured source or editor that found it; empty for search paths and pins
+
+	// Git remote (origin, or the first remote) parsed from .git/config
+	RemoteURL string `json:"remoteUrl,omitempty"`
+	Host      string `json:"host,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	Repo      string `json:"repo,omitempty"`
+
+	// Per-project overrides (from the project's .pj.yaml, pinned projects and
+	// sources); empty means use the marker's defaults
+	Name        string   `json:"name,omitempty"`
+	Label       string   `json:"label,omitempty"`
+	Icon        string   `json:"icon,omitempty"`
+	Color       string   `json:"color,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Hidden      bool     `json:"hidden,omitempty"` // Left out of the results unless pinned
+	IsPinned    bool     `json:"isPinned,omitempty"`
 }
 
 // Discoverer handles project discovery
@@ -55,64 +78,318 @@ var markerSpecificity = map[string]int{
 	".project":       5,
 	".zed":           5,
 	"Dockerfile":     7,
+	".jj":            1,
+	".hg":            1,
+	".fslckout":      1,
+	"_FOSSIL_":       1,
+	".pijul":         1,
+	".svn":           1,
 }
 
 // Discover finds all project directories
 func (d *Discoverer) Discover() ([]Project, error) {
-	var wg sync.WaitGroup
-	results := make(chan Project, 100)
+	projects, _, err := d.DiscoverIncremental(nil)
+	return projects, err
+}
 
-	// Fan-out: one goroutine per search path
-	for _, root := range d.config.SearchPaths {
-		if len(root) > 0 && root[0] == '~' {
-			home, err := os.UserHomeDir()
-			if err != nil {
-				continue
-			}
-			root = filepath.Join(home, root[1:])
-		}
+// WalkLoader returns the saved walk state for a search root, if there is one, and
+// whether it is fresh enough to use without revalidating
+type WalkLoader func(root string) (state WalkState, ok bool, fresh bool)
 
-		if _, err := os.Stat(root); os.IsNotExist(err) {
-			if d.verbose {
-				fmt.Fprintf(os.Stderr, "Skipping non-existent path: %s\n", root)
-			}
-			continue
-		}
+// DiscoverIncremental finds all project directories, starting from the walk state
+// load returns for each search root: fresh states are used as they are, stale ones
+// are revalidated, and roots without one are walked. load may be nil. It returns
+// the walk states that were walked or revalidated, for the caller to save.
+func (d *Discoverer) DiscoverIncremental(load WalkLoader) ([]Project, []WalkState, error) {
+	var wg sync.WaitGroup
+
+	roots, walkSources := d.roots()
 
+	// Fan-out: one goroutine per search path
+	states := make([]WalkState, len(roots))
+	updated := make([]bool, len(roots))
+	for i, root := range roots {
 		wg.Add(1)
-		go func(root string) {
+		go func(i int, root string) {
 			defer wg.Done()
+			if load != nil {
+				if state, ok, fresh := load(root); ok {
+					if fresh {
+						states[i] = state
+						return
+					}
+					states[i], updated[i] = d.revalidate(state), true
+					return
+				}
+			}
 			if d.verbose {
 				fmt.Fprintf(os.Stderr, "Searching %s...\n", root)
 			}
-			d.walkPath(root, results)
-		}(root)
+			states[i], updated[i] = d.walkPath(root, nil), true
+		}(i, root)
 	}
+	wg.Wait()
+
+	var changed []WalkState
+	for i, state := range states {
+		if updated[i] {
+			changed = append(changed, state)
+		}
+	}
+
+	return d.assemble(states, walkSources), changed, nil
+}
+
+// Roots returns the directories cfg walks: the search paths and the paths of
+// walk sources, expanded (see roots). They change when an environment variable a
+// path uses changes or a new directory matches a glob, so caches key on them.
+func Roots(cfg *config.Config) []string {
+	roots, _ := (&Discoverer{config: cfg}).roots()
+	return roots
+}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
+// roots expands ~, environment variables and globs in the search paths and the
+// paths of walk sources into the distinct, existing directories to walk. It also
+// returns the name of the walk source each root only it listed came from.
+func (d *Discoverer) roots() ([]string, map[string]string) {
+	type searchPath struct {
+		path   string
+		source string
+	}
+	var searchPaths []searchPath
+	for _, path := range d.config.SearchPaths {
+		searchPaths = append(searchPaths, searchPath{path: path})
+	}
+	for _, source := range d.config.Sources {
+		if source.Type == config.SourceWalk {
+			for _, path := range source.Paths {
+				searchPaths = append(searchPaths, searchPath{path: path, source: source.Name})
+			}
+		}
+	}
 
+	var roots []string
+	walkSources := make(map[string]string)
 	seen := make(map[string]bool)
+	for _, sp := range searchPaths {
+		expanded := config.ExpandSearchPath(sp.path)
+		if len(expanded) == 0 && d.verbose {
+			fmt.Fprintf(os.Stderr, "No matches for search path: %s\n", sp.path)
+		}
+		for _, root := range expanded {
+			if seen[root] {
+				continue
+			}
+			seen[root] = true
+			if _, err := os.Stat(root); os.IsNotExist(err) {
+				if d.verbose {
+					fmt.Fprintf(os.Stderr, "Skipping non-existent path: %s\n", root)
+				}
+				continue
+			}
+			roots = append(roots, root)
+			if sp.source != "" {
+				walkSources[root] = sp.source
+			}
+		}
+	}
+	return roots, walkSources
+}
+
+// assemble combines the walk states of all search roots into the final, sorted
+// project list, adding pinned projects, the projects of list and command sources
+// and editors' recent projects, and leaving out hidden ones. Projects from roots
+// that only walk sources listed are tagged with the source's name.
+func (d *Discoverer) assemble(states []WalkState, walkSources map[string]string) []Project {
+	// Overlapping search paths can report the same project more than once; keep the
+	// copy found from the outermost root since it knows about enclosing projects.
+	// Between equally deep copies, prefer the one found by walking to the directory
+	// over one reported by its repository's worktree list.
+	seen := make(map[string]int)
 	var projects []Project
-	for p := range results {
-		if !seen[p.Path] {
-			seen[p.Path] = true
+	for _, state := range states {
+		for _, wp := range state.Projects {
+			p := wp.Project
+			p.Source = walkSources[state.Root]
+			if i, ok := seen[p.Path]; ok {
+				if p.Depth > projects[i].Depth || (p.Depth == projects[i].Depth && wp.Origin == p.Path) {
+					projects[i] = p
+				}
+				continue
+			}
+			seen[p.Path] = len(projects)
 			projects = append(projects, p)
 		}
 	}
 
+	projects = d.addPinned(projects)
+	projects = d.addSources(projects)
+	projects = d.addRecents(projects)
+
+	// Projects whose .pj.yaml hides them are only listed when pinned
+	visible := projects[:0]
+	for _, p := range projects {
+		if !p.Hidden || p.IsPinned {
+			visible = append(visible, p)
+		}
+	}
+	projects = visible
+
 	// Sort by path for deterministic output; presentation sorting is handled by the caller
 	sort.Slice(projects, func(i, j int) bool {
 		return projects[i].Path < projects[j].Path
 	})
 
-	return projects, nil
+	return projects
+}
+
+// addPinned merges pinned projects from the config into the discovered projects.
+// Pinned directories that weren't discovered get their marker detected (unless the
+// pin sets one), so a pinned git checkout still shows the git icon.
+func (d *Discoverer) addPinned(projects []Project) []Project {
+	index := make(map[string]int, len(projects))
+	for i, p := range projects {
+		index[p.Path] = i
+	}
+
+	for _, pin := range d.config.Projects {
+		path := filepath.Clean(config.ExpandPath(pin.Path))
+		if _, err := os.Stat(path); err != nil {
+			if d.verbose {
+				fmt.Fprintf(os.Stderr, "Skipping pinned project %s: %v\n", pin.Path, err)
+			}
+			continue
+		}
+
+		i, ok := index[path]
+		if !ok {
+			projects = append(projects, d.newProject(path))
+			i = len(projects) - 1
+			index[path] = i
+		}
+
+		p := &projects[i]
+		p.IsPinned = true
+		d.override(p, pin.Marker, pin.Name, pin.Label, pin.Icon, pin.Tags)
+	}
+
+	return projects
+}
+
+// newProject returns a directory that wasn't discovered by walking as a project,
+// detecting its marker and reading its .pj.yaml
+func (d *Discoverer) newProject(path string) Project {
+	marker, matchedFile, priority := d.findBestMarker(path)
+	project := Project{
+		Path:        path,
+		Marker:      marker,
+		MatchedFile: matchedFile,
+		Priority:    priority,
+	}
+	d.loadLocalConfig(path).apply(&project)
+	annotateProject(&project)
+	return project
+}
+
+// override applies the per-project settings of a pin or source listing. A marker
+// replaces the detected one; the other settings replace the project's own, such
+// as those from its .pj.yaml, when they're set.
+func (d *Discoverer) override(p *Project, marker, name, label, icon string, tags []string) {
+	if marker != "" {
+		p.Marker = marker
+		p.MatchedFile = ""
+		p.Priority = d.getMarkerPriority(marker)
+	}
+	if name != "" {
+		p.Name = name
+	}
+	if label != "" {
+		p.Label = label
+	}
+	if icon != "" {
+		p.Icon = icon
+	}
+	if tags != nil {
+		p.Tags = tags
+	}
 }
 
-// walkPath walks a single search path
-func (d *Discoverer) walkPath(root string, results chan<- Project) {
+// addRecents merges the projects recently opened in the enabled editors. Folders
+// are used as they are, while files stand for the checkout containing them. Recent
+// projects that were already discovered or pinned keep those details.
+func (d *Discoverer) addRecents(projects []Project) []Project {
+	enabled := d.config.EditorRecents.Enabled()
+	if len(enabled) == 0 {
+		return projects
+	}
+
+	index := make(map[string]bool, len(projects))
+	for _, p := range projects {
+		index[p.Path] = true
+	}
+
+	home, _ := os.UserHomeDir()
+	for _, name := range enabled {
+		recents, err := editors.Editors[name].Recents()
+		if err != nil && d.verbose {
+			fmt.Fprintf(os.Stderr, "Skipping unreadable %s recents: %v\n", name, err)
+		}
+
+		for _, r := range recents {
+			path := filepath.Clean(config.ExpandPath(r.Path))
+			if !filepath.IsAbs(path) {
+				continue // Buffers without a file, like terminals
+			}
+			if r.File {
+				if path = checkoutRoot(filepath.Dir(path), home); path == "" {
+					continue
+				}
+			}
+			if index[path] {
+				continue
+			}
+			if info, err := os.Stat(path); err != nil || !info.IsDir() {
+				continue
+			}
+
+			project := d.newProject(path)
+			project.Source = name
+			projects = append(projects, project)
+			index[path] = true
+
+			if d.verbose {
+				fmt.Fprintf(os.Stderr, "Found recent project: %s (from %s)\n", path, name)
+			}
+		}
+	}
+
+	return projects
+}
+
+// checkoutRoot returns the nearest directory at or above dir that is the root of a
+// checkout, or "" if there is none. The home directory doesn't count, so files
+// under a home directory kept in git (for dotfiles) don't make it a project.
+func checkoutRoot(dir, home string) string {
+	for {
+		if dir == home {
+			return ""
+		}
+		if DetectVCS(dir) != "" {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// walkPath walks a single search path. If focus is non-nil, only the listed
+// subtrees are walked; their ancestors are visited just to rebuild the ignore
+// rules and enclosing projects in effect below them.
+func (d *Discoverer) walkPath(root string, focus []string) WalkState {
+	rec := &walkRecorder{state: WalkState{Root: root}}
 	baseDepth := strings.Count(root, string(os.PathSeparator))
 
 	ignoreFileNames := []string{".gitignore", ".ignore"}
@@ -120,6 +397,16 @@ func (d *Discoverer) walkPath(root string, results chan<- Project) {
 
 	previousDepth := -1
 
+	// Enclosing projects of the current directory, innermost last
+	type enclosingProject struct {
+		path  string
+		depth int
+	}
+	var parents []enclosingProject
+
+	// Depth limits and excludes set by .pj.yaml files, innermost last
+	scopes := []walkScope{{depth: -1, maxDepth: d.config.MaxDepth, excludes: d.config.Excludes}}
+
 	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return nil // Skip paths we can't access
@@ -133,9 +420,20 @@ func (d *Discoverer) walkPath(root string, results chan<- Project) {
 
 		if previousDepth >= 0 && currentDepth <= previousDepth {
 			ignoreStack.Leave(currentDepth)
+			for len(parents) > 0 && parents[len(parents)-1].depth >= currentDepth {
+				parents = parents[:len(parents)-1]
+			}
+			for len(scopes) > 1 && scopes[len(scopes)-1].depth >= currentDepth {
+				scopes = scopes[:len(scopes)-1]
+			}
 		}
 		previousDepth = currentDepth
 
+		inFocus := focus == nil || withinAny(path, focus)
+		if !inFocus && !aboveAny(path, focus) {
+			return fs.SkipDir
+		}
+
 		if ignoreStack.ShouldIgnore(path, true) {
 			return fs.SkipDir
 		}
@@ -146,27 +444,48 @@ func (d *Discoverer) walkPath(root string, results chan<- Project) {
 			}
 		}
 
-		if currentDepth > d.config.MaxDepth {
+		scope := scopes[len(scopes)-1]
+		if currentDepth > scope.maxDepth {
 			return fs.SkipDir
 		}
 
 		dirName := filepath.Base(path)
-		for _, exclude := range d.config.Excludes {
+		for _, exclude := range scope.excludes {
 			if matchPattern(dirName, exclude) {
 				return fs.SkipDir
 			}
 		}
 
+		local := d.loadLocalConfig(path)
+		if below, ok := scope.below(currentDepth, local); ok {
+			scopes = append(scopes, below)
+		}
+
+		if inFocus {
+			rec.watchDir(path, entry)
+			for _, file := range ignoreStack.Loaded(path) {
+				rec.watch(file, path)
+			}
+			rec.watchExisting(filepath.Join(path, localFileName), path)
+			d.watchPathMarkers(rec, path)
+		}
+
 		// Check for project markers - find the highest priority marker
-		bestMarker, bestPriority := d.findBestMarker(path)
+		bestMarker, matchedFile, bestPriority := d.findBestMarker(path)
 
 		// If we found any marker, emit the project with the best one
 		if bestMarker != "" {
 			project := Project{
-				Path:     path,
-				Marker:   bestMarker,
-				Priority: bestPriority,
+				Path:        path,
+				Marker:      bestMarker,
+				MatchedFile: matchedFile,
+				Priority:    bestPriority,
+				Depth:       len(parents),
+			}
+			if len(parents) > 0 {
+				project.ParentProject = parents[len(parents)-1].path
 			}
+			local.apply(&project)
 
 			// Path A: detect if this is a worktree (.git is a file, not a directory)
 			gitPath := filepath.Join(path, ".git")
@@ -181,17 +500,23 @@ func (d *Discoverer) walkPath(root string, results chan<- Project) {
 				}
 			}
 
-			results <- project
+			annotateProject(&project)
+			if inFocus {
+				rec.emit(project, path)
+				d.watchProject(rec, project)
 
-			// Path B: discover linked worktrees from parent repos
-			if d.config.Worktrees && !project.IsWorktree {
-				d.discoverWorktrees(path, results)
+				// Path B: discover linked worktrees from parent repos
+				if d.config.Worktrees && !project.IsWorktree {
+					d.discoverWorktrees(path, rec)
+				}
 			}
 
-			// Skip subdirectories unless nested discovery is enabled
-			if !d.config.Nested {
+			// Skip subdirectories unless nested discovery is enabled for the winning
+			// marker, and always stop at directories containing a stop marker
+			if !d.config.ShouldDescend(bestMarker) || d.hasStopMarker(path) {
 				return fs.SkipDir
 			}
+			parents = append(parents, enclosingProject{path: path, depth: currentDepth})
 		}
 
 		return nil
@@ -200,6 +525,7 @@ func (d *Discoverer) walkPath(root string, results chan<- Project) {
 	if err != nil && d.verbose {
 		fmt.Fprintf(os.Stderr, "Error walking %s: %v\n", root, err)
 	}
+	return rec.state
 }
 
 // getMarkerPriority returns the priority for a marker, checking config first, then defaults
@@ -214,25 +540,42 @@ func (d *Discoverer) getMarkerPriority(marker string) int {
 	return priority
 }
 
-// checkPatternMarkers checks pattern-based markers by reading directory contents once
-func (d *Discoverer) checkPatternMarkers(dir string) (string, int) {
+// checkPatternMarkers checks pattern-based markers by reading directory contents once.
+// It returns the winning pattern, the file it matched, and the pattern's priority.
+func (d *Discoverer) checkPatternMarkers(dir string) (string, string, int) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return "", 0
+		return "", "", 0
 	}
 
+	var bestPattern string
 	var bestMatch string
 	var bestPriority int
 
 	for _, pattern := range d.config.PatternMarkers {
+		// Path markers like ".github/workflows/*.yml" reach below the top level,
+		// so they are resolved segment by segment instead of against entries
+		if isPathMarker(pattern) {
+			if matched := matchPathMarker(dir, pattern, d.config.GetMarkerType(pattern)); matched != "" {
+				priority := d.getMarkerPriority(pattern)
+				if priority > bestPriority {
+					bestPattern = pattern
+					bestMatch = matched
+					bestPriority = priority
+				}
+			}
+			continue
+		}
+		markerType := d.config.GetMarkerType(pattern)
 		for _, entry := range entries {
-			if entry.IsDir() {
-				continue // Skip directories for file patterns
+			if !markerTypeMatches(markerType, entry.IsDir()) {
+				continue
 			}
 			matched, _ := filepath.Match(pattern, entry.Name())
 			if matched {
 				priority := d.getMarkerPriority(pattern)
 				if priority > bestPriority {
+					bestPattern = pattern
 					bestMatch = entry.Name()
 					bestPriority = priority
 				}
@@ -240,7 +583,76 @@ func (d *Discoverer) checkPatternMarkers(dir string) (string, int) {
 			}
 		}
 	}
-	return bestMatch, bestPriority
+	return bestPattern, bestMatch, bestPriority
+}
+
+// hasStopMarker reports whether dir contains any marker configured with stop: true
+func (d *Discoverer) hasStopMarker(dir string) bool {
+	for marker := range d.config.StopMarkers {
+		if matchPathMarker(dir, marker, d.config.GetMarkerType(marker)) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isPathMarker returns true if the marker refers to a path below the project root
+// (e.g. "src/main.rs" or ".github/workflows/*.yml")
+func isPathMarker(marker string) bool {
+	return strings.Contains(filepath.ToSlash(marker), "/")
+}
+
+// matchPathMarker resolves a marker containing path separators relative to dir,
+// expanding glob segments one directory level at a time. It returns the first
+// matching relative path (alphabetically per level), or "" if nothing matches.
+// markerType restricts what the final segment may match (file, dir, or any).
+func matchPathMarker(dir, marker, markerType string) string {
+	segments := strings.Split(filepath.ToSlash(filepath.Clean(marker)), "/")
+	return matchPathSegments(dir, segments, markerType)
+}
+
+// matchPathSegments matches the remaining marker segments below dir
+func matchPathSegments(dir string, segments []string, markerType string) string {
+	segment := segments[0]
+	last := len(segments) == 1
+
+	if !config.IsPatternMarker(segment) {
+		path := filepath.Join(dir, segment)
+		info, err := os.Stat(path)
+		if err != nil {
+			return ""
+		}
+		if last {
+			if !markerTypeMatches(markerType, info.IsDir()) {
+				return ""
+			}
+			return segment
+		}
+		if rest := matchPathSegments(path, segments[1:], markerType); rest != "" {
+			return filepath.Join(segment, rest)
+		}
+		return ""
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if matched, _ := filepath.Match(segment, entry.Name()); !matched {
+			continue
+		}
+		if last {
+			if !markerTypeMatches(markerType, entry.IsDir()) {
+				continue
+			}
+			return entry.Name()
+		}
+		if rest := matchPathSegments(filepath.Join(dir, entry.Name()), segments[1:], markerType); rest != "" {
+			return filepath.Join(entry.Name(), rest)
+		}
+	}
+	return ""
 }
 
 // parseWorktreeGitFile reads a .git file (not directory) and resolves the parent repo path.
@@ -285,7 +697,7 @@ func parseWorktreeGitFile(gitFilePath string) string {
 }
 
 // discoverWorktrees finds git worktrees linked from a parent repo's .git/worktrees/ directory.
-func (d *Discoverer) discoverWorktrees(repoPath string, results chan<- Project) {
+func (d *Discoverer) discoverWorktrees(repoPath string, rec *walkRecorder) {
 	worktreesDir := filepath.Join(repoPath, ".git", "worktrees")
 	entries, err := os.ReadDir(worktreesDir)
 	if err != nil {
@@ -342,19 +754,26 @@ func (d *Discoverer) discoverWorktrees(repoPath string, results chan<- Project)
 		}
 
 		// Find the best marker in the worktree directory
-		bestMarker, bestPriority := d.findBestMarker(wtPath)
+		bestMarker, matchedFile, bestPriority := d.findBestMarker(wtPath)
 		if bestMarker == "" {
 			bestMarker = ".git"
+			matchedFile = ".git"
 			bestPriority = d.getMarkerPriority(".git")
 		}
 
-		results <- Project{
+		project := Project{
 			Path:           wtPath,
 			Marker:         bestMarker,
+			MatchedFile:    matchedFile,
 			Priority:       bestPriority,
 			IsWorktree:     true,
 			WorktreeParent: repoPath,
 		}
+		d.loadLocalConfig(wtPath).apply(&project)
+		annotateProject(&project)
+		rec.emit(project, repoPath)
+		rec.watch(wtPath, repoPath)
+		rec.watchExisting(filepath.Join(wtPath, localFileName), repoPath)
 
 		if d.verbose {
 			fmt.Fprintf(os.Stderr, "Found worktree: %s (parent: %s)\n", wtPath, repoPath)
@@ -362,31 +781,47 @@ func (d *Discoverer) discoverWorktrees(repoPath string, results chan<- Project)
 	}
 }
 
-// findBestMarker checks a directory for configured markers and returns the best one.
-func (d *Discoverer) findBestMarker(dir string) (string, int) {
+// findBestMarker checks a directory for configured markers and returns the best one,
+// along with the file it matched and its priority.
+func (d *Discoverer) findBestMarker(dir string) (string, string, int) {
 	var bestMarker string
+	var bestMatch string
 	var bestPriority int
 
 	for _, marker := range d.config.ExactMarkers {
 		markerPath := filepath.Join(dir, marker)
-		if _, err := os.Stat(markerPath); err == nil {
+		if info, err := os.Stat(markerPath); err == nil && markerTypeMatches(d.config.GetMarkerType(marker), info.IsDir()) {
 			priority := d.getMarkerPriority(marker)
 			if priority > bestPriority {
 				bestMarker = marker
+				bestMatch = filepath.FromSlash(marker)
 				bestPriority = priority
 			}
 		}
 	}
 
 	if len(d.config.PatternMarkers) > 0 {
-		patternMarker, patternPriority := d.checkPatternMarkers(dir)
+		patternMarker, patternMatch, patternPriority := d.checkPatternMarkers(dir)
 		if patternPriority > bestPriority {
 			bestMarker = patternMarker
+			bestMatch = patternMatch
 			bestPriority = patternPriority
 		}
 	}
 
-	return bestMarker, bestPriority
+	return bestMarker, bestMatch, bestPriority
+}
+
+// markerTypeMatches reports whether a file or directory satisfies a marker type
+func markerTypeMatches(markerType string, isDir bool) bool {
+	switch markerType {
+	case config.MarkerTypeFile:
+		return !isDir
+	case config.MarkerTypeDir:
+		return isDir
+	default:
+		return true
+	}
 }
 
 // matchPattern checks if a name matches a pattern (simple glob support)
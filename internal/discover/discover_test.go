@@ -1,8 +1,10 @@
 package discover
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -306,6 +308,174 @@ func TestDiscoverTildeExpansion(t *testing.T) {
 	}
 }
 
+func TestDiscoverEnvAndGlobExpansion(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("PJ_TEST_WORK", tmpDir)
+
+	// tmpDir/clients/{acme,globex}/code/<project>
+	createProject(t, filepath.Join(tmpDir, "clients", "acme", "code"), "acme-app", ".git/")
+	createProject(t, filepath.Join(tmpDir, "clients", "globex", "code"), "globex-app", ".git/")
+	// A client without a code dir shouldn't produce a root
+	if err := os.MkdirAll(filepath.Join(tmpDir, "clients", "initech"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	createProject(t, filepath.Join(tmpDir, "repos"), "work-app", ".git/")
+
+	cfg := &config.Config{
+		SearchPaths: []string{"$PJ_TEST_WORK/repos", "${PJ_TEST_WORK}/clients/*/code", "$PJ_TEST_WORK/nothing-*"},
+		Markers:     []string{".git"},
+		MaxDepth:    3,
+		Excludes:    []string{},
+	}
+
+	d := New(cfg, false)
+	projects, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	found := make(map[string]bool)
+	for _, p := range projects {
+		found[filepath.Base(p.Path)] = true
+	}
+	for _, name := range []string{"work-app", "acme-app", "globex-app"} {
+		if !found[name] {
+			t.Errorf("%s not found in results", name)
+		}
+	}
+	if len(projects) != 3 {
+		t.Errorf("Discover() found %d projects, want 3", len(projects))
+	}
+}
+
+func TestDiscoverPinnedProjects(t *testing.T) {
+	searchDir := t.TempDir()
+	outsideDir := t.TempDir()
+
+	discovered := createProject(t, searchDir, "app", "go.mod")
+	dotfiles := createProject(t, outsideDir, "dotfiles") // No marker
+	infra := createProject(t, outsideDir, "infra", ".git/")
+
+	cfg := &config.Config{
+		SearchPaths: []string{searchDir},
+		Markers:     []string{".git", "go.mod"},
+		MaxDepth:    3,
+		Excludes:    []string{},
+		Projects: []config.PinnedProject{
+			{Path: dotfiles, Name: "dots", Label: "dotfiles", Tags: []string{"config"}},
+			{Path: infra},
+			{Path: discovered, Icon: "X"},
+			{Path: filepath.Join(outsideDir, "missing")},
+		},
+	}
+
+	d := New(cfg, false)
+	projects, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	if len(projects) != 3 {
+		t.Fatalf("Discover() found %d projects, want 3", len(projects))
+	}
+
+	found := make(map[string]Project)
+	for _, p := range projects {
+		found[p.Path] = p
+	}
+
+	if p := found[dotfiles]; !p.IsPinned || p.Marker != "" || p.Name != "dots" || p.Label != "dotfiles" || len(p.Tags) != 1 {
+		t.Errorf("dotfiles = %+v, want pinned with overrides and no marker", p)
+	}
+	if p := found[infra]; !p.IsPinned || p.Marker != ".git" {
+		t.Errorf("infra = %+v, want pinned with detected .git marker", p)
+	}
+	if p := found[discovered]; !p.IsPinned || p.Marker != "go.mod" || p.Icon != "X" {
+		t.Errorf("app = %+v, want discovered project marked as pinned with icon override", p)
+	}
+}
+
+func TestDiscoverEditorRecents(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("VS Code's config directory only follows XDG_CONFIG_HOME on Linux")
+	}
+	searchDir := t.TempDir()
+	outsideDir := t.TempDir()
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+
+	discovered := createProject(t, searchDir, "app", "go.mod")
+	scratch := createProject(t, outsideDir, "scratch") // No marker
+	lib := createProject(t, outsideDir, "lib", ".git/", "go.mod")
+	notes := createProject(t, outsideDir, "notes") // Not a checkout
+	pinned := createProject(t, outsideDir, "pinned", ".git/")
+	if err := os.MkdirAll(filepath.Join(lib, "internal"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	uri := func(path string) string { return "file://" + filepath.ToSlash(path) }
+	storage, err := json.Marshal(map[string]any{
+		"openedPathsList": map[string]any{
+			"workspaces3": []string{uri(discovered), uri(scratch), uri(pinned), uri(filepath.Join(outsideDir, "deleted"))},
+			"files2":      []string{uri(filepath.Join(lib, "internal", "lib.go")), uri(filepath.Join(notes, "todo.md"))},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storageDir := filepath.Join(configDir, "Code", "User", "globalStorage")
+	if err := os.MkdirAll(storageDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(storageDir, "storage.json"), storage, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		SearchPaths:   []string{searchDir},
+		Markers:       []string{".git", "go.mod"},
+		MaxDepth:      3,
+		Excludes:      []string{},
+		Projects:      []config.PinnedProject{{Path: pinned}},
+		EditorRecents: config.EditorRecents{VSCode: true},
+	}
+
+	projects, err := New(cfg, false).Discover()
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	found := make(map[string]Project)
+	for _, p := range projects {
+		found[p.Path] = p
+	}
+	if len(projects) != 4 {
+		t.Fatalf("Discover() = %v, want app, scratch, lib and pinned", found)
+	}
+	if p := found[discovered]; p.Source != "" || p.Marker != "go.mod" {
+		t.Errorf("app = %+v, want the walked project without a source", p)
+	}
+	if p := found[scratch]; p.Source != "vscode" || p.Marker != "" {
+		t.Errorf("scratch = %+v, want a vscode project without a marker", p)
+	}
+	if p := found[lib]; p.Source != "vscode" || p.Marker != "go.mod" || p.VCS != "git" {
+		t.Errorf("lib = %+v, want the checkout containing the recent file", p)
+	}
+	if p := found[pinned]; p.Source != "" || !p.IsPinned {
+		t.Errorf("pinned = %+v, want the pinned project without a source", p)
+	}
+
+	// Disabled editors aren't read
+	cfg.EditorRecents = config.EditorRecents{}
+	projects, err = New(cfg, false).Discover()
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	if len(projects) != 2 {
+		t.Errorf("Discover() without editor_recents found %d projects, want 2", len(projects))
+	}
+}
+
 func TestDiscoverDeduplication(t *testing.T) {
 	tmpDir := t.TempDir()
 	createProject(t, tmpDir, "project1", ".git/")
@@ -993,6 +1163,149 @@ func TestDiscoverNested(t *testing.T) {
 	}
 }
 
+func TestDiscoverNestedHierarchy(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// tmpDir/
+	//   mono/            .git
+	//     packages/
+	//       api/         go.mod
+	//         plugin/    go.mod
+	//       web/         package.json
+	//   standalone/      Cargo.toml
+	monoDir := createProject(t, tmpDir, "mono", ".git/")
+	apiDir := createProject(t, filepath.Join(monoDir, "packages"), "api", "go.mod")
+	createProject(t, apiDir, "plugin", "go.mod")
+	createProject(t, filepath.Join(monoDir, "packages"), "web", "package.json")
+	createProject(t, tmpDir, "standalone", "Cargo.toml")
+
+	cfg := &config.Config{
+		SearchPaths: []string{tmpDir},
+		Markers:     []string{".git", "package.json", "go.mod", "Cargo.toml"},
+		MaxDepth:    5,
+		Excludes:    []string{},
+		Nested:      true,
+	}
+
+	d := New(cfg, false)
+	projects, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	found := make(map[string]Project)
+	for _, p := range projects {
+		found[filepath.Base(p.Path)] = p
+	}
+
+	tests := []struct {
+		name   string
+		parent string
+		depth  int
+	}{
+		{"mono", "", 0},
+		{"api", monoDir, 1},
+		{"plugin", apiDir, 2},
+		{"web", monoDir, 1},
+		{"standalone", "", 0},
+	}
+	for _, tt := range tests {
+		p, ok := found[tt.name]
+		if !ok {
+			t.Errorf("%s not found in results", tt.name)
+			continue
+		}
+		if p.ParentProject != tt.parent || p.Depth != tt.depth {
+			t.Errorf("%s: parent = %q, depth = %d; want parent = %q, depth = %d", tt.name, p.ParentProject, p.Depth, tt.parent, tt.depth)
+		}
+	}
+}
+
+func TestDiscoverPerMarkerNested(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// tmpDir/
+	//   gomono/       go.mod
+	//     svc/        go.mod
+	//   vendored/     .git
+	//     inner/      package.json
+	//   ide/          .git, .idea, go.mod
+	//     sub/        go.mod
+	goDir := createProject(t, tmpDir, "gomono", "go.mod")
+	createProject(t, goDir, "svc", "go.mod")
+	vendoredDir := createProject(t, tmpDir, "vendored", ".git/")
+	createProject(t, vendoredDir, "inner", "package.json")
+	ideDir := createProject(t, tmpDir, "ide", ".git/", ".idea/", "go.mod")
+	createProject(t, ideDir, "sub", "go.mod")
+
+	tests := []struct {
+		name             string
+		nested           bool
+		markerNested     map[string]bool
+		stopMarkers      map[string]bool
+		shouldContain    []string
+		shouldNotContain []string
+	}{
+		{
+			name:             "marker nested false overrides global nested",
+			nested:           true,
+			markerNested:     map[string]bool{".git": false},
+			shouldContain:    []string{"gomono", "svc", "vendored", "ide", "sub"},
+			shouldNotContain: []string{"inner"},
+		},
+		{
+			name:             "marker nested true overrides global no-nested",
+			nested:           false,
+			markerNested:     map[string]bool{"go.mod": true},
+			shouldContain:    []string{"gomono", "svc", "vendored", "ide", "sub"},
+			shouldNotContain: []string{"inner"},
+		},
+		{
+			name:             "stop marker halts descent even when it doesn't win",
+			nested:           true,
+			stopMarkers:      map[string]bool{".idea": true},
+			shouldContain:    []string{"gomono", "svc", "vendored", "inner", "ide"},
+			shouldNotContain: []string{"sub"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				SearchPaths:  []string{tmpDir},
+				Markers:      []string{".git", ".idea", "package.json", "go.mod"},
+				MaxDepth:     5,
+				Excludes:     []string{},
+				Nested:       tt.nested,
+				MarkerNested: tt.markerNested,
+				StopMarkers:  tt.stopMarkers,
+				Priorities:   map[string]int{".git": 1, ".idea": 5, "package.json": 7, "go.mod": 10},
+			}
+
+			d := New(cfg, false)
+			projects, err := d.Discover()
+			if err != nil {
+				t.Fatalf("Discover() error = %v", err)
+			}
+
+			found := make(map[string]bool)
+			for _, p := range projects {
+				found[filepath.Base(p.Path)] = true
+			}
+			for _, name := range tt.shouldContain {
+				if !found[name] {
+					t.Errorf("%s not found in results", name)
+				}
+			}
+			for _, name := range tt.shouldNotContain {
+				if found[name] {
+					t.Errorf("%s found in results (should not be)", name)
+				}
+			}
+		})
+	}
+}
+
 func TestDiscoverNestedWithMaxDepth(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -1160,8 +1473,11 @@ func TestDiscoverPatternMarkers(t *testing.T) {
 	for _, p := range projects {
 		if filepath.Base(p.Path) == "dotnet-app" {
 			foundDotnet = true
-			if p.Marker != "MyApp.csproj" {
-				t.Errorf("Expected marker 'MyApp.csproj', got '%s'", p.Marker)
+			if p.Marker != "*.csproj" {
+				t.Errorf("Expected marker '*.csproj', got '%s'", p.Marker)
+			}
+			if p.MatchedFile != "MyApp.csproj" {
+				t.Errorf("Expected matched file 'MyApp.csproj', got '%s'", p.MatchedFile)
 			}
 		}
 		if filepath.Base(p.Path) == "go-app" {
@@ -1215,8 +1531,8 @@ func TestDiscoverPatternMarkerPriority(t *testing.T) {
 	}
 
 	// Should find the .sln file since it has higher priority
-	if projects[0].Marker != "Solution.sln" {
-		t.Errorf("Expected marker 'Solution.sln' (higher priority), got '%s'", projects[0].Marker)
+	if projects[0].Marker != "*.sln" || projects[0].MatchedFile != "Solution.sln" {
+		t.Errorf("Expected marker '*.sln' matching 'Solution.sln' (higher priority), got '%s' matching '%s'", projects[0].Marker, projects[0].MatchedFile)
 	}
 	if projects[0].Priority != 15 {
 		t.Errorf("Expected priority 15, got %d", projects[0].Priority)
@@ -1273,8 +1589,8 @@ func TestDiscoverMixedExactAndPatternMarkers(t *testing.T) {
 	for _, p := range projects {
 		if filepath.Base(p.Path) == "has-both" {
 			// Pattern marker has higher priority, so .csproj should win
-			if p.Marker != "App.csproj" {
-				t.Errorf("Expected pattern marker 'App.csproj' (priority 10) over '.git' (priority 1), got '%s'", p.Marker)
+			if p.Marker != "*.csproj" || p.MatchedFile != "App.csproj" {
+				t.Errorf("Expected pattern marker '*.csproj' (priority 10) over '.git' (priority 1), got '%s' matching '%s'", p.Marker, p.MatchedFile)
 			}
 		}
 	}
@@ -1317,8 +1633,8 @@ func TestDiscoverMultiplePatternMatches(t *testing.T) {
 	}
 
 	// First match (alphabetically from ReadDir) wins
-	if projects[0].Marker != "Alpha.csproj" {
-		t.Errorf("Expected first alphabetical match 'Alpha.csproj', got '%s'", projects[0].Marker)
+	if projects[0].MatchedFile != "Alpha.csproj" {
+		t.Errorf("Expected first alphabetical match 'Alpha.csproj', got '%s'", projects[0].MatchedFile)
 	}
 }
 
@@ -1383,8 +1699,153 @@ func TestDiscoverPatternMarkerSkipsDirectories(t *testing.T) {
 	}
 
 	// Should find the file, not the directory
-	if projects[0].Marker != "App.csproj" {
-		t.Errorf("Expected file marker 'App.csproj', got '%s'", projects[0].Marker)
+	if projects[0].MatchedFile != "App.csproj" {
+		t.Errorf("Expected file marker 'App.csproj', got '%s'", projects[0].MatchedFile)
+	}
+}
+
+func TestDiscoverPathMarkers(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Project identified by a nested exact marker
+	createProject(t, tmpDir, "rust-app", "src/", "src/main.rs")
+	// Project identified by a nested glob marker
+	createProject(t, tmpDir, "ci-repo", ".github/", ".github/workflows/", ".github/workflows/build.yml")
+	// Directory whose nested path doesn't match the glob
+	createProject(t, tmpDir, "no-workflows", ".github/", ".github/workflows/", ".github/workflows/README.md")
+
+	cfg := &config.Config{
+		SearchPaths: []string{tmpDir},
+		Markers:     []string{"src/main.rs", ".github/workflows/*.yml"},
+		MaxDepth:    3,
+		Excludes:    []string{},
+		Priorities: map[string]int{
+			".github/workflows/*.yml": 4,
+		},
+	}
+
+	d := New(cfg, false)
+	projects, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	found := make(map[string]Project)
+	for _, p := range projects {
+		found[filepath.Base(p.Path)] = p
+	}
+
+	if len(projects) != 2 {
+		t.Errorf("Discover() found %d projects, want 2", len(projects))
+		for _, p := range projects {
+			t.Logf("  Found: %s (marker: %s)", p.Path, p.Marker)
+		}
+	}
+	if p, ok := found["rust-app"]; !ok || p.Marker != "src/main.rs" {
+		t.Errorf("rust-app marker = %q, want 'src/main.rs'", p.Marker)
+	}
+	if p, ok := found["ci-repo"]; !ok || p.Marker != ".github/workflows/*.yml" || p.Priority != 4 {
+		t.Errorf("ci-repo = %+v, want marker '.github/workflows/*.yml' with priority 4", p)
+	}
+	if p := found["ci-repo"]; p.MatchedFile != filepath.Join(".github", "workflows", "build.yml") {
+		t.Errorf("ci-repo matched file = %q, want '.github/workflows/build.yml'", p.MatchedFile)
+	}
+	if _, ok := found["no-workflows"]; ok {
+		t.Error("no-workflows should not be discovered")
+	}
+}
+
+func TestMatchPathMarker(t *testing.T) {
+	tmpDir := t.TempDir()
+	createProject(t, tmpDir, "proj", ".github/", ".github/workflows/", ".github/workflows/ci.yml", ".github/workflows/lint.yml", "app/", "app/build.gradle", "dir.yml/")
+
+	dir := filepath.Join(tmpDir, "proj")
+	tests := []struct {
+		marker     string
+		markerType string
+		expected   string
+	}{
+		{"app/build.gradle", config.MarkerTypeAny, filepath.Join("app", "build.gradle")},
+		{".github/workflows/*.yml", config.MarkerTypeFile, filepath.Join(".github", "workflows", "ci.yml")},
+		{"*/workflows/lint.yml", config.MarkerTypeAny, filepath.Join(".github", "workflows", "lint.yml")},
+		{"*/build.gradle", config.MarkerTypeAny, filepath.Join("app", "build.gradle")},
+		{".github/workflows/*.yaml", config.MarkerTypeFile, ""},
+		{"missing/file", config.MarkerTypeAny, ""},
+		{"app/build.gradle/extra", config.MarkerTypeAny, ""},
+		{".github/workflows", config.MarkerTypeDir, ".github/workflows"},
+		{".github/workflows", config.MarkerTypeFile, ""},
+		{"app/*.gradle", config.MarkerTypeDir, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.marker+"/"+tt.markerType, func(t *testing.T) {
+			got := matchPathMarker(dir, tt.marker, tt.markerType)
+			if got != filepath.FromSlash(tt.expected) {
+				t.Errorf("matchPathMarker(%q, %q) = %q, want %q", tt.marker, tt.markerType, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDiscoverMarkerTypes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Bundle-style directory markers
+	createProject(t, tmpDir, "ios-app", "MyApp.xcodeproj/")
+	createProject(t, tmpDir, "workspace", "Team.xcworkspace/", "Other.xcodeproj")
+	// A file named like a bundle shouldn't match a dir-only pattern
+	createProject(t, tmpDir, "not-a-bundle", "Fake.xcodeproj")
+	// Exact marker restricted to files: a directory named .project is ignored
+	createProject(t, tmpDir, "eclipse-dir", ".project/")
+	createProject(t, tmpDir, "eclipse-file", ".project")
+
+	cfg := &config.Config{
+		SearchPaths: []string{tmpDir},
+		Markers:     []string{"*.xcodeproj", "*.xcworkspace", ".project"},
+		MaxDepth:    3,
+		Excludes:    []string{},
+		MarkerTypes: map[string]string{
+			"*.xcodeproj":   config.MarkerTypeDir,
+			"*.xcworkspace": config.MarkerTypeAny,
+			".project":      config.MarkerTypeFile,
+		},
+		Priorities: map[string]int{
+			"*.xcworkspace": 12,
+			"*.xcodeproj":   10,
+		},
+	}
+
+	d := New(cfg, false)
+	projects, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	found := make(map[string]Project)
+	for _, p := range projects {
+		found[filepath.Base(p.Path)] = p
+	}
+
+	if len(found) != 3 {
+		t.Errorf("Discover() found %d projects, want 3", len(found))
+		for _, p := range projects {
+			t.Logf("  Found: %s (marker: %s)", p.Path, p.Marker)
+		}
+	}
+	if p, ok := found["ios-app"]; !ok || p.Priority != 10 {
+		t.Errorf("ios-app should match *.xcodeproj directory, got %+v", p)
+	}
+	if p, ok := found["workspace"]; !ok || p.Priority != 12 {
+		t.Errorf("workspace should match *.xcworkspace directory, got %+v", p)
+	}
+	if _, ok := found["not-a-bundle"]; ok {
+		t.Error("not-a-bundle should not match a dir-only marker")
+	}
+	if _, ok := found["eclipse-dir"]; ok {
+		t.Error("eclipse-dir should not match a file-only marker")
+	}
+	if _, ok := found["eclipse-file"]; !ok {
+		t.Error("eclipse-file should be discovered")
 	}
 }
 
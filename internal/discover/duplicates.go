@@ -0,0 +1,89 @@
+package discover
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DuplicateGroup is a set of projects that are clones of the same repository
+type DuplicateGroup struct {
+	Key      string    // Normalised host/owner/repo, or "root commit <id>" for clones without a remote
+	Projects []Project // Sorted by path
+}
+
+// FindDuplicates groups projects by their normalised git remote, and git projects
+// without a parseable remote by the root commit of their history. Linked worktrees
+// are listed alongside their repository but don't count as separate clones, so a
+// group is only reported when it contains at least two independent checkouts.
+func FindDuplicates(projects []Project) []DuplicateGroup {
+	byKey := make(map[string][]Project)
+	for _, p := range projects {
+		key := Remote{Host: p.Host, Owner: p.Owner, Repo: p.Repo}.Key()
+		if key == "" {
+			root := rootCommit(p.Path)
+			if root == "" {
+				continue
+			}
+			key = "root commit " + root
+		}
+		byKey[key] = append(byKey[key], p)
+	}
+
+	var groups []DuplicateGroup
+	for key, members := range byKey {
+		clones := 0
+		for _, p := range members {
+			if !p.IsWorktree {
+				clones++
+			}
+		}
+		if clones < 2 {
+			continue
+		}
+		sort.Slice(members, func(i, j int) bool {
+			return members[i].Path < members[j].Path
+		})
+		groups = append(groups, DuplicateGroup{Key: key, Projects: members})
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Key < groups[j].Key
+	})
+	return groups
+}
+
+// LastModified estimates when a checkout was last used from the git metadata git
+// updates on checkout, commit, staging and fetch. It falls back to the directory's
+// own modification time for non-git projects.
+func LastModified(dir string) time.Time {
+	var latest time.Time
+	consider := func(path string) {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	consider(dir)
+	if gitDir := resolveWorktreeGitDir(dir); gitDir != "" {
+		for _, name := range []string{"HEAD", "index", "FETCH_HEAD", "ORIG_HEAD"} {
+			consider(filepath.Join(gitDir, name))
+		}
+	}
+	return latest
+}
+
+// resolveWorktreeGitDir returns the git directory holding HEAD and index for dir,
+// which for linked worktrees is .git/worktrees/<name> rather than the common dir
+func resolveWorktreeGitDir(dir string) string {
+	gitPath := filepath.Join(dir, ".git")
+	info, err := os.Stat(gitPath)
+	if err != nil {
+		return ""
+	}
+	if info.IsDir() {
+		return gitPath
+	}
+	return readGitDirFile(gitPath)
+}
@@ -0,0 +1,95 @@
+package discover
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	projects := []Project{
+		{Path: "/code/pj", Host: "github.com", Owner: "josephschmitt", Repo: "pj"},
+		{Path: "/old/pj", Host: "GitHub.com", Owner: "JosephSchmitt", Repo: "pj"},
+		{Path: "/code/pj-feature", Host: "github.com", Owner: "josephschmitt", Repo: "pj", IsWorktree: true, WorktreeParent: "/code/pj"},
+		{Path: "/code/app", Host: "github.com", Owner: "me", Repo: "app"},
+		{Path: "/code/app-wt", Host: "github.com", Owner: "me", Repo: "app", IsWorktree: true, WorktreeParent: "/code/app"},
+		{Path: "/code/local-a", Repo: "local"},
+		{Path: "/code/local-b", Repo: "local"},
+	}
+
+	groups := FindDuplicates(projects)
+	if len(groups) != 1 {
+		t.Fatalf("FindDuplicates() returned %d groups, want 1: %+v", len(groups), groups)
+	}
+
+	g := groups[0]
+	if g.Key != "github.com/josephschmitt/pj" {
+		t.Errorf("group key = %q, want github.com/josephschmitt/pj", g.Key)
+	}
+	var paths []string
+	for _, p := range g.Projects {
+		paths = append(paths, p.Path)
+	}
+	expected := []string{"/code/pj", "/code/pj-feature", "/old/pj"}
+	if len(paths) != len(expected) {
+		t.Fatalf("group paths = %v, want %v", paths, expected)
+	}
+	for i := range expected {
+		if paths[i] != expected[i] {
+			t.Errorf("group paths = %v, want %v", paths, expected)
+			break
+		}
+	}
+}
+
+func TestFindDuplicatesByRootCommit(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Two clones without a remote share their root commit, though one has moved on
+	one := filepath.Join(tmpDir, "one")
+	root := writeLooseCommit(t, initGitRepo(t, one), "initial")
+	writeFile(t, filepath.Join(one, ".git", "refs", "heads", "main"), root+"\n")
+	two := filepath.Join(tmpDir, "two")
+	twoGitDir := initGitRepo(t, two)
+	writeLooseCommit(t, twoGitDir, "initial")
+	head := writeLooseCommit(t, twoGitDir, "second", root)
+	writeFile(t, filepath.Join(twoGitDir, "refs", "heads", "main"), head+"\n")
+
+	// A repository with another history and a directory that isn't one
+	other := filepath.Join(tmpDir, "other")
+	otherRoot := writeLooseCommit(t, initGitRepo(t, other), "something else")
+	writeFile(t, filepath.Join(other, ".git", "refs", "heads", "main"), otherRoot+"\n")
+	plain := createProject(t, tmpDir, "plain", "go.mod")
+
+	groups := FindDuplicates([]Project{{Path: one}, {Path: two}, {Path: other}, {Path: plain}})
+	if len(groups) != 1 {
+		t.Fatalf("FindDuplicates() returned %d groups, want 1: %+v", len(groups), groups)
+	}
+	if want := "root commit " + root; groups[0].Key != want {
+		t.Errorf("group key = %q, want %q", groups[0].Key, want)
+	}
+	if len(groups[0].Projects) != 2 || groups[0].Projects[0].Path != one || groups[0].Projects[1].Path != two {
+		t.Errorf("group projects = %+v, want %s and %s", groups[0].Projects, one, two)
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	tmpDir := t.TempDir()
+	repo := createProject(t, tmpDir, "repo", ".git/", ".git/HEAD", ".git/index")
+
+	old := time.Now().Add(-48 * time.Hour)
+	recent := time.Now().Add(-1 * time.Hour)
+	for _, path := range []string{repo, filepath.Join(repo, ".git"), filepath.Join(repo, ".git", "HEAD")} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(filepath.Join(repo, ".git", "index"), recent, recent); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := LastModified(repo); !got.Equal(recent) {
+		t.Errorf("LastModified() = %v, want index mtime %v", got, recent)
+	}
+}
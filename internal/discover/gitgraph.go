@@ -0,0 +1,149 @@
+package discover
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// graphParentNone marks a commit-graph entry without a parent
+const graphParentNone = 0x70000000
+
+// commitGraph holds the commit ids and first parents recorded in git's
+// commit-graph files, which git writes on gc, so a history can be walked without
+// reading every commit object
+type commitGraph struct {
+	layers []graphLayer // Base layer first
+	count  int          // Commits in all layers
+}
+
+// graphLayer is one commit-graph file. Positions in a split commit-graph count
+// the commits of the layers below first.
+type graphLayer struct {
+	fanout []byte // OIDF: cumulative counts by first id byte
+	ids    []byte // OIDL: sorted 20-byte ids
+	data   []byte // CDAT: tree id, first and second parent positions, generation and time
+	start  int    // Position of the layer's first commit
+	count  int
+}
+
+// readCommitGraph reads the commit-graph of an objects directory: the single
+// objects/info/commit-graph file, or else the layers listed in
+// objects/info/commit-graphs/commit-graph-chain. It returns nil if there is none
+// or it can't be read.
+func readCommitGraph(objectsDir string) *commitGraph {
+	files := []string{filepath.Join(objectsDir, "info", "commit-graph")}
+	if _, err := os.Stat(files[0]); err != nil {
+		chainDir := filepath.Join(objectsDir, "info", "commit-graphs")
+		chain, err := os.ReadFile(filepath.Join(chainDir, "commit-graph-chain"))
+		if err != nil {
+			return nil
+		}
+		files = nil
+		for _, hash := range strings.Fields(string(chain)) {
+			files = append(files, filepath.Join(chainDir, "graph-"+hash+".graph"))
+		}
+	}
+
+	g := &commitGraph{}
+	for _, file := range files {
+		layer, ok := readGraphLayer(file)
+		if !ok {
+			return nil
+		}
+		layer.start = g.count
+		g.layers = append(g.layers, layer)
+		g.count += layer.count
+	}
+	if g.count == 0 {
+		return nil
+	}
+	return g
+}
+
+// readGraphLayer reads the chunks of a SHA-1 commit-graph file that record ids and
+// parents
+func readGraphLayer(path string) (graphLayer, bool) {
+	data, err := os.ReadFile(path)
+	// Signature, version 1, hash version 1 (SHA-1), chunk count, base graph count
+	if err != nil || len(data) < 8 || !bytes.Equal(data[:4], []byte("CGPH")) || data[4] != 1 || data[5] != 1 {
+		return graphLayer{}, false
+	}
+
+	// The table of contents has an id and offset per chunk, then an end offset
+	chunks := int(data[6])
+	if len(data) < 8+(chunks+1)*12 {
+		return graphLayer{}, false
+	}
+	var layer graphLayer
+	for i := 0; i < chunks; i++ {
+		entry := data[8+i*12:]
+		start := binary.BigEndian.Uint64(entry[4:12])
+		end := binary.BigEndian.Uint64(entry[16:24])
+		if start > end || end > uint64(len(data)) {
+			return graphLayer{}, false
+		}
+		switch chunk := data[start:end]; string(entry[:4]) {
+		case "OIDF":
+			layer.fanout = chunk
+		case "OIDL":
+			layer.ids = chunk
+		case "CDAT":
+			layer.data = chunk
+		}
+	}
+
+	if len(layer.fanout) != 256*4 {
+		return graphLayer{}, false
+	}
+	layer.count = int(binary.BigEndian.Uint32(layer.fanout[255*4:]))
+	if len(layer.ids) != layer.count*20 || len(layer.data) != layer.count*36 {
+		return graphLayer{}, false
+	}
+	return layer, true
+}
+
+// find returns the position of the commit with the given hex id
+func (g *commitGraph) find(id string) (int, bool) {
+	raw, err := hex.DecodeString(id)
+	if err != nil || len(raw) != 20 {
+		return 0, false
+	}
+	for _, layer := range g.layers {
+		if i, ok := searchFanout(layer.fanout, layer.ids, raw); ok {
+			return layer.start + i, true
+		}
+	}
+	return 0, false
+}
+
+// root follows first parents from the commit at pos and returns the id of the
+// commit that has none, or "" if the graph is inconsistent
+func (g *commitGraph) root(pos int) string {
+	for steps := 0; steps <= g.count; steps++ {
+		layer := g.layer(pos)
+		if layer == nil {
+			return ""
+		}
+		i := pos - layer.start
+		parent := binary.BigEndian.Uint32(layer.data[i*36+20:])
+		if parent == graphParentNone {
+			return hex.EncodeToString(layer.ids[i*20 : (i+1)*20])
+		}
+		pos = int(parent)
+	}
+	return ""
+}
+
+// layer returns the layer holding the commit at pos
+func (g *commitGraph) layer(pos int) *graphLayer {
+	for i := range g.layers {
+		if l := &g.layers[i]; pos >= l.start && pos < l.start+l.count {
+			return l
+		}
+	}
+	return nil
+}
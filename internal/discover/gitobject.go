@@ -0,0 +1,548 @@
+package discover
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Git object types, as numbered in pack files
+const (
+	objCommit   = 1
+	objTree     = 2
+	objBlob     = 3
+	objTag      = 4
+	objOfsDelta = 6
+	objRefDelta = 7
+)
+
+// maxRefDepth limits how many symbolic refs resolveRef follows
+const maxRefDepth = 5
+
+// maxDeltaDepth limits delta chains, which git keeps far shorter by default
+const maxDeltaDepth = 4096
+
+// rootCommit returns the root commit reached from the HEAD of the checkout at dir
+// by following first parents, read from git's object database without invoking
+// git. Clones of the same repository share it whatever their remotes. It returns
+// "" if dir isn't a git checkout or its history can't be read to the root, as in
+// a shallow clone or a SHA-256 repository.
+func rootCommit(dir string) string {
+	gitDir := resolveWorktreeGitDir(dir)
+	commonDir := resolveGitDir(dir)
+	if gitDir == "" || commonDir == "" {
+		return ""
+	}
+	id := resolveRef(gitDir, commonDir, "HEAD")
+	if id == "" {
+		return ""
+	}
+
+	// Commits newer than the commit-graph are read from their objects until the walk
+	// reaches one the graph has. Shallow clones' graphs aren't used, as git doesn't.
+	var graph *commitGraph
+	if _, err := os.Stat(filepath.Join(commonDir, "shallow")); os.IsNotExist(err) {
+		graph = readCommitGraph(filepath.Join(commonDir, "objects"))
+	}
+	var objects *objectStore
+	for {
+		if graph != nil {
+			if pos, ok := graph.find(id); ok {
+				return graph.root(pos)
+			}
+		}
+		if objects == nil {
+			objects = openObjectStore(filepath.Join(commonDir, "objects"))
+			defer objects.close()
+		}
+		kind, data, err := objects.read(id)
+		if err != nil || kind != objCommit {
+			return ""
+		}
+		parent, ok := firstParent(data)
+		if !ok {
+			return id
+		}
+		id = parent
+	}
+}
+
+// resolveRef returns the object id a ref points to, following symbolic refs.
+// Per-worktree refs like HEAD live in gitDir, shared ones in commonDir, loose or
+// in packed-refs.
+func resolveRef(gitDir, commonDir, name string) string {
+	for depth := 0; depth < maxRefDepth; depth++ {
+		value := ""
+		for _, dir := range []string{gitDir, commonDir} {
+			if data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name))); err == nil {
+				value = strings.TrimSpace(string(data))
+				break
+			}
+		}
+		if value == "" {
+			value = readPackedRef(commonDir, name)
+		}
+
+		if target, ok := strings.CutPrefix(value, "ref: "); ok {
+			name = target
+			continue
+		}
+		if isObjectID(value) {
+			return value
+		}
+		return ""
+	}
+	return ""
+}
+
+// readPackedRef returns the object id of name in the repository's packed-refs
+func readPackedRef(commonDir, name string) string {
+	data, err := os.ReadFile(filepath.Join(commonDir, "packed-refs"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// Lines are "<id> <ref>"; "#" starts the header and "^" a peeled tag
+		id, ref, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if ok && ref == name {
+			return id
+		}
+	}
+	return ""
+}
+
+// isObjectID reports whether s is a hex SHA-1 object id
+func isObjectID(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// firstParent returns the first parent of a commit object's data
+func firstParent(commit []byte) (string, bool) {
+	for len(commit) > 0 {
+		line, rest, _ := bytes.Cut(commit, []byte("\n"))
+		if len(line) == 0 {
+			break // End of the headers
+		}
+		if id, ok := bytes.CutPrefix(line, []byte("parent ")); ok {
+			return string(id), true
+		}
+		commit = rest
+	}
+	return "", false
+}
+
+// maxObjectSize is the largest pack object read; commits are far smaller
+const maxObjectSize = 64 << 20
+
+// maxBaseCache bounds the bytes of delta bases an objectStore keeps resolved
+const maxBaseCache = 16 << 20
+
+// objectStore reads objects from a git objects directory, its pack files and the
+// object directories it borrows from (objects/info/alternates)
+type objectStore struct {
+	dirs  []string
+	packs []*packFile
+
+	// Resolved delta bases, so walking a history whose commits are deltas of each
+	// other doesn't resolve every delta chain from its start again
+	bases     map[packedRef]packedObject
+	baseBytes int
+
+	// Reused between objects, as each pack object is a separate zlib stream
+	buf *bufio.Reader
+	zr  io.ReadCloser
+}
+
+// packedRef is the location of an object in a pack
+type packedRef struct {
+	pack   *packFile
+	offset int64
+}
+
+// packedObject is a resolved pack object
+type packedObject struct {
+	kind int
+	data []byte
+}
+
+// packFile is a pack and its version 2 index
+type packFile struct {
+	f     *os.File
+	index []byte
+	count int
+}
+
+// openObjectStore opens the objects directory at dir. Unreadable packs are skipped.
+func openObjectStore(dir string) *objectStore {
+	s := &objectStore{dirs: []string{dir}, bases: make(map[packedRef]packedObject)}
+	if data, err := os.ReadFile(filepath.Join(dir, "info", "alternates")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if !filepath.IsAbs(line) {
+				line = filepath.Join(dir, line)
+			}
+			s.dirs = append(s.dirs, filepath.Clean(line))
+		}
+	}
+
+	for _, d := range s.dirs {
+		indexes, _ := filepath.Glob(filepath.Join(d, "pack", "pack-*.idx"))
+		for _, index := range indexes {
+			if p, err := openPack(index); err == nil {
+				s.packs = append(s.packs, p)
+			}
+		}
+	}
+	return s
+}
+
+// close closes the store's pack files
+func (s *objectStore) close() {
+	for _, p := range s.packs {
+		_ = p.f.Close()
+	}
+}
+
+// read returns the type and contents of the object with the given hex id
+func (s *objectStore) read(id string) (int, []byte, error) {
+	return s.readDepth(id, 0)
+}
+
+func (s *objectStore) readDepth(id string, depth int) (int, []byte, error) {
+	if !isObjectID(id) {
+		return 0, nil, fmt.Errorf("invalid object id %q", id)
+	}
+	// Most objects of an established repository are packed, so packs come first
+	raw, _ := hex.DecodeString(id)
+	if ref, ok := s.locate(raw); ok {
+		return s.readPacked(ref.pack, ref.offset, depth)
+	}
+	for _, dir := range s.dirs {
+		kind, data, err := readLooseObject(filepath.Join(dir, id[:2], id[2:]))
+		if !os.IsNotExist(err) {
+			return kind, data, err
+		}
+	}
+	return 0, nil, fmt.Errorf("object %s not found", id)
+}
+
+// locate returns where the object with the given raw id is in the store's packs
+func (s *objectStore) locate(id []byte) (packedRef, bool) {
+	for _, p := range s.packs {
+		if offset, ok := p.lookup(id); ok {
+			return packedRef{p, offset}, true
+		}
+	}
+	return packedRef{}, false
+}
+
+// readLooseObject reads a zlib-compressed "<type> <size>\x00<data>" object file
+func readLooseObject(path string) (int, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	header, data, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return 0, nil, errors.New("loose object without a header")
+	}
+	name, size, _ := strings.Cut(string(header), " ")
+	if strconv.Itoa(len(data)) != size {
+		return 0, nil, errors.New("loose object size mismatch")
+	}
+	switch name {
+	case "commit":
+		return objCommit, data, nil
+	case "tree":
+		return objTree, data, nil
+	case "blob":
+		return objBlob, data, nil
+	case "tag":
+		return objTag, data, nil
+	}
+	return 0, nil, fmt.Errorf("unknown object type %q", name)
+}
+
+// openPack opens the pack file of a version 2 pack index
+func openPack(indexPath string) (*packFile, error) {
+	index, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	// Magic, version, then a fan-out table of cumulative counts by first byte
+	if len(index) < 8+256*4 || !bytes.Equal(index[:8], []byte{0xff, 't', 'O', 'c', 0, 0, 0, 2}) {
+		return nil, errors.New("unsupported pack index")
+	}
+	count := int(binary.BigEndian.Uint32(index[8+255*4:]))
+	// Ids, CRCs and 32-bit offsets follow, then 64-bit offsets and two checksums
+	if len(index) < 8+256*4+count*(20+4+4)+2*20 {
+		return nil, errors.New("truncated pack index")
+	}
+
+	f, err := os.Open(strings.TrimSuffix(indexPath, ".idx") + ".pack")
+	if err != nil {
+		return nil, err
+	}
+	return &packFile{f: f, index: index, count: count}, nil
+}
+
+// lookup returns the offset of the object with the given raw id in the pack
+func (p *packFile) lookup(id []byte) (int64, bool) {
+	i, ok := searchFanout(p.index[8:8+256*4], p.index[8+256*4:8+256*4+p.count*20], id)
+	if !ok {
+		return 0, false
+	}
+
+	offsets := p.index[8+256*4+p.count*24:]
+	offset := binary.BigEndian.Uint32(offsets[i*4:])
+	if offset&0x80000000 == 0 {
+		return int64(offset), true
+	}
+	// The high bit marks an index into the table of 64-bit offsets
+	large := p.count*4 + int(offset&0x7fffffff)*8
+	if large+8 > len(offsets)-2*20 {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(offsets[large:])), true
+}
+
+// searchFanout returns the position of a raw id in a sorted table of ids, using a
+// fan-out table of cumulative counts by first byte the way pack indexes and
+// commit-graphs do
+func searchFanout(fanout, ids, id []byte) (int, bool) {
+	lo := 0
+	if id[0] > 0 {
+		lo = int(binary.BigEndian.Uint32(fanout[(int(id[0])-1)*4:]))
+	}
+	hi := int(binary.BigEndian.Uint32(fanout[int(id[0])*4:]))
+	if lo > hi || hi*20 > len(ids) {
+		return 0, false
+	}
+
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(ids[(lo+i)*20:(lo+i+1)*20], id) >= 0
+	})
+	if i == hi || !bytes.Equal(ids[i*20:(i+1)*20], id) {
+		return 0, false
+	}
+	return i, true
+}
+
+// readPacked reads the object at offset in a pack, applying deltas to their bases
+func (s *objectStore) readPacked(p *packFile, offset int64, depth int) (int, []byte, error) {
+	if depth > maxDeltaDepth {
+		return 0, nil, errors.New("delta chain too long")
+	}
+
+	// The header is the type and a variable-length size, followed for deltas by
+	// the base's relative offset or id, and then the zlib stream
+	r := s.reader(p.f, offset)
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	kind := int(c>>4) & 7
+	size := int64(c & 0x0f)
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if c, err = r.ReadByte(); err != nil || shift > 56 {
+			return 0, nil, errors.New("invalid pack object header")
+		}
+		size |= int64(c&0x7f) << shift
+	}
+
+	switch kind {
+	case objCommit, objTree, objBlob, objTag:
+		data, err := s.inflate(size)
+		return kind, data, err
+
+	case objOfsDelta:
+		// Big-endian base-128 with an implicit +1 per continuation byte
+		c, err := r.ReadByte()
+		relative := int64(c & 0x7f)
+		for err == nil && c&0x80 != 0 {
+			if c, err = r.ReadByte(); err == nil {
+				relative = (relative+1)<<7 | int64(c&0x7f)
+			}
+		}
+		if err != nil || relative <= 0 || relative > offset {
+			return 0, nil, errors.New("invalid delta base offset")
+		}
+		delta, err := s.inflate(size)
+		if err != nil {
+			return 0, nil, err
+		}
+		baseKind, base, err := s.readBase(packedRef{p, offset - relative}, depth+1)
+		if err != nil {
+			return 0, nil, err
+		}
+		data, err := applyDelta(base, delta)
+		return baseKind, data, err
+
+	case objRefDelta:
+		baseID := make([]byte, 20)
+		if _, err := io.ReadFull(r, baseID); err != nil {
+			return 0, nil, errors.New("invalid delta base id")
+		}
+		delta, err := s.inflate(size)
+		if err != nil {
+			return 0, nil, err
+		}
+		var baseKind int
+		var base []byte
+		if ref, ok := s.locate(baseID); ok {
+			baseKind, base, err = s.readBase(ref, depth+1)
+		} else {
+			baseKind, base, err = s.readDepth(hex.EncodeToString(baseID), depth+1)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		data, err := applyDelta(base, delta)
+		return baseKind, data, err
+	}
+	return 0, nil, fmt.Errorf("unknown pack object type %d", kind)
+}
+
+// readBase reads a pack object that's the base of a delta, from the cache of
+// resolved bases if it's there
+func (s *objectStore) readBase(ref packedRef, depth int) (int, []byte, error) {
+	if base, ok := s.bases[ref]; ok {
+		return base.kind, base.data, nil
+	}
+	kind, data, err := s.readPacked(ref.pack, ref.offset, depth)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if s.baseBytes+len(data) > maxBaseCache {
+		clear(s.bases)
+		s.baseBytes = 0
+	}
+	s.bases[ref] = packedObject{kind, data}
+	s.baseBytes += len(data)
+	return kind, data, nil
+}
+
+// reader returns the store's buffered reader positioned at offset in f
+func (s *objectStore) reader(f *os.File, offset int64) *bufio.Reader {
+	section := io.NewSectionReader(f, offset, 1<<62)
+	if s.buf == nil {
+		s.buf = bufio.NewReader(section)
+	} else {
+		s.buf.Reset(section)
+	}
+	return s.buf
+}
+
+// inflate decompresses the zlib stream that follows in the store's reader, which
+// must hold size bytes
+func (s *objectStore) inflate(size int64) ([]byte, error) {
+	if size > maxObjectSize {
+		return nil, errors.New("pack object too large")
+	}
+	var err error
+	if s.zr == nil {
+		s.zr, err = zlib.NewReader(s.buf)
+	} else {
+		err = s.zr.(zlib.Resetter).Reset(s.buf, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(s.zr, data); err != nil {
+		return nil, fmt.Errorf("pack object: %w", err)
+	}
+	return data, nil
+}
+
+// applyDelta rebuilds an object from its base and a git delta: the base and result
+// sizes, then instructions that either copy a range of the base or insert the
+// bytes that follow them
+func applyDelta(base, delta []byte) ([]byte, error) {
+	errInvalid := errors.New("invalid delta")
+
+	baseSize, n := binary.Uvarint(delta)
+	if n <= 0 || baseSize != uint64(len(base)) {
+		return nil, errInvalid
+	}
+	delta = delta[n:]
+	resultSize, n := binary.Uvarint(delta)
+	if n <= 0 {
+		return nil, errInvalid
+	}
+	delta = delta[n:]
+
+	var result []byte
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			// Bits 0-3 say which offset bytes follow, bits 4-6 which size bytes
+			var offset, size uint64
+			for bit := 0; bit < 7; bit++ {
+				if op&(1<<bit) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errInvalid
+				}
+				if bit < 4 {
+					offset |= uint64(delta[0]) << (8 * bit)
+				} else {
+					size |= uint64(delta[0]) << (8 * (bit - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, errInvalid
+			}
+			result = append(result, base[offset:offset+size]...)
+		case op != 0:
+			if int(op) > len(delta) {
+				return nil, errInvalid
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errInvalid
+		}
+	}
+	if uint64(len(result)) != resultSize {
+		return nil, errInvalid
+	}
+	return result, nil
+}
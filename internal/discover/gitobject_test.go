@@ -0,0 +1,505 @@
+package discover
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// emptyTree is the id of git's empty tree, which the test commits point to
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// objectID returns the id git gives an object of the given type and contents
+func objectID(kind string, data []byte) string {
+	sum := sha1.Sum(append([]byte(fmt.Sprintf("%s %d\x00", kind, len(data))), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+// compress returns data zlib-compressed
+func compress(t testing.TB, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// commitData returns the contents of a commit object with the given parents
+func commitData(message string, parents ...string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "tree %s\n", emptyTree)
+	for _, parent := range parents {
+		fmt.Fprintf(&buf, "parent %s\n", parent)
+	}
+	buf.WriteString("author A U Thor <author@example.com> 1700000000 +0000\n")
+	buf.WriteString("committer A U Thor <author@example.com> 1700000000 +0000\n")
+	fmt.Fprintf(&buf, "\n%s\n", message)
+	return buf.Bytes()
+}
+
+// writeLooseCommit writes a commit into gitDir's objects and returns its id
+func writeLooseCommit(t *testing.T, gitDir, message string, parents ...string) string {
+	t.Helper()
+	data := commitData(message, parents...)
+	id := objectID("commit", data)
+	path := filepath.Join(gitDir, "objects", id[:2], id[2:])
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	object := append([]byte(fmt.Sprintf("commit %d\x00", len(data))), data...)
+	if err := os.WriteFile(path, compress(t, object), 0444); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// initGitRepo creates an empty repository at dir with HEAD on main
+func initGitRepo(t testing.TB, dir string) string {
+	t.Helper()
+	gitDir := filepath.Join(dir, ".git")
+	for _, sub := range []string{"objects", "refs/heads"} {
+		if err := os.MkdirAll(filepath.Join(gitDir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(gitDir, "HEAD"), "ref: refs/heads/main\n")
+	return gitDir
+}
+
+// writeFile writes content to path
+func writeFile(t testing.TB, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRootCommit(t *testing.T) {
+	t.Run("loose history", func(t *testing.T) {
+		dir := t.TempDir()
+		gitDir := initGitRepo(t, dir)
+		root := writeLooseCommit(t, gitDir, "initial")
+		head := writeLooseCommit(t, gitDir, "third", writeLooseCommit(t, gitDir, "second", root))
+		writeFile(t, filepath.Join(gitDir, "refs", "heads", "main"), head+"\n")
+
+		if got := rootCommit(dir); got != root {
+			t.Errorf("rootCommit() = %q, want %q", got, root)
+		}
+	})
+
+	t.Run("packed ref", func(t *testing.T) {
+		dir := t.TempDir()
+		gitDir := initGitRepo(t, dir)
+		root := writeLooseCommit(t, gitDir, "initial")
+		head := writeLooseCommit(t, gitDir, "second", root)
+		writeFile(t, filepath.Join(gitDir, "packed-refs"), "# pack-refs with: peeled fully-peeled sorted\n"+head+" refs/heads/main\n")
+
+		if got := rootCommit(dir); got != root {
+			t.Errorf("rootCommit() = %q, want %q", got, root)
+		}
+	})
+
+	t.Run("merge follows the first parent", func(t *testing.T) {
+		dir := t.TempDir()
+		gitDir := initGitRepo(t, dir)
+		root := writeLooseCommit(t, gitDir, "initial")
+		other := writeLooseCommit(t, gitDir, "unrelated history")
+		head := writeLooseCommit(t, gitDir, "merge", root, other)
+		writeFile(t, filepath.Join(gitDir, "HEAD"), head+"\n") // Detached
+
+		if got := rootCommit(dir); got != root {
+			t.Errorf("rootCommit() = %q, want %q", got, root)
+		}
+	})
+
+	t.Run("linked worktree", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		main := filepath.Join(tmpDir, "main")
+		gitDir := initGitRepo(t, main)
+		root := writeLooseCommit(t, gitDir, "initial")
+		writeFile(t, filepath.Join(gitDir, "refs", "heads", "main"), root+"\n")
+		feature := writeLooseCommit(t, gitDir, "feature", root)
+		writeFile(t, filepath.Join(gitDir, "refs", "heads", "feature"), feature+"\n")
+
+		wt := filepath.Join(tmpDir, "wt")
+		wtGitDir := filepath.Join(gitDir, "worktrees", "wt")
+		for _, d := range []string{wt, wtGitDir} {
+			if err := os.MkdirAll(d, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		writeFile(t, filepath.Join(wt, ".git"), "gitdir: "+wtGitDir+"\n")
+		writeFile(t, filepath.Join(wtGitDir, "commondir"), "../..\n")
+		writeFile(t, filepath.Join(wtGitDir, "HEAD"), "ref: refs/heads/feature\n")
+
+		if got := rootCommit(wt); got != root {
+			t.Errorf("rootCommit() = %q, want %q", got, root)
+		}
+	})
+
+	t.Run("shallow clone", func(t *testing.T) {
+		dir := t.TempDir()
+		gitDir := initGitRepo(t, dir)
+		head := writeLooseCommit(t, gitDir, "second", "1111111111111111111111111111111111111111")
+		writeFile(t, filepath.Join(gitDir, "refs", "heads", "main"), head+"\n")
+
+		if got := rootCommit(dir); got != "" {
+			t.Errorf("rootCommit() = %q, want none for a cut-off history", got)
+		}
+	})
+
+	t.Run("unborn branch", func(t *testing.T) {
+		dir := t.TempDir()
+		initGitRepo(t, dir)
+		if got := rootCommit(dir); got != "" {
+			t.Errorf("rootCommit() = %q, want none", got)
+		}
+	})
+
+	t.Run("not a repository", func(t *testing.T) {
+		if got := rootCommit(t.TempDir()); got != "" {
+			t.Errorf("rootCommit() = %q, want none", got)
+		}
+	})
+}
+
+// packEntry is an object to write into a test pack: a full object, or a delta
+// against the entry at baseIndex (ofs) or the object baseID (ref)
+type packEntry struct {
+	kind      int
+	data      []byte // Object contents, or the delta
+	id        string // Id of the resulting object
+	baseIndex int
+	baseID    string
+}
+
+// writePack writes entries as a pack and version 2 index into gitDir's objects
+func writePack(t testing.TB, gitDir string, entries []packEntry) {
+	t.Helper()
+	var pack bytes.Buffer
+	pack.WriteString("PACK")
+	_ = binary.Write(&pack, binary.BigEndian, uint32(2))
+	_ = binary.Write(&pack, binary.BigEndian, uint32(len(entries)))
+
+	offsets := make([]int, len(entries))
+	for i, e := range entries {
+		offsets[i] = pack.Len()
+		size := len(e.data)
+		c := byte(e.kind<<4) | byte(size&0x0f)
+		size >>= 4
+		for size > 0 {
+			pack.WriteByte(c | 0x80)
+			c = byte(size & 0x7f)
+			size >>= 7
+		}
+		pack.WriteByte(c)
+
+		switch e.kind {
+		case objOfsDelta:
+			rel := offsets[i] - offsets[e.baseIndex]
+			encoded := []byte{byte(rel & 0x7f)}
+			for rel >>= 7; rel > 0; rel >>= 7 {
+				rel--
+				encoded = append([]byte{byte(0x80 | rel&0x7f)}, encoded...)
+			}
+			pack.Write(encoded)
+		case objRefDelta:
+			raw, _ := hex.DecodeString(e.baseID)
+			pack.Write(raw)
+		}
+		pack.Write(compress(t, e.data))
+	}
+	pack.Write(make([]byte, 20)) // Checksum, which isn't verified
+
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return entries[order[a]].id < entries[order[b]].id })
+
+	var index bytes.Buffer
+	index.Write([]byte{0xff, 't', 'O', 'c', 0, 0, 0, 2})
+	for b := 0; b < 256; b++ {
+		count := 0
+		for _, e := range entries {
+			raw, _ := hex.DecodeString(e.id)
+			if int(raw[0]) <= b {
+				count++
+			}
+		}
+		_ = binary.Write(&index, binary.BigEndian, uint32(count))
+	}
+	for _, i := range order {
+		raw, _ := hex.DecodeString(entries[i].id)
+		index.Write(raw)
+	}
+	index.Write(make([]byte, 4*len(entries))) // CRCs
+	for _, i := range order {
+		_ = binary.Write(&index, binary.BigEndian, uint32(offsets[i]))
+	}
+	index.Write(make([]byte, 40)) // Checksums
+
+	packDir := filepath.Join(gitDir, "objects", "pack")
+	if err := os.MkdirAll(packDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(packDir, "pack-test.pack"), pack.Bytes(), 0444); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(packDir, "pack-test.idx"), index.Bytes(), 0444); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRootCommitPacked(t *testing.T) {
+	dir := t.TempDir()
+	gitDir := initGitRepo(t, dir)
+
+	// The root is stored whole, and each later commit as a delta against the one
+	// before it, by offset and by id
+	root := commitData("initial")
+	second := commitData("second", objectID("commit", root))
+	third := commitData("third", objectID("commit", second))
+	entries := []packEntry{
+		{kind: objCommit, data: root, id: objectID("commit", root)},
+		{kind: objOfsDelta, data: makeDelta(root, second), id: objectID("commit", second), baseIndex: 0},
+		{kind: objRefDelta, data: makeDelta(second, third), id: objectID("commit", third), baseID: objectID("commit", second)},
+	}
+	writePack(t, gitDir, entries)
+	writeFile(t, filepath.Join(gitDir, "refs", "heads", "main"), objectID("commit", third)+"\n")
+
+	objects := openObjectStore(filepath.Join(gitDir, "objects"))
+	defer objects.close()
+	for _, want := range [][]byte{root, second, third} {
+		kind, data, err := objects.read(objectID("commit", want))
+		if err != nil || kind != objCommit || !bytes.Equal(data, want) {
+			t.Errorf("read() = %d, %q, %v, want commit %q", kind, data, err, want)
+		}
+	}
+
+	if got := rootCommit(dir); got != objectID("commit", root) {
+		t.Errorf("rootCommit() = %q, want %q", got, objectID("commit", root))
+	}
+}
+
+// makeDelta returns a git delta that copies the prefix target shares with base
+// and inserts the rest
+func makeDelta(base, target []byte) []byte {
+	prefix := 0
+	for prefix < len(base) && prefix < len(target) && base[prefix] == target[prefix] {
+		prefix++
+	}
+	out := binary.AppendUvarint(nil, uint64(len(base)))
+	out = binary.AppendUvarint(out, uint64(len(target)))
+	if prefix > 0 {
+		// Offset 0, two size bytes
+		out = append(out, 0x80|0x10|0x20, byte(prefix), byte(prefix>>8))
+	}
+	for rest := target[prefix:]; len(rest) > 0; {
+		n := min(len(rest), 127)
+		out = append(out, byte(n))
+		out = append(out, rest[:n]...)
+		rest = rest[n:]
+	}
+	return out
+}
+
+func TestApplyDelta(t *testing.T) {
+	base := []byte("hello world")
+	got, err := applyDelta(base, makeDelta(base, []byte("hello world!")))
+	if err != nil || string(got) != "hello world!" {
+		t.Errorf("applyDelta() = %q, %v, want %q", got, err, "hello world!")
+	}
+
+	for name, d := range map[string][]byte{
+		"wrong base size": makeDelta([]byte("hello"), []byte("hello!")),
+		"copy past base":  {11, 12, 0x80 | 0x01 | 0x10, 5, 10},
+		"short insert":    {11, 12, 5, 'a'},
+		"reserved op":     {11, 12, 0},
+		"wrong size":      {11, 1, 0x80 | 0x10, 2},
+	} {
+		if _, err := applyDelta(base, d); err == nil {
+			t.Errorf("applyDelta() with %s succeeded, want an error", name)
+		}
+	}
+}
+
+// writeCommitGraph writes a commit-graph layer to path holding commits, a map of
+// ids to their first parent ("" for none). lower holds the ids of the layers
+// below in position order; the returned ids extend it with this layer's.
+func writeCommitGraph(t testing.TB, path string, lower []string, commits map[string]string) []string {
+	t.Helper()
+	ids := make([]string, 0, len(commits))
+	for id := range commits {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	all := append(append([]string(nil), lower...), ids...)
+	position := make(map[string]int, len(all))
+	for i, id := range all {
+		position[id] = i
+	}
+
+	var fanout, oids, cdat bytes.Buffer
+	for b := 0; b < 256; b++ {
+		count := sort.Search(len(ids), func(i int) bool { return ids[i][:2] > fmt.Sprintf("%02x", b) })
+		_ = binary.Write(&fanout, binary.BigEndian, uint32(count))
+	}
+	for _, id := range ids {
+		raw, _ := hex.DecodeString(id)
+		oids.Write(raw)
+		tree, _ := hex.DecodeString(emptyTree)
+		cdat.Write(tree)
+		parent := uint32(graphParentNone)
+		if p := commits[id]; p != "" {
+			parent = uint32(position[p])
+		}
+		_ = binary.Write(&cdat, binary.BigEndian, parent)
+		_ = binary.Write(&cdat, binary.BigEndian, uint32(graphParentNone))
+		cdat.Write(make([]byte, 8)) // Generation and commit time
+	}
+
+	var graph bytes.Buffer
+	graph.Write([]byte{'C', 'G', 'P', 'H', 1, 1, 3, 0})
+	offset := uint64(8 + 4*12)
+	for _, chunk := range []struct {
+		id   string
+		data []byte
+	}{{"OIDF", fanout.Bytes()}, {"OIDL", oids.Bytes()}, {"CDAT", cdat.Bytes()}} {
+		graph.WriteString(chunk.id)
+		_ = binary.Write(&graph, binary.BigEndian, offset)
+		offset += uint64(len(chunk.data))
+	}
+	graph.Write(make([]byte, 4))
+	_ = binary.Write(&graph, binary.BigEndian, offset)
+	graph.Write(fanout.Bytes())
+	graph.Write(oids.Bytes())
+	graph.Write(cdat.Bytes())
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, graph.Bytes(), 0444); err != nil {
+		t.Fatal(err)
+	}
+	return all
+}
+
+func TestRootCommitGraph(t *testing.T) {
+	// The graph covers ids whose objects aren't written, so the root can only be
+	// found through it
+	root := objectID("commit", commitData("initial"))
+	second := objectID("commit", commitData("second", root))
+	third := objectID("commit", commitData("third", second))
+
+	t.Run("single file", func(t *testing.T) {
+		dir := t.TempDir()
+		gitDir := initGitRepo(t, dir)
+		writeCommitGraph(t, filepath.Join(gitDir, "objects", "info", "commit-graph"), nil,
+			map[string]string{root: "", second: root, third: second})
+		writeFile(t, filepath.Join(gitDir, "refs", "heads", "main"), third+"\n")
+
+		if got := rootCommit(dir); got != root {
+			t.Errorf("rootCommit() = %q, want %q", got, root)
+		}
+	})
+
+	t.Run("split chain with a newer commit", func(t *testing.T) {
+		dir := t.TempDir()
+		gitDir := initGitRepo(t, dir)
+		graphs := filepath.Join(gitDir, "objects", "info", "commit-graphs")
+		base := writeCommitGraph(t, filepath.Join(graphs, "graph-aaaa.graph"), nil, map[string]string{root: ""})
+		writeCommitGraph(t, filepath.Join(graphs, "graph-bbbb.graph"), base, map[string]string{second: root, third: second})
+		writeFile(t, filepath.Join(graphs, "commit-graph-chain"), "aaaa\nbbbb\n")
+		head := writeLooseCommit(t, gitDir, "fourth", third)
+		writeFile(t, filepath.Join(gitDir, "refs", "heads", "main"), head+"\n")
+
+		if got := rootCommit(dir); got != root {
+			t.Errorf("rootCommit() = %q, want %q", got, root)
+		}
+	})
+
+	t.Run("ignored in a shallow clone", func(t *testing.T) {
+		dir := t.TempDir()
+		gitDir := initGitRepo(t, dir)
+		writeCommitGraph(t, filepath.Join(gitDir, "objects", "info", "commit-graph"), nil,
+			map[string]string{root: "", second: root})
+		head := writeLooseCommit(t, gitDir, "third", second)
+		writeFile(t, filepath.Join(gitDir, "refs", "heads", "main"), head+"\n")
+		writeFile(t, filepath.Join(gitDir, "shallow"), second+"\n")
+
+		if got := rootCommit(dir); got != "" {
+			t.Errorf("rootCommit() = %q, want none for a cut-off history", got)
+		}
+	})
+
+	t.Run("corrupt graph", func(t *testing.T) {
+		dir := t.TempDir()
+		gitDir := initGitRepo(t, dir)
+		if err := os.MkdirAll(filepath.Join(gitDir, "objects", "info"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(gitDir, "objects", "info", "commit-graph"), "CGPH\x01\x01\x03\x00")
+		head := writeLooseCommit(t, gitDir, "second", writeLooseCommit(t, gitDir, "initial"))
+		writeFile(t, filepath.Join(gitDir, "refs", "heads", "main"), head+"\n")
+
+		if got, want := rootCommit(dir), objectID("commit", commitData("initial")); got != want {
+			t.Errorf("rootCommit() = %q, want %q", got, want)
+		}
+	})
+}
+
+// BenchmarkRootCommit walks a packed history in which commits are deltas against
+// their parents in chains of git's default depth, the way gc stores a linear
+// history
+func BenchmarkRootCommit(b *testing.B) {
+	const commits, depth = 5000, 50
+	dir := b.TempDir()
+	gitDir := initGitRepo(b, dir)
+
+	entries := make([]packEntry, 0, commits)
+	parents := make(map[string]string, commits)
+	var prev []byte
+	var head string
+	for i := 0; i < commits; i++ {
+		var data []byte
+		if i == 0 {
+			data = commitData("commit 0")
+		} else {
+			data = commitData(fmt.Sprintf("commit %d", i), head)
+		}
+		if i%depth == 0 {
+			entries = append(entries, packEntry{kind: objCommit, data: data, id: objectID("commit", data)})
+		} else {
+			entries = append(entries, packEntry{kind: objOfsDelta, data: makeDelta(prev, data), id: objectID("commit", data), baseIndex: i - 1})
+		}
+		parents[objectID("commit", data)] = head
+		prev, head = data, objectID("commit", data)
+	}
+	writePack(b, gitDir, entries)
+	writeFile(b, filepath.Join(gitDir, "refs", "heads", "main"), head+"\n")
+	root := entries[0].id
+
+	run := func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if got := rootCommit(dir); got != root {
+				b.Fatalf("rootCommit() = %q, want %q", got, root)
+			}
+		}
+	}
+	b.Run("objects", run)
+	writeCommitGraph(b, filepath.Join(gitDir, "objects", "info", "commit-graph"), nil, parents)
+	b.Run("commit-graph", run)
+}
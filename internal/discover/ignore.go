@@ -20,6 +20,7 @@ type ignoreEntry struct {
 	depth   int
 	matcher *ignore.GitIgnore
 	dir     string
+	file    string
 }
 
 // NewIgnoreStack creates a new ignore stack.
@@ -53,6 +54,7 @@ func (is *IgnoreStack) Enter(dir string, depth int) error {
 				depth:   depth,
 				matcher: matcher,
 				dir:     dir,
+				file:    ignoreFilePath,
 			})
 		}
 	}
@@ -72,6 +74,17 @@ func (is *IgnoreStack) Leave(depth int) {
 	}
 }
 
+// Loaded returns the ignore files that were loaded when entering dir.
+func (is *IgnoreStack) Loaded(dir string) []string {
+	var files []string
+	for _, entry := range is.stack {
+		if entry.dir == dir {
+			files = append(files, entry.file)
+		}
+	}
+	return files
+}
+
 // ShouldIgnore checks if a path should be ignored based on active ignore rules.
 // path should be an absolute path, and isDir indicates if it's a directory.
 func (is *IgnoreStack) ShouldIgnore(path string, isDir bool) bool {
@@ -0,0 +1,241 @@
+package discover
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/josephschmitt/pj/internal/config"
+)
+
+// WalkState records what the walk of one search root found and which paths the
+// result depends on, so that an expired cache can be revalidated by re-walking only
+// the subtrees that changed instead of the whole root
+type WalkState struct {
+	Root     string        `json:"root"`
+	Projects []WalkProject `json:"projects"`
+	Watched  []WatchedPath `json:"watched"`
+}
+
+// WalkProject is a project found during a walk
+type WalkProject struct {
+	Project
+	Origin string `json:"origin"` // Directory whose visit emitted the project (the repo for linked worktrees)
+}
+
+// WatchedPath is a path whose modification time the walk result depends on.
+// Directory mtimes change whenever an entry is added, removed or renamed, which
+// covers markers appearing or disappearing. Files whose contents matter, like
+// .gitignore and .git/config, are watched too since editing them in place doesn't
+// touch their directory.
+type WatchedPath struct {
+	Path    string `json:"path"`
+	ModTime int64  `json:"mtime"`         // UnixNano, or 0 if the path didn't exist
+	Dir     string `json:"dir,omitempty"` // Subtree to re-walk when Path changes, if not Path itself
+}
+
+// subtree returns the directory to re-walk when the watched path changes
+func (w WatchedPath) subtree() string {
+	if w.Dir != "" {
+		return w.Dir
+	}
+	return w.Path
+}
+
+// changed reports whether the path's modification time differs from the recorded one
+func (w WatchedPath) changed() bool {
+	return modTime(w.Path) != w.ModTime
+}
+
+// modTime returns the modification time of path in nanoseconds, or 0 if it can't be read
+func modTime(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.ModTime().UnixNano()
+}
+
+// walkRecorder collects the projects and watched paths of a single root's walk
+type walkRecorder struct {
+	state WalkState
+}
+
+// emit records a project found while visiting source
+func (r *walkRecorder) emit(p Project, source string) {
+	r.state.Projects = append(r.state.Projects, WalkProject{Project: p, Origin: source})
+}
+
+// watch records path's current modification time; dir is the subtree that depends on it
+func (r *walkRecorder) watch(path, dir string) {
+	r.watchTime(path, dir, modTime(path))
+}
+
+// watchExisting records path like watch, if it exists. Files that only matter when
+// present don't need watching otherwise, since creating one changes its directory's
+// mtime.
+func (r *walkRecorder) watchExisting(path, dir string) {
+	if mtime := modTime(path); mtime != 0 {
+		r.watchTime(path, dir, mtime)
+	}
+}
+
+// watchDir records a visited directory using the info the walk already has
+func (r *walkRecorder) watchDir(path string, entry fs.DirEntry) {
+	info, err := entry.Info()
+	if err != nil {
+		r.watch(path, path)
+		return
+	}
+	r.watchTime(path, path, info.ModTime().UnixNano())
+}
+
+func (r *walkRecorder) watchTime(path, dir string, mtime int64) {
+	if dir == path {
+		dir = ""
+	}
+	r.state.Watched = append(r.state.Watched, WatchedPath{Path: path, ModTime: mtime, Dir: dir})
+}
+
+// watchProject records the files a project's annotations were read from, which
+// can change without their directory's mtime changing
+func (d *Discoverer) watchProject(rec *walkRecorder, p Project) {
+	if gitDir := resolveGitDir(p.Path); gitDir != "" {
+		rec.watch(filepath.Join(gitDir, "config"), p.Path)
+	}
+	if d.config.Worktrees && !p.IsWorktree && p.VCS == "git" {
+		rec.watch(filepath.Join(p.Path, ".git", "worktrees"), p.Path)
+	}
+}
+
+// watchPathMarkers records the existing directories each path marker's leading
+// segments can match below dir, since files appearing deeper down don't change
+// dir's own mtime. Changes to any of them re-walk dir.
+func (d *Discoverer) watchPathMarkers(rec *walkRecorder, dir string) {
+	for _, marker := range d.config.Markers {
+		if !isPathMarker(marker) {
+			continue
+		}
+		segments := strings.Split(filepath.ToSlash(filepath.Clean(marker)), "/")
+		watchMarkerDirs(rec, dir, dir, segments[:len(segments)-1])
+	}
+}
+
+// watchMarkerDirs records the directories below current that segments match,
+// expanding glob segments like matchPathSegments
+func watchMarkerDirs(rec *walkRecorder, dir, current string, segments []string) {
+	if len(segments) == 0 {
+		return
+	}
+
+	// Entries appearing in current change its mtime, which is already watched
+	paths := []string{filepath.Join(current, segments[0])}
+	if config.IsPatternMarker(segments[0]) {
+		entries, err := os.ReadDir(current)
+		if err != nil {
+			return
+		}
+		paths = paths[:0]
+		for _, entry := range entries {
+			if matched, _ := filepath.Match(segments[0], entry.Name()); matched {
+				paths = append(paths, filepath.Join(current, entry.Name()))
+			}
+		}
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		rec.watchTime(path, dir, info.ModTime().UnixNano())
+		watchMarkerDirs(rec, dir, path, segments[1:])
+	}
+}
+
+// revalidate brings a previous walk of a root up to date. Only watched paths are
+// stat-ed; the subtrees that depend on changed paths are re-walked and spliced into
+// the previous result, which gives the same projects as walking the whole root.
+func (d *Discoverer) revalidate(previous WalkState) WalkState {
+	var changed []string
+	for _, w := range previous.Watched {
+		if w.changed() {
+			changed = append(changed, w.subtree())
+		}
+	}
+
+	if len(changed) == 0 {
+		if d.verbose {
+			fmt.Fprintf(os.Stderr, "Unchanged since last walk: %s\n", previous.Root)
+		}
+		return previous
+	}
+
+	focus := outermostPaths(changed)
+	if d.verbose {
+		fmt.Fprintf(os.Stderr, "Re-walking %d changed subtree(s) of %s\n", len(focus), previous.Root)
+	}
+	fresh := d.walkPath(previous.Root, focus)
+
+	state := WalkState{Root: previous.Root}
+	for _, p := range previous.Projects {
+		if !withinAny(p.Origin, focus) {
+			state.Projects = append(state.Projects, p)
+		}
+	}
+	state.Projects = append(state.Projects, fresh.Projects...)
+	for _, w := range previous.Watched {
+		if !withinAny(w.subtree(), focus) {
+			state.Watched = append(state.Watched, w)
+		}
+	}
+	state.Watched = append(state.Watched, fresh.Watched...)
+	return state
+}
+
+// outermostPaths removes duplicates and any path nested inside another path in the list
+func outermostPaths(paths []string) []string {
+	var result []string
+	for _, p := range paths {
+		if !withinAny(p, result) {
+			kept := result[:0]
+			for _, r := range result {
+				if !within(r, p) {
+					kept = append(kept, r)
+				}
+			}
+			result = append(kept, p)
+		}
+	}
+	return result
+}
+
+// within reports whether path is dir or lies underneath it
+func within(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, string(os.PathSeparator))+string(os.PathSeparator))
+}
+
+// withinAny reports whether path is within any of dirs
+func withinAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if within(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// aboveAny reports whether path is a strict ancestor of any of dirs
+func aboveAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path != dir && within(dir, path) {
+			return true
+		}
+	}
+	return false
+}
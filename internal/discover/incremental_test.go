@@ -0,0 +1,282 @@
+package discover
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/josephschmitt/pj/internal/config"
+)
+
+// loaderFor returns a WalkLoader that treats every given state as stale
+func loaderFor(states []WalkState) WalkLoader {
+	return func(root string) (WalkState, bool, bool) {
+		for _, state := range states {
+			if state.Root == root {
+				return state, true, false
+			}
+		}
+		return WalkState{}, false, false
+	}
+}
+
+// touch bumps a path's mtime so changes are detected regardless of filesystem timestamp granularity
+func touch(t *testing.T, path string) {
+	t.Helper()
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiscoverIncremental(t *testing.T) {
+	newConfig := func(root string) *config.Config {
+		return &config.Config{
+			SearchPaths: []string{root},
+			Markers:     []string{".git", "go.mod", "package.json"},
+			Priorities:  map[string]int{".git": 1, "go.mod": 10, "package.json": 7},
+			MaxDepth:    4,
+			Excludes:    []string{".git", "node_modules"},
+			Nested:      true,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(t *testing.T, root string)
+	}{
+		{
+			name:   "nothing changed",
+			mutate: func(t *testing.T, root string) {},
+		},
+		{
+			name: "project added in nested directory",
+			mutate: func(t *testing.T, root string) {
+				createProject(t, filepath.Join(root, "group"), "new", "go.mod")
+				touch(t, filepath.Join(root, "group"))
+			},
+		},
+		{
+			name: "project removed",
+			mutate: func(t *testing.T, root string) {
+				if err := os.RemoveAll(filepath.Join(root, "group", "old")); err != nil {
+					t.Fatal(err)
+				}
+				touch(t, filepath.Join(root, "group"))
+			},
+		},
+		{
+			name: "marker added to existing project",
+			mutate: func(t *testing.T, root string) {
+				createProject(t, root, "app", "go.mod")
+				touch(t, filepath.Join(root, "app"))
+			},
+		},
+		{
+			name: "gitignore edited in place",
+			mutate: func(t *testing.T, root string) {
+				ignoreFile := filepath.Join(root, "app", ".gitignore")
+				if err := os.WriteFile(ignoreFile, []byte("lib/\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				touch(t, ignoreFile)
+			},
+		},
+		{
+			name: "git remote changed",
+			mutate: func(t *testing.T, root string) {
+				gitConfig := filepath.Join(root, "app", ".git", "config")
+				content := "[remote \"origin\"]\n\turl = git@github.com:me/renamed.git\n"
+				if err := os.WriteFile(gitConfig, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+				touch(t, gitConfig)
+			},
+		},
+		{
+			name: "pj.yaml edited in place",
+			mutate: func(t *testing.T, root string) {
+				localFile := filepath.Join(root, "app", ".pj.yaml")
+				if err := os.WriteFile(localFile, []byte("description: Renamed\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				touch(t, localFile)
+			},
+		},
+		{
+			name: "pj.yaml excludes added above projects",
+			mutate: func(t *testing.T, root string) {
+				if err := os.WriteFile(filepath.Join(root, "group", ".pj.yaml"), []byte("excludes: [old]\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				touch(t, filepath.Join(root, "group"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			app := createProject(t, root, "app", ".git/", "package.json", ".gitignore")
+			createProject(t, app, "lib", "go.mod")
+			if err := os.WriteFile(filepath.Join(app, ".git", "config"), []byte("[remote \"origin\"]\n\turl = git@github.com:me/app.git\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(app, ".pj.yaml"), []byte("description: App\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			createProject(t, filepath.Join(root, "group"), "old", "package.json")
+			createProject(t, root, "plain", ".git/")
+
+			before, walks, err := New(newConfig(root), false).DiscoverIncremental(nil)
+			if err != nil {
+				t.Fatalf("DiscoverIncremental(nil) error = %v", err)
+			}
+
+			tt.mutate(t, root)
+
+			got, _, err := New(newConfig(root), false).DiscoverIncremental(loaderFor(walks))
+			if err != nil {
+				t.Fatalf("DiscoverIncremental(previous) error = %v", err)
+			}
+			want, err := New(newConfig(root), false).Discover()
+			if err != nil {
+				t.Fatalf("Discover() error = %v", err)
+			}
+
+			if unchanged := reflect.DeepEqual(before, want); unchanged != (tt.name == "nothing changed") {
+				t.Fatalf("mutation changed results = %v, test setup is wrong", !unchanged)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("incremental result differs from full walk\ngot:  %+v\nwant: %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDiscoverIncrementalPathMarkerGlob(t *testing.T) {
+	newConfig := func(root string) *config.Config {
+		return &config.Config{
+			SearchPaths: []string{root},
+			Markers:     []string{".git", "*/build.gradle", ".github/*/ci.yml"},
+			Priorities:  map[string]int{".git": 1, "*/build.gradle": 10, ".github/*/ci.yml": 5},
+			MaxDepth:    3,
+		}
+	}
+
+	// Files appearing below a directory a glob segment matches don't change the
+	// project directory's mtime
+	for marker, file := range map[string]string{
+		"*/build.gradle":   filepath.Join("app", "build.gradle"),
+		".github/*/ci.yml": filepath.Join(".github", "workflows", "ci.yml"),
+	} {
+		t.Run(marker, func(t *testing.T) {
+			root := t.TempDir()
+			proj := createProject(t, root, "proj", ".git/")
+			path := filepath.Join(proj, file)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			_, walks, err := New(newConfig(root), false).DiscoverIncremental(nil)
+			if err != nil {
+				t.Fatalf("DiscoverIncremental(nil) error = %v", err)
+			}
+
+			writeFile(t, path, "")
+			touch(t, filepath.Dir(path))
+
+			got, _, err := New(newConfig(root), false).DiscoverIncremental(loaderFor(walks))
+			if err != nil {
+				t.Fatalf("DiscoverIncremental(previous) error = %v", err)
+			}
+			want, err := New(newConfig(root), false).Discover()
+			if err != nil {
+				t.Fatalf("Discover() error = %v", err)
+			}
+			if len(want) != 1 || want[0].Marker != marker {
+				t.Fatalf("Discover() = %+v, want proj with marker %s", want, marker)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("incremental result differs from full walk\ngot:  %+v\nwant: %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDiscoverIncrementalNewRoot(t *testing.T) {
+	first := t.TempDir()
+	second := t.TempDir()
+	createProject(t, first, "a", "go.mod")
+	createProject(t, second, "b", "go.mod")
+
+	cfg := &config.Config{SearchPaths: []string{first}, Markers: []string{"go.mod"}, MaxDepth: 3}
+	_, walks, err := New(cfg, false).DiscoverIncremental(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg = &config.Config{SearchPaths: []string{first, second}, Markers: []string{"go.mod"}, MaxDepth: 3}
+	projects, walks, err := New(cfg, false).DiscoverIncremental(loaderFor(walks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 2 || len(walks) != 2 {
+		t.Errorf("got %d projects from %d roots, want 2 from 2", len(projects), len(walks))
+	}
+}
+
+func TestDiscoverIncrementalFreshState(t *testing.T) {
+	root := t.TempDir()
+	createProject(t, root, "on-disk", "go.mod")
+
+	// A fresh state is trusted as-is, so a project only it knows about is reported
+	cached := WalkState{
+		Root:     root,
+		Projects: []WalkProject{{Project: Project{Path: filepath.Join(root, "cached"), Marker: "go.mod"}, Origin: filepath.Join(root, "cached")}},
+	}
+	load := func(r string) (WalkState, bool, bool) {
+		return cached, r == root, true
+	}
+
+	cfg := &config.Config{SearchPaths: []string{root}, Markers: []string{"go.mod"}, MaxDepth: 3}
+	projects, updated, err := New(cfg, false).DiscoverIncremental(load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 1 || projects[0].Path != filepath.Join(root, "cached") {
+		t.Errorf("projects = %+v, want only the cached project", projects)
+	}
+	if len(updated) != 0 {
+		t.Errorf("updated = %d states, want none for a fresh state", len(updated))
+	}
+}
+
+func TestOutermostPaths(t *testing.T) {
+	sep := string(os.PathSeparator)
+	a := sep + "a"
+	ab := filepath.Join(a, "b")
+	abc := filepath.Join(ab, "c")
+	ax := sep + "ax"
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{name: "nested after parent", paths: []string{a, ab, abc}, want: []string{a}},
+		{name: "parent after nested", paths: []string{abc, ab}, want: []string{ab}},
+		{name: "sibling prefix isn't nested", paths: []string{a, ax}, want: []string{a, ax}},
+		{name: "duplicates", paths: []string{ab, ab}, want: []string{ab}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := outermostPaths(tt.paths); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("outermostPaths(%v) = %v, want %v", tt.paths, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package discover
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// localFileName is the file a directory uses to describe itself to pj
+const localFileName = ".pj.yaml"
+
+// localConfig holds the settings of a directory's .pj.yaml. The display settings
+// apply when the directory is a project; excludes and max_depth apply to the
+// subtree below it.
+type localConfig struct {
+	Name        string   `yaml:"name"`
+	Icon        string   `yaml:"icon"`
+	Color       string   `yaml:"color"`
+	Label       string   `yaml:"label"`
+	Tags        []string `yaml:"tags"`
+	Description string   `yaml:"description"`
+	Hidden      bool     `yaml:"hidden"`
+
+	Excludes []string `yaml:"excludes"`  // Added to the configured excludes
+	MaxDepth *int     `yaml:"max_depth"` // Levels below this directory to search
+}
+
+// readLocalConfig reads dir's .pj.yaml. It returns nil without an error if there
+// is none.
+func readLocalConfig(dir string) (*localConfig, error) {
+	data, err := os.ReadFile(filepath.Join(dir, localFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	local := &localConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(local); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(dir, localFileName), err)
+	}
+	if local.MaxDepth != nil && *local.MaxDepth < 0 {
+		return nil, fmt.Errorf("%s: max_depth can't be negative", filepath.Join(dir, localFileName))
+	}
+	return local, nil
+}
+
+// loadLocalConfig reads dir's .pj.yaml, reporting a file that can't be read in
+// verbose mode
+func (d *Discoverer) loadLocalConfig(dir string) *localConfig {
+	local, err := readLocalConfig(dir)
+	if err != nil && d.verbose {
+		fmt.Fprintf(os.Stderr, "Ignoring %v\n", err)
+	}
+	return local
+}
+
+// apply sets the project's display settings from its .pj.yaml
+func (l *localConfig) apply(p *Project) {
+	if l == nil {
+		return
+	}
+	p.Name = l.Name
+	p.Icon = l.Icon
+	p.Color = l.Color
+	p.Label = l.Label
+	p.Tags = l.Tags
+	p.Description = l.Description
+	p.Hidden = l.Hidden
+}
+
+// walkScope is the depth limit and excludes in effect below a directory whose
+// .pj.yaml changes them
+type walkScope struct {
+	depth    int // Walk depth of the directory
+	maxDepth int
+	excludes []string
+}
+
+// below returns the walk scope below the directory at depth, given the scope in
+// effect at the directory and its .pj.yaml, and whether the .pj.yaml changed it
+func (s walkScope) below(depth int, local *localConfig) (walkScope, bool) {
+	if local == nil || (local.MaxDepth == nil && len(local.Excludes) == 0) {
+		return s, false
+	}
+	scope := walkScope{depth: depth, maxDepth: s.maxDepth, excludes: s.excludes}
+	if local.MaxDepth != nil {
+		scope.maxDepth = depth + *local.MaxDepth
+	}
+	if len(local.Excludes) > 0 {
+		scope.excludes = append(s.excludes[:len(s.excludes):len(s.excludes)], local.Excludes...)
+	}
+	return scope, true
+}
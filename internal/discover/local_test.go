@@ -0,0 +1,152 @@
+package discover
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/josephschmitt/pj/internal/config"
+)
+
+// writeLocalConfig writes a .pj.yaml into dir
+func writeLocalConfig(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, localFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadLocalConfig(t *testing.T) {
+	depth := 1
+	tests := []struct {
+		name    string
+		content string // Empty means no .pj.yaml
+		want    *localConfig
+		wantErr string
+	}{
+		{name: "missing", want: nil},
+		{name: "empty", content: "\n", want: &localConfig{}},
+		{
+			name:    "project settings",
+			content: "name: API\nicon: A\ncolor: red\nlabel: svc\ntags: [work]\ndescription: The API\nhidden: true\n",
+			want:    &localConfig{Name: "API", Icon: "A", Color: "red", Label: "svc", Tags: []string{"work"}, Description: "The API", Hidden: true},
+		},
+		{
+			name:    "subtree settings",
+			content: "excludes: [fixtures]\nmax_depth: 1\n",
+			want:    &localConfig{Excludes: []string{"fixtures"}, MaxDepth: &depth},
+		},
+		{name: "unknown field", content: "nmae: API\n", wantErr: "field nmae not found"},
+		{name: "invalid yaml", content: "tags: [work\n", wantErr: ".pj.yaml: yaml:"},
+		{name: "negative depth", content: "max_depth: -1\n", wantErr: "max_depth can't be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.content != "" {
+				writeLocalConfig(t, dir, tt.content)
+			}
+
+			got, err := readLocalConfig(dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("readLocalConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readLocalConfig() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readLocalConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverLocalConfig(t *testing.T) {
+	root := t.TempDir()
+
+	api := createProject(t, root, "api", "go.mod")
+	writeLocalConfig(t, api, "name: API\nicon: A\ncolor: red\ndescription: The API\ntags: [work]\n")
+	secret := createProject(t, root, "secret", ".git/")
+	writeLocalConfig(t, secret, "hidden: true\n")
+	pinnedSecret := createProject(t, root, "pinned-secret", ".git/")
+	writeLocalConfig(t, pinnedSecret, "hidden: true\nname: Pinned\nlabel: private\n")
+	broken := createProject(t, root, "broken", ".git/")
+	writeLocalConfig(t, broken, "name: [Broken\n")
+
+	// A directory above projects limits the depth and adds excludes for its subtree
+	vendor := filepath.Join(root, "vendor")
+	if err := os.MkdirAll(vendor, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeLocalConfig(t, vendor, "max_depth: 1\nexcludes: [fixtures]\n")
+	shallow := createProject(t, vendor, "lib", "go.mod")
+	createProject(t, filepath.Join(vendor, "group"), "deep", "go.mod")
+	createProject(t, vendor, "fixtures", "go.mod")
+	fixtures := createProject(t, root, "fixtures", "go.mod") // Outside the subtree
+
+	cfg := &config.Config{
+		SearchPaths: []string{root},
+		Markers:     []string{".git", "go.mod"},
+		MaxDepth:    3,
+		Excludes:    []string{},
+		Projects:    []config.PinnedProject{{Path: pinnedSecret, Name: "Mine"}},
+	}
+
+	projects, err := New(cfg, false).Discover()
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	found := make(map[string]Project)
+	var paths []string
+	for _, p := range projects {
+		found[p.Path] = p
+		paths = append(paths, p.Path)
+	}
+	want := []string{api, broken, fixtures, pinnedSecret, shallow}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("Discover() = %v, want %v", paths, want)
+	}
+
+	if p := found[api]; p.Name != "API" || p.Icon != "A" || p.Color != "red" || p.Description != "The API" || !reflect.DeepEqual(p.Tags, []string{"work"}) {
+		t.Errorf("api = %+v, want the overrides from its .pj.yaml", p)
+	}
+	// The pin's settings win over the .pj.yaml's, and pinning shows a hidden project
+	if p := found[pinnedSecret]; p.Name != "Mine" || p.Label != "private" || !p.IsPinned {
+		t.Errorf("pinned-secret = %+v, want the pin's name over its .pj.yaml's", p)
+	}
+	if p := found[broken]; p.Name != "" {
+		t.Errorf("broken = %+v, want an unreadable .pj.yaml ignored", p)
+	}
+}
+
+func TestDiscoverLocalConfigListed(t *testing.T) {
+	root := t.TempDir()
+	api := createProject(t, root, "api", "go.mod")
+	writeLocalConfig(t, api, "description: The API\nicon: A\n")
+	secret := createProject(t, root, "secret", "go.mod")
+	writeLocalConfig(t, secret, "hidden: true\n")
+
+	cfg := &config.Config{
+		Markers:  []string{"go.mod"},
+		MaxDepth: 3,
+		Sources:  []config.SourceConfig{{Name: "list", Type: config.SourceList, Paths: []string{api, secret}}},
+	}
+
+	projects, err := New(cfg, false).Discover()
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	if len(projects) != 1 || projects[0].Path != api {
+		t.Fatalf("Discover() = %+v, want only api", projects)
+	}
+	if p := projects[0]; p.Description != "The API" || p.Icon != "A" || p.Source != "list" {
+		t.Errorf("api = %+v, want a listed project with its .pj.yaml overrides", p)
+	}
+}
@@ -0,0 +1,235 @@
+package discover
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Remote holds a git remote URL and the host/owner/repo parsed from it
+type Remote struct {
+	URL   string
+	Host  string
+	Owner string
+	Repo  string
+}
+
+// Key returns a normalised "host/owner/repo" identifier that is the same for the
+// SSH and HTTPS forms of a URL, or "" if the URL couldn't be parsed
+func (r Remote) Key() string {
+	if r.Host == "" || r.Repo == "" {
+		return ""
+	}
+	return strings.ToLower(r.Host + "/" + r.Owner + "/" + r.Repo)
+}
+
+// ParseRemoteURL splits a git remote URL into host, owner and repo. It understands
+// scp-style SSH (git@host:owner/repo.git), ssh://, git://, http(s):// URLs with
+// optional user info and ports, and nested owners such as GitLab subgroups.
+// Credentials are removed from the URL it keeps, since it ends up in the cache and
+// in JSON output.
+func ParseRemoteURL(raw string) Remote {
+	remote := Remote{URL: stripCredentials(raw)}
+	url := strings.TrimSpace(raw)
+
+	var host, path string
+	if i := strings.Index(url, "://"); i >= 0 {
+		rest := url[i+3:]
+		slash := strings.Index(rest, "/")
+		if slash < 0 {
+			return remote
+		}
+		host, path = rest[:slash], rest[slash+1:]
+	} else if colon := strings.Index(url, ":"); colon > 1 && !strings.Contains(url[:colon], "/") {
+		// scp-style: [user@]host:path (colon > 1 keeps Windows drive letters local)
+		host, path = url[:colon], url[colon+1:]
+	} else {
+		return remote // Local path
+	}
+
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	if colon := strings.Index(host, ":"); colon >= 0 {
+		host = host[:colon]
+	}
+
+	path = strings.Trim(path, "/")
+	path = strings.TrimSuffix(path, ".git")
+	if host == "" || path == "" {
+		return remote
+	}
+
+	remote.Host = host
+	if slash := strings.LastIndex(path, "/"); slash >= 0 {
+		remote.Owner = path[:slash]
+		remote.Repo = path[slash+1:]
+	} else {
+		remote.Repo = path
+	}
+	return remote
+}
+
+// stripCredentials removes the password from a URL's user info, and for http(s)
+// URLs the whole user info, which is often a token. The user of ssh:// and
+// scp-style URLs (git@...) is only a login name, so it's kept.
+func stripCredentials(url string) string {
+	i := strings.Index(url, "://")
+	if i < 0 {
+		return url
+	}
+	authority := url[i+3:]
+	if slash := strings.Index(authority, "/"); slash >= 0 {
+		authority = authority[:slash]
+	}
+	at := strings.LastIndex(authority, "@")
+	if at < 0 {
+		return url
+	}
+
+	userinfo, rest := authority[:at], url[i+3+at+1:]
+	switch scheme := strings.ToLower(url[:i]); {
+	case scheme == "http" || scheme == "https":
+		return url[:i+3] + rest
+	case strings.Contains(userinfo, ":"):
+		user, _, _ := strings.Cut(userinfo, ":")
+		return url[:i+3] + user + "@" + rest
+	}
+	return url
+}
+
+// readGitRemote returns the origin remote (or the first remote if there is no
+// origin) for the repository at dir, reading .git/config directly without
+// invoking git. Worktrees are followed to their parent repository's config.
+func readGitRemote(dir string) (Remote, bool) {
+	gitDir := resolveGitDir(dir)
+	if gitDir == "" {
+		return Remote{}, false
+	}
+
+	remotes := parseGitConfigRemotes(filepath.Join(gitDir, "config"))
+	if len(remotes) == 0 {
+		return Remote{}, false
+	}
+	for _, r := range remotes {
+		if r.name == "origin" {
+			return ParseRemoteURL(r.url), true
+		}
+	}
+	return ParseRemoteURL(remotes[0].url), true
+}
+
+// applyGitRemote fills in the project's remote fields from its git config, if any
+func applyGitRemote(p *Project) {
+	remote, ok := readGitRemote(p.Path)
+	if !ok {
+		return
+	}
+	p.RemoteURL = remote.URL
+	p.Host = remote.Host
+	p.Owner = remote.Owner
+	p.Repo = remote.Repo
+}
+
+// resolveGitDir returns the common git directory for a repository or worktree at dir
+func resolveGitDir(dir string) string {
+	gitPath := filepath.Join(dir, ".git")
+	info, err := os.Stat(gitPath)
+	if err != nil {
+		return ""
+	}
+	if info.IsDir() {
+		return gitPath
+	}
+
+	gitDir := readGitDirFile(gitPath)
+	if gitDir == "" {
+		return ""
+	}
+
+	// Linked worktrees share config with the main repository via commondir
+	if common, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir := strings.TrimSpace(string(common))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+		return filepath.Clean(commonDir)
+	}
+	return gitDir
+}
+
+// readGitDirFile reads a worktree or submodule .git file ("gitdir: <path>") and
+// returns the absolute git directory it points to, or "" if it isn't one
+func readGitDirFile(gitFilePath string) string {
+	data, err := os.ReadFile(gitFilePath)
+	if err != nil {
+		return ""
+	}
+	line := strings.TrimSpace(strings.SplitN(string(data), "\n", 2)[0])
+	if !strings.HasPrefix(line, "gitdir: ") {
+		return ""
+	}
+	gitDir := strings.TrimPrefix(line, "gitdir: ")
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(gitFilePath), gitDir)
+	}
+	return filepath.Clean(gitDir)
+}
+
+// gitConfigRemote is a [remote "name"] section from a git config file
+type gitConfigRemote struct {
+	name string
+	url  string
+}
+
+// parseGitConfigRemotes reads the url of each [remote "name"] section, in file order
+func parseGitConfigRemotes(configPath string) []gitConfigRemote {
+	f, err := os.Open(configPath)
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+
+	var remotes []gitConfigRemote
+	current := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			current = ""
+			section := strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+			fields := strings.SplitN(section, " ", 2)
+			if len(fields) == 2 && strings.EqualFold(fields[0], "remote") {
+				current = strings.Trim(strings.TrimSpace(fields[1]), `"`)
+			}
+			continue
+		}
+
+		if current == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), "url") {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+
+		// Only the first url of a remote is used for fetching
+		seen := false
+		for _, r := range remotes {
+			if r.name == current {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			remotes = append(remotes, gitConfigRemote{name: current, url: value})
+		}
+	}
+	return remotes
+}
@@ -0,0 +1,243 @@
+package discover
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/josephschmitt/pj/internal/config"
+)
+
+// defaultSourceTimeout bounds how long a command source may run
+const defaultSourceTimeout = 30 * time.Second
+
+// Source lists project directories from somewhere other than a filesystem walk.
+// Walk sources aren't Sources: their paths are walked with the search paths, so
+// they share the per-root walk cache.
+type Source interface {
+	Name() string
+	List() ([]Listed, error)
+}
+
+// Listed is a project directory reported by a source, with optional overrides like
+// those of a pinned project
+type Listed struct {
+	Path   string   `json:"path"`
+	Name   string   `json:"name,omitempty"`
+	Marker string   `json:"marker,omitempty"`
+	Label  string   `json:"label,omitempty"`
+	Icon   string   `json:"icon,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// NewSource returns the Source for a configured list or command source, or nil for
+// a walk source
+func NewSource(cfg config.SourceConfig) Source {
+	switch cfg.Type {
+	case config.SourceList:
+		return listSource{name: cfg.Name, paths: cfg.Paths}
+	case config.SourceCommand:
+		timeout := defaultSourceTimeout
+		if cfg.Timeout > 0 {
+			timeout = time.Duration(cfg.Timeout) * time.Second
+		}
+		return commandSource{name: cfg.Name, command: cfg.Command, timeout: timeout}
+	}
+	return nil
+}
+
+// listSource uses the directories in its config as projects
+type listSource struct {
+	name  string
+	paths []string
+}
+
+func (s listSource) Name() string { return s.name }
+
+func (s listSource) List() ([]Listed, error) {
+	var listed []Listed
+	for _, path := range s.paths {
+		for _, expanded := range config.ExpandSearchPath(path) {
+			listed = append(listed, Listed{Path: expanded})
+		}
+	}
+	return listed, nil
+}
+
+// commandSource runs a command and uses the projects it prints: one path per line,
+// or JSON (see parseListed)
+type commandSource struct {
+	name    string
+	command string
+	timeout time.Duration
+}
+
+func (s commandSource) Name() string { return s.name }
+
+func (s commandSource) List() ([]Listed, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", s.command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", s.command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// Don't wait for children of the shell that outlive it to close its output
+	cmd.WaitDelay = time.Second
+
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%s: timed out after %v", s.command, s.timeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", s.command, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", s.command, err)
+	}
+	return parseListed(out)
+}
+
+// parseListed parses a command's output. Output starting with [ or { is JSON: a
+// sequence of values that are each a path, an object with a path and optional
+// name, marker, label, icon and tags, an array of those, or an object with them
+// under "projects" (like pj --json). Anything else is one path per line.
+func parseListed(out []byte) ([]Listed, error) {
+	trimmed := bytes.TrimSpace(out)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+
+	if trimmed[0] != '[' && trimmed[0] != '{' {
+		var listed []Listed
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				listed = append(listed, Listed{Path: line})
+			}
+		}
+		return listed, scanner.Err()
+	}
+
+	var listed []Listed
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); errors.Is(err, io.EOF) {
+			return listed, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid JSON output: %w", err)
+		}
+		items, err := decodeListed(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON output: %w", err)
+		}
+		listed = append(listed, items...)
+	}
+}
+
+// decodeListed decodes one JSON value of a command's output
+func decodeListed(value json.RawMessage) ([]Listed, error) {
+	switch value[0] {
+	case '"':
+		var path string
+		if err := json.Unmarshal(value, &path); err != nil {
+			return nil, err
+		}
+		return []Listed{{Path: path}}, nil
+	case '[':
+		var items []json.RawMessage
+		if err := json.Unmarshal(value, &items); err != nil {
+			return nil, err
+		}
+		return decodeAllListed(items)
+	case '{':
+		var object struct {
+			Listed
+			Projects []json.RawMessage `json:"projects"`
+		}
+		if err := json.Unmarshal(value, &object); err != nil {
+			return nil, err
+		}
+		if object.Projects != nil {
+			return decodeAllListed(object.Projects)
+		}
+		if object.Path == "" {
+			return nil, fmt.Errorf("project object without a path: %s", value)
+		}
+		return []Listed{object.Listed}, nil
+	}
+	return nil, fmt.Errorf("unexpected value %s", value)
+}
+
+// decodeAllListed decodes the elements of a JSON array
+func decodeAllListed(items []json.RawMessage) ([]Listed, error) {
+	var listed []Listed
+	for _, item := range items {
+		l, err := decodeListed(item)
+		if err != nil {
+			return nil, err
+		}
+		listed = append(listed, l...)
+	}
+	return listed, nil
+}
+
+// addSources merges the projects listed by the configured list and command
+// sources. Sources that fail are skipped. Directories that were already discovered,
+// pinned or listed by an earlier source keep those details.
+func (d *Discoverer) addSources(projects []Project) []Project {
+	index := make(map[string]bool, len(projects))
+	for _, p := range projects {
+		index[p.Path] = true
+	}
+
+	for _, cfg := range d.config.Sources {
+		source := NewSource(cfg)
+		if source == nil {
+			continue
+		}
+		listed, err := source.List()
+		if err != nil {
+			if d.verbose {
+				fmt.Fprintf(os.Stderr, "Skipping source %s: %v\n", source.Name(), err)
+			}
+			continue
+		}
+
+		for _, l := range listed {
+			path, err := filepath.Abs(config.ExpandPath(l.Path))
+			if err != nil || index[path] {
+				continue
+			}
+			if info, err := os.Stat(path); err != nil || !info.IsDir() {
+				if d.verbose {
+					fmt.Fprintf(os.Stderr, "Skipping %s project %s: not a directory\n", source.Name(), l.Path)
+				}
+				continue
+			}
+
+			project := d.newProject(path)
+			project.Source = source.Name()
+			d.override(&project, l.Marker, l.Name, l.Label, l.Icon, l.Tags)
+			projects = append(projects, project)
+			index[path] = true
+		}
+	}
+
+	return projects
+}
@@ -0,0 +1,162 @@
+package discover
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/josephschmitt/pj/internal/config"
+)
+
+func TestParseListed(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []Listed
+		wantErr bool
+	}{
+		{name: "empty", output: "\n", want: nil},
+		{name: "lines", output: "/src/a\n\n  /src/b  \n", want: []Listed{{Path: "/src/a"}, {Path: "/src/b"}}},
+		{name: "array of paths", output: `["/src/a", "/src/b"]`, want: []Listed{{Path: "/src/a"}, {Path: "/src/b"}}},
+		{
+			name:   "array of objects",
+			output: `[{"path": "/src/a", "name": "A", "marker": "go.mod", "tags": ["work"]}, "/src/b"]`,
+			want:   []Listed{{Path: "/src/a", Name: "A", Marker: "go.mod", Tags: []string{"work"}}, {Path: "/src/b"}},
+		},
+		{
+			name:   "json lines",
+			output: "{\"path\": \"/src/a\", \"icon\": \"X\"}\n{\"path\": \"/src/b\", \"label\": \"infra\"}\n",
+			want:   []Listed{{Path: "/src/a", Icon: "X"}, {Path: "/src/b", Label: "infra"}},
+		},
+		{
+			name:   "pj json output",
+			output: `{"projects": [{"path": "/src/a", "name": "a", "marker": ".git", "markerLabel": "git", "vcs": "git"}]}`,
+			want:   []Listed{{Path: "/src/a", Name: "a", Marker: ".git"}},
+		},
+		{name: "object without path", output: `{"name": "a"}`, wantErr: true},
+		{name: "invalid json", output: `[{"path": "/src/a"`, wantErr: true},
+		{name: "number", output: `[1]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseListed([]byte(tt.output))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseListed() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseListed() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseListed() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh commands")
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		timeout int
+		want    []Listed
+		wantErr string
+	}{
+		{name: "paths", command: "printf '/src/a\\n/src/b\\n'", want: []Listed{{Path: "/src/a"}, {Path: "/src/b"}}},
+		{name: "failure", command: "echo 'not logged in' >&2; exit 3", wantErr: "not logged in"},
+		{name: "timeout", command: "sleep 5", timeout: 1, wantErr: "timed out"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewSource(config.SourceConfig{Name: "cmd", Type: config.SourceCommand, Command: tt.command, Timeout: tt.timeout})
+			got, err := source.List()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("List() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("List() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverSources(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh commands")
+	}
+	searchDir := t.TempDir()
+	workDir := t.TempDir()
+	outsideDir := t.TempDir()
+
+	app := createProject(t, searchDir, "app", "go.mod")
+	api := createProject(t, workDir, "api", ".git/")
+	infra := createProject(t, outsideDir, "infra", ".git/")
+	tools := createProject(t, outsideDir, "tools") // No marker
+	remote := createProject(t, outsideDir, "remote", "go.mod")
+
+	listFile := filepath.Join(outsideDir, "projects.json")
+	listJSON := `[{"path": "` + remote + `", "name": "remote", "tags": ["ops"]}, {"path": "` + app + `", "name": "ignored"}, "` + filepath.Join(outsideDir, "missing") + `"]`
+	if err := os.WriteFile(listFile, []byte(listJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		SearchPaths: []string{searchDir},
+		Markers:     []string{".git", "go.mod"},
+		MaxDepth:    3,
+		Excludes:    []string{},
+		Sources: []config.SourceConfig{
+			{Name: "work", Type: config.SourceWalk, Paths: []string{workDir, searchDir}},
+			{Name: "infra", Type: config.SourceList, Paths: []string{infra, tools}},
+			{Name: "remote", Type: config.SourceCommand, Command: "cat " + listFile},
+			{Name: "broken", Type: config.SourceCommand, Command: "exit 1"},
+		},
+	}
+
+	projects, err := New(cfg, false).Discover()
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	found := make(map[string]Project)
+	for _, p := range projects {
+		found[p.Path] = p
+	}
+	if len(projects) != 5 {
+		t.Fatalf("Discover() = %v, want app, api, infra, tools and remote", found)
+	}
+
+	// The search path is also a path of the work source; it stays untagged
+	if p := found[app]; p.Source != "" || p.Name != "" {
+		t.Errorf("app = %+v, want the search path project without a source", p)
+	}
+	if p := found[api]; p.Source != "work" || p.Marker != ".git" {
+		t.Errorf("api = %+v, want a project walked from the work source", p)
+	}
+	if p := found[infra]; p.Source != "infra" || p.Marker != ".git" || p.VCS != "git" {
+		t.Errorf("infra = %+v, want a listed project with a detected marker", p)
+	}
+	if p := found[tools]; p.Source != "infra" || p.Marker != "" {
+		t.Errorf("tools = %+v, want a listed project without a marker", p)
+	}
+	if p := found[remote]; p.Source != "remote" || p.Name != "remote" || p.Marker != "go.mod" || len(p.Tags) != 1 {
+		t.Errorf("remote = %+v, want a command project with its overrides", p)
+	}
+}
@@ -0,0 +1,43 @@
+package discover
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// vcsMarkers maps the metadata each version control system keeps at the root of a
+// checkout to the name reported in Project.VCS, in detection order. Jujutsu comes
+// before git so colocated jj repositories (which also contain .git) report "jj".
+var vcsMarkers = []struct {
+	entry string
+	vcs   string
+}{
+	{".jj", "jj"},
+	{".git", "git"},
+	{".hg", "hg"},
+	// Fossil's checkout database. A repository is a "*.fossil" file usually kept
+	// outside the checkout, and ~/.fossil holds the user's settings, so neither
+	// marks a checkout.
+	{".fslckout", "fossil"},
+	{"_FOSSIL_", "fossil"},
+	{".pijul", "pijul"},
+	{".svn", "svn"},
+}
+
+// DetectVCS returns the version control system managing dir ("jj", "git", "hg",
+// "fossil", "pijul" or "svn"), or "" if dir isn't the root of a checkout
+func DetectVCS(dir string) string {
+	for _, m := range vcsMarkers {
+		if _, err := os.Lstat(filepath.Join(dir, m.entry)); err == nil {
+			return m.vcs
+		}
+	}
+	return ""
+}
+
+// annotateProject fills in the fields that describe a project's checkout rather
+// than the marker that found it: its VCS and git remote
+func annotateProject(p *Project) {
+	p.VCS = DetectVCS(p.Path)
+	applyGitRemote(p)
+}
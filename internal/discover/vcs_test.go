@@ -0,0 +1,81 @@
+package discover
+
+import (
+	"testing"
+
+	"github.com/josephschmitt/pj/internal/config"
+)
+
+func TestDetectVCS(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    string
+	}{
+		{name: "git", entries: []string{".git/"}, want: "git"},
+		{name: "git worktree file", entries: []string{".git"}, want: "git"},
+		{name: "jujutsu colocated", entries: []string{".jj/", ".git/"}, want: "jj"},
+		{name: "mercurial", entries: []string{".hg/"}, want: "hg"},
+		{name: "fossil", entries: []string{".fslckout"}, want: "fossil"},
+		{name: "fossil windows", entries: []string{"_FOSSIL_"}, want: "fossil"},
+		{name: "fossil settings", entries: []string{".fossil"}, want: ""},
+		{name: "pijul", entries: []string{".pijul/"}, want: "pijul"},
+		{name: "svn", entries: []string{".svn/"}, want: "svn"},
+		{name: "none", entries: []string{"go.mod"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := createProject(t, t.TempDir(), "repo", tt.entries...)
+			if got := DetectVCS(dir); got != tt.want {
+				t.Errorf("DetectVCS() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverVCSIndependentOfMarker(t *testing.T) {
+	tmpDir := t.TempDir()
+	hgGo := createProject(t, tmpDir, "hg-go", ".hg/", "go.mod")
+	svnOnly := createProject(t, tmpDir, "svn-only", ".svn/")
+	plain := createProject(t, tmpDir, "plain", "go.mod")
+
+	cfg := &config.Config{
+		SearchPaths: []string{tmpDir},
+		Markers:     []string{".git", ".hg", ".svn", "go.mod"},
+		Priorities:  map[string]int{".git": 1, ".hg": 1, ".svn": 1, "go.mod": 10},
+		MaxDepth:    3,
+		Excludes:    []string{".hg", ".svn"},
+	}
+
+	d := New(cfg, false)
+	projects, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	found := make(map[string]Project)
+	for _, p := range projects {
+		found[p.Path] = p
+	}
+
+	tests := []struct {
+		path       string
+		wantMarker string
+		wantVCS    string
+	}{
+		{hgGo, "go.mod", "hg"},
+		{svnOnly, ".svn", "svn"},
+		{plain, "go.mod", ""},
+	}
+	for _, tt := range tests {
+		p, ok := found[tt.path]
+		if !ok {
+			t.Errorf("project %s not found", tt.path)
+			continue
+		}
+		if p.Marker != tt.wantMarker || p.VCS != tt.wantVCS {
+			t.Errorf("%s: marker=%q vcs=%q, want marker=%q vcs=%q", tt.path, p.Marker, p.VCS, tt.wantMarker, tt.wantVCS)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Package editors reads the projects recently opened in editors (VS Code, JetBrains
+// IDEs, Zed and Neovim), so discovery can include projects outside the search paths.
+package editors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Recent is a path an editor recently opened
+type Recent struct {
+	Path string
+	File bool // A file rather than a project folder; it stands for the checkout containing it
+}
+
+// Editor reads one editor's recently opened paths
+type Editor struct {
+	Name string
+	// Files returns the editor's state files that exist, possibly one per
+	// installed edition or version
+	Files func() []string
+	// Read parses one state file
+	Read func(path string) ([]Recent, error)
+}
+
+// Editors lists the supported editors by the names used in the editor_recents config
+var Editors = map[string]Editor{
+	"vscode":    {Name: "vscode", Files: vscodeFiles, Read: readVSCode},
+	"jetbrains": {Name: "jetbrains", Files: jetbrainsFiles, Read: readJetBrains},
+	"zed":       {Name: "zed", Files: zedFiles, Read: readZed},
+	"neovim":    {Name: "neovim", Files: neovimFiles, Read: readNeovim},
+}
+
+// Recents returns the recent paths of an editor from all of its state files. An
+// editor that isn't installed has none. Files that can't be parsed are reported in
+// the error, alongside whatever the other files listed.
+func (e Editor) Recents() ([]Recent, error) {
+	var recents []Recent
+	var errs []error
+	for _, path := range e.Files() {
+		r, err := e.Read(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		recents = append(recents, r...)
+	}
+	return recents, errors.Join(errs...)
+}
+
+// existing returns the paths that exist, expanding glob patterns
+func existing(patterns ...string) []string {
+	var paths []string
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+// readJSON decodes the JSON file at path into v
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// fileURIPath converts a file:// URI to a local path. Other schemes (remote
+// workspaces, untitled buffers) have no local path.
+func fileURIPath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" || u.Path == "" {
+		return "", false
+	}
+	path := u.Path
+	if runtime.GOOS == "windows" {
+		// file:///c:/src/app
+		path = strings.TrimPrefix(path, "/")
+	}
+	return filepath.FromSlash(path), true
+}
+
+// configDir returns the platform's per-user config directory, where VS Code and
+// the JetBrains IDEs keep their state
+func configDir() string {
+	dir, _ := os.UserConfigDir()
+	return dir
+}
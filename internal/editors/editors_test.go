@@ -0,0 +1,261 @@
+package editors
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// testdata/state.vscdb and testdata/zed.sqlite were created with the sqlite3 shell
+// using the schemas those editors create. testdata/zed-old.sqlite has the schema
+// of Zed versions that stored workspace folders as bincode in local_paths.
+// testdata/zed-wal.sqlite is zed.sqlite in WAL mode with one more workspace that
+// was only committed to zed-wal.sqlite-wal, as while Zed is running.
+
+func TestReadVSCodeState(t *testing.T) {
+	recents, err := readVSCode(filepath.Join("testdata", "state.vscdb"))
+	if err != nil {
+		t.Fatalf("readVSCode() error = %v", err)
+	}
+	want := []Recent{
+		{Path: filepath.FromSlash("/home/me/src/app")},
+		{Path: filepath.FromSlash("/home/me/src/lib/main.go"), File: true},
+		{Path: filepath.FromSlash("/home/me/My Projects/site")},
+	}
+	if runtime.GOOS != "windows" && !reflect.DeepEqual(recents, want) {
+		t.Errorf("readVSCode() = %v, want %v", recents, want)
+	}
+}
+
+func TestReadVSCodeStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.json")
+	storage := `{
+		"theme": "vs-dark",
+		"openedPathsList": {
+			"workspaces3": ["file:///home/me/src/app", {"id": "1a2b", "configURIPath": "file:///home/me/app.code-workspace"}],
+			"files2": ["file:///home/me/notes/todo.md"]
+		}
+	}`
+	if err := os.WriteFile(path, []byte(storage), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	recents, err := readVSCode(path)
+	if err != nil {
+		t.Fatalf("readVSCode() error = %v", err)
+	}
+	want := []Recent{
+		{Path: filepath.FromSlash("/home/me/src/app")},
+		{Path: filepath.FromSlash("/home/me/notes/todo.md"), File: true},
+	}
+	if runtime.GOOS != "windows" && !reflect.DeepEqual(recents, want) {
+		t.Errorf("readVSCode() = %v, want %v", recents, want)
+	}
+}
+
+func TestReadJetBrains(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	path := filepath.Join(t.TempDir(), "recentProjects.xml")
+	xml := `<application>
+  <component name="RecentProjectsManager">
+    <option name="additionalInfo">
+      <map>
+        <entry key="$USER_HOME$/src/app">
+          <value>
+            <RecentProjectMetaInfo frameTitle="app">
+              <option name="build" value="GO-241.14494.240" />
+              <option name="projectOpenTimestamp" value="1718000000000" />
+            </RecentProjectMetaInfo>
+          </value>
+        </entry>
+        <entry key="/opt/shared/tools" />
+        <entry key="$APPLICATION_CONFIG_DIR$/scratches" />
+      </map>
+    </option>
+    <option name="recentPaths">
+      <list>
+        <option value="$USER_HOME$/src/legacy" />
+      </list>
+    </option>
+    <option name="lastProjectLocation" value="$USER_HOME$/src" />
+  </component>
+</application>`
+	if err := os.WriteFile(path, []byte(xml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	recents, err := readJetBrains(path)
+	if err != nil {
+		t.Fatalf("readJetBrains() error = %v", err)
+	}
+	want := []Recent{
+		{Path: filepath.Join(home, "src", "app")},
+		{Path: filepath.FromSlash("/opt/shared/tools")},
+		{Path: filepath.Join(home, "src", "legacy")},
+	}
+	if !reflect.DeepEqual(recents, want) {
+		t.Errorf("readJetBrains() = %v, want %v", recents, want)
+	}
+
+	if err := os.WriteFile(path, []byte("<application><component>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readJetBrains(path); err == nil {
+		t.Error("readJetBrains() of truncated XML should fail")
+	}
+}
+
+func TestReadZed(t *testing.T) {
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{"zed.sqlite", []string{"/home/me/src/app", "/home/me/src/web", "/home/me/src/api"}},
+		{"zed-old.sqlite", []string{"/home/me/src/app", "/home/me/src/docs"}},
+		{"zed-wal.sqlite", []string{"/home/me/src/app", "/home/me/src/web", "/home/me/src/api", "/home/me/src/new"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			recents, err := readZed(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatalf("readZed() error = %v", err)
+			}
+			var got []string
+			for _, r := range recents {
+				if r.File {
+					t.Errorf("readZed() returned file %s", r.Path)
+				}
+				got = append(got, r.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readZed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// shadaEntry encodes a shada entry with the given type and msgpack data
+func shadaEntry(kind byte, data []byte) []byte {
+	b := []byte{kind, 0xce, 0x66, 0x6a, 0x3c, 0x00} // type, uint32 timestamp
+	if len(data) < 0x80 {
+		b = append(b, byte(len(data)))
+	} else {
+		b = append(b, 0xcd, byte(len(data)>>8), byte(len(data)))
+	}
+	return append(b, data...)
+}
+
+// msgpackStr encodes a string as fixstr or str 8
+func msgpackStr(s string) []byte {
+	if len(s) < 32 {
+		return append([]byte{0xa0 | byte(len(s))}, s...)
+	}
+	return append([]byte{0xd9, byte(len(s))}, s...)
+}
+
+// shadaMark encodes a mark's data: a map with the file name, line and mark name
+func shadaMark(file string) []byte {
+	b := []byte{0x83}
+	b = append(b, msgpackStr("f")...)
+	b = append(b, msgpackStr(file)...)
+	b = append(b, msgpackStr("l")...)
+	b = append(b, 0xcd, 0x01, 0x2c) // uint16 300
+	b = append(b, msgpackStr("n")...)
+	return append(b, 0x22)
+}
+
+func TestReadNeovim(t *testing.T) {
+	var shada bytes.Buffer
+	// Header: a map with the generator and version
+	header := append([]byte{0x82}, msgpackStr("generator")...)
+	header = append(header, msgpackStr("nvim")...)
+	header = append(header, msgpackStr("version")...)
+	header = append(header, msgpackStr("NVIM v0.10.0")...)
+	shada.Write(shadaEntry(1, header))
+	// A history entry, which has no file
+	shada.Write(shadaEntry(4, []byte{0x92, 0x00, 0xa2, 'w', 'q'}))
+	shada.Write(shadaEntry(shadaGlobalMark, shadaMark("/home/me/src/app/main.go")))
+	shada.Write(shadaEntry(shadaJump, shadaMark("/home/me/src/app/internal/very/deeply/nested/file.go")))
+	// Buffer list: an array of maps
+	buffers := []byte{0x91, 0x81}
+	buffers = append(buffers, msgpackStr("f")...)
+	buffers = append(buffers, msgpackStr("/home/me/notes/todo.md")...)
+	shada.Write(shadaEntry(shadaBufferList, buffers))
+	// A local mark with a map 16 and bin 8 file name, as older Neovim versions wrote
+	local := []byte{0xde, 0x00, 0x01}
+	local = append(local, msgpackStr("f")...)
+	local = append(local, 0xc4, 3, 'a', '.', 'c')
+	shada.Write(shadaEntry(shadaLocalMark, local))
+	// An unknown entry type with an extension value is skipped by its length
+	shada.Write(shadaEntry(100, []byte{0xd4, 0x01, 0x02}))
+
+	path := filepath.Join(t.TempDir(), "main.shada")
+	if err := os.WriteFile(path, shada.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	recents, err := readNeovim(path)
+	if err != nil {
+		t.Fatalf("readNeovim() error = %v", err)
+	}
+	want := []Recent{
+		{Path: "/home/me/src/app/main.go", File: true},
+		{Path: "/home/me/src/app/internal/very/deeply/nested/file.go", File: true},
+		{Path: "/home/me/notes/todo.md", File: true},
+		{Path: "a.c", File: true},
+	}
+	if !reflect.DeepEqual(recents, want) {
+		t.Errorf("readNeovim() = %v, want %v", recents, want)
+	}
+
+	// An entry whose length runs past the end of the file
+	if err := os.WriteFile(path, append(shada.Bytes(), 0x07, 0x00, 0x7f, 0x81), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readNeovim(path); err == nil {
+		t.Error("readNeovim() of truncated shada should fail")
+	}
+}
+
+func TestRecents(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Neovim keeps its shada file under LOCALAPPDATA on Windows")
+	}
+	state := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", state)
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("NVIM_APPNAME", "")
+
+	editor := Editors["neovim"]
+	if recents, err := editor.Recents(); err != nil || len(recents) != 0 {
+		t.Fatalf("Recents() without a shada file = %v, %v; want none", recents, err)
+	}
+
+	dir := filepath.Join(state, "nvim", "shada")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := shadaEntry(shadaGlobalMark, shadaMark("/src/app/main.go"))
+	if err := os.WriteFile(filepath.Join(dir, "main.shada"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	recents, err := editor.Recents()
+	if err != nil || len(recents) != 1 || recents[0].Path != "/src/app/main.go" {
+		t.Errorf("Recents() = %v, %v; want /src/app/main.go", recents, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "main.shada"), []byte{0xc1}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := editor.Recents(); err == nil || !strings.Contains(err.Error(), "main.shada") {
+		t.Errorf("Recents() error = %v, want one naming main.shada", err)
+	}
+}
@@ -0,0 +1,110 @@
+package editors
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// jetbrainsFiles returns the recent project lists of every installed JetBrains IDE
+// version (and Android Studio, which is built on IntelliJ). Rider calls its
+// projects solutions.
+func jetbrainsFiles() []string {
+	var patterns []string
+	for _, dir := range []string{
+		filepath.Join(configDir(), "JetBrains", "*", "options"),
+		filepath.Join(configDir(), "Google", "AndroidStudio*", "options"),
+	} {
+		patterns = append(patterns, filepath.Join(dir, "recentProjects.xml"), filepath.Join(dir, "recentSolutions.xml"))
+	}
+	return existing(patterns...)
+}
+
+// readJetBrains reads a recentProjects.xml file. Current IDEs key the project
+// metadata in the additionalInfo map by path; older ones kept a recentPaths list.
+//
+//	<component name="RecentProjectsManager">
+//	  <option name="additionalInfo">
+//	    <map>
+//	      <entry key="$USER_HOME$/src/app">...</entry>
+//	    </map>
+//	  </option>
+//	  <option name="recentPaths">
+//	    <list>
+//	      <option value="$USER_HOME$/src/app" />
+//	    </list>
+//	  </option>
+//	</component>
+func readJetBrains(path string) ([]Recent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	home, _ := os.UserHomeDir()
+	var recents []Recent
+	add := func(p string) {
+		p = strings.ReplaceAll(p, "$USER_HOME$", home)
+		if p != "" && !strings.Contains(p, "$") {
+			recents = append(recents, Recent{Path: filepath.FromSlash(p)})
+		}
+	}
+
+	// The element names enclosing the current one, with option elements recorded
+	// by their name attribute
+	var stack []string
+	under := func(parents ...string) bool {
+		if len(stack) < len(parents) {
+			return false
+		}
+		for i, p := range parents {
+			if stack[len(stack)-len(parents)+i] != p {
+				return false
+			}
+		}
+		return true
+	}
+
+	decoder := xml.NewDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return recents, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Local == "entry" && under("option:additionalInfo", "map"):
+				add(attr(t, "key"))
+			case t.Name.Local == "option" && under("option:recentPaths", "list"):
+				add(attr(t, "value"))
+			}
+			name := t.Name.Local
+			if name == "option" {
+				name += ":" + attr(t, "name")
+			}
+			stack = append(stack, name)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+}
+
+// attr returns the value of an element's attribute, or "" if it isn't set
+func attr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
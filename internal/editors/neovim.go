@@ -0,0 +1,268 @@
+package editors
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Shada entry types that record a file name under the "f" key
+const (
+	shadaGlobalMark = 7
+	shadaJump       = 8
+	shadaBufferList = 9 // An array of buffers rather than a single map
+	shadaLocalMark  = 10
+	shadaChange     = 11
+)
+
+var errMsgpack = errors.New("malformed msgpack data")
+
+// neovimFiles returns Neovim's shada file, which :oldfiles is built from. Neovim
+// 0.8 moved it from the data directory to the state directory. NVIM_APPNAME
+// selects a different config and state directory name.
+func neovimFiles() []string {
+	app := os.Getenv("NVIM_APPNAME")
+	if app == "" {
+		app = "nvim"
+	}
+	if runtime.GOOS == "windows" {
+		return existing(filepath.Join(os.Getenv("LOCALAPPDATA"), app+"-data", "shada", "main.shada"))
+	}
+
+	home, _ := os.UserHomeDir()
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return existing(
+		filepath.Join(stateHome, app, "shada", "main.shada"),
+		filepath.Join(dataHome, app, "shada", "main.shada"),
+	)
+}
+
+// readNeovim reads the files recorded in a shada file's marks, jump list, change
+// list and buffer list. A shada file is a sequence of entries, each a msgpack
+// type, timestamp and data length followed by the msgpack data.
+func readNeovim(path string) ([]Recent, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var recents []Recent
+	add := func(v any) {
+		if m, ok := v.(map[string]any); ok {
+			if f, ok := m["f"].(string); ok && f != "" {
+				recents = append(recents, Recent{Path: f, File: true})
+			}
+		}
+	}
+
+	d := &msgpackDecoder{data: data}
+	for len(d.data) > 0 {
+		var header [3]uint64 // type, timestamp, length
+		for i := range header {
+			v, err := d.value(0)
+			if err != nil {
+				return nil, err
+			}
+			n, ok := v.(int64)
+			if !ok || n < 0 {
+				return nil, errMsgpack
+			}
+			header[i] = uint64(n)
+		}
+		if header[2] > uint64(len(d.data)) {
+			return nil, errMsgpack
+		}
+		entry := &msgpackDecoder{data: d.data[:header[2]]}
+		d.data = d.data[header[2]:]
+
+		switch header[0] {
+		case shadaGlobalMark, shadaJump, shadaLocalMark, shadaChange:
+			if v, err := entry.value(0); err == nil {
+				add(v)
+			}
+		case shadaBufferList:
+			if v, err := entry.value(0); err == nil {
+				buffers, _ := v.([]any)
+				for _, b := range buffers {
+					add(b)
+				}
+			}
+		}
+	}
+	return recents, nil
+}
+
+// msgpackDecoder decodes msgpack values from the front of data. Strings and
+// binary data decode as strings, integers as int64, maps as map[string]any (keys
+// that aren't strings are dropped) and extension types as nil.
+type msgpackDecoder struct {
+	data []byte
+}
+
+// maxMsgpackDepth bounds how deeply arrays and maps may nest
+const maxMsgpackDepth = 32
+
+func (d *msgpackDecoder) value(depth int) (any, error) {
+	if depth > maxMsgpackDepth {
+		return nil, errMsgpack
+	}
+	b, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.mapOf(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.arrayOf(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xd9: // bin 8, str 8
+		n, err := d.uint(1)
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xc5, 0xda: // bin 16, str 16
+		n, err := d.uint(2)
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xc6, 0xdb: // bin 32, str 32
+		n, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xc7, 0xc8, 0xc9: // ext 8, 16, 32: length, type, data
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		_, err = d.take(int(n) + 1)
+		return nil, err
+	case 0xca:
+		n, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf: // uint 8, 16, 32, 64
+		n, err := d.uint(1 << (c - 0xcc))
+		return int64(n), err
+	case 0xd0:
+		n, err := d.uint(1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err := d.uint(2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err := d.uint(4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err := d.uint(8)
+		return int64(n), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8: // fixext 1, 2, 4, 8, 16: type, data
+		_, err := d.take(1<<(c-0xd4) + 1)
+		return nil, err
+	case 0xdc, 0xdd: // array 16, 32
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayOf(int(n), depth)
+	case 0xde, 0xdf: // map 16, 32
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(int(n), depth)
+	}
+	return nil, errMsgpack
+}
+
+func (d *msgpackDecoder) arrayOf(n, depth int) ([]any, error) {
+	if n > len(d.data) {
+		return nil, errMsgpack // Every element takes at least a byte
+	}
+	values := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (d *msgpackDecoder) mapOf(n, depth int) (map[string]any, error) {
+	if n > len(d.data)/2 {
+		return nil, errMsgpack
+	}
+	m := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if key, ok := k.(string); ok {
+			m[key] = v
+		}
+	}
+	return m, nil
+}
+
+func (d *msgpackDecoder) str(n int) (string, error) {
+	b, err := d.take(n)
+	return string(b), err
+}
+
+// uint reads a big-endian unsigned integer of size bytes
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	b, err := d.take(size)
+	if err != nil {
+		return 0, err
+	}
+	var buf [8]byte
+	copy(buf[8-size:], b)
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func (d *msgpackDecoder) take(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data) {
+		return nil, errMsgpack
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, nil
+}
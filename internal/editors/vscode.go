@@ -0,0 +1,111 @@
+package editors
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/josephschmitt/pj/internal/sqlite"
+)
+
+// vscodeProducts are the config directory names of VS Code and its variants
+var vscodeProducts = []string{"Code", "Code - Insiders", "VSCodium"}
+
+// vscodeRecentsKey is the state.vscdb key holding the File > Open Recent list
+const vscodeRecentsKey = "history.recentlyOpenedPathsList"
+
+// vscodeFiles returns the global state of each installed VS Code variant: the
+// state.vscdb SQLite database of current versions, or the storage.json that
+// versions before 1.48 kept the recent list in
+func vscodeFiles() []string {
+	var patterns []string
+	for _, product := range vscodeProducts {
+		dir := filepath.Join(configDir(), product, "User", "globalStorage")
+		patterns = append(patterns, filepath.Join(dir, "state.vscdb"), filepath.Join(dir, "storage.json"))
+	}
+	return existing(patterns...)
+}
+
+// vscodeRecents is the recently opened list, as stored under vscodeRecentsKey
+type vscodeRecents struct {
+	Entries []vscodeEntry `json:"entries"`
+}
+
+// vscodeEntry is a recently opened folder or file. Workspace entries have neither.
+type vscodeEntry struct {
+	FolderURI string `json:"folderUri"`
+	FileURI   string `json:"fileUri"`
+}
+
+// readVSCode reads the recently opened folders and files from state.vscdb or
+// storage.json. Workspace files and remote folders are skipped.
+func readVSCode(path string) ([]Recent, error) {
+	var list vscodeRecents
+	if filepath.Ext(path) == ".json" {
+		var storage struct {
+			OpenedPathsList struct {
+				vscodeRecents
+				Workspaces3 []any    `json:"workspaces3"` // Folder URIs, or workspace objects
+				Files2      []string `json:"files2"`
+			} `json:"openedPathsList"`
+		}
+		if err := readJSON(path, &storage); err != nil {
+			return nil, err
+		}
+		opened := storage.OpenedPathsList
+		list = opened.vscodeRecents
+		for _, w := range opened.Workspaces3 {
+			if uri, ok := w.(string); ok {
+				list.Entries = append(list.Entries, vscodeEntry{FolderURI: uri})
+			}
+		}
+		for _, uri := range opened.Files2 {
+			list.Entries = append(list.Entries, vscodeEntry{FileURI: uri})
+		}
+	} else {
+		value, err := vscodeState(path, vscodeRecentsKey)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(value, &list); err != nil {
+			return nil, err
+		}
+	}
+
+	var recents []Recent
+	for _, entry := range list.Entries {
+		if p, ok := fileURIPath(entry.FolderURI); ok {
+			recents = append(recents, Recent{Path: p})
+		} else if p, ok := fileURIPath(entry.FileURI); ok {
+			recents = append(recents, Recent{Path: p, File: true})
+		}
+	}
+	return recents, nil
+}
+
+// vscodeState returns a value from the ItemTable key-value table of a state.vscdb
+// database, or nil if the key isn't set
+func vscodeState(path, key string) ([]byte, error) {
+	db, err := sqlite.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Rows("ItemTable")
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row["key"] != key {
+			continue
+		}
+		switch v := row["value"].(type) {
+		case string:
+			return []byte(v), nil
+		case []byte:
+			return v, nil
+		default:
+			return nil, fmt.Errorf("unexpected %s value %T", key, v)
+		}
+	}
+	return nil, nil
+}
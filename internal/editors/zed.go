@@ -0,0 +1,80 @@
+package editors
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/josephschmitt/pj/internal/fsutil"
+	"github.com/josephschmitt/pj/internal/sqlite"
+)
+
+// zedFiles returns the workspace database of each installed Zed release channel
+// (db/0-stable, db/0-preview, ...)
+func zedFiles() []string {
+	name := "zed"
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		name = "Zed"
+	}
+	return existing(filepath.Join(fsutil.PlatformDataDir(), name, "db", "*", "db.sqlite"))
+}
+
+// readZed reads the folders of the workspaces in Zed's database. Current versions
+// store them as newline-separated text in the paths column; older ones stored a
+// bincode list in local_paths. Remote workspaces are skipped. Zed keeps the
+// database in WAL mode, so workspaces opened since its last checkpoint are only in
+// the db.sqlite-wal log, which sqlite.Open reads too.
+func readZed(path string) ([]Recent, error) {
+	db, err := sqlite.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Rows("workspaces")
+	if err != nil {
+		return nil, err
+	}
+
+	var recents []Recent
+	for _, row := range rows {
+		if row["remote_connection_id"] != nil || row["ssh_project_id"] != nil {
+			continue
+		}
+		var paths []string
+		switch v := row["paths"].(type) {
+		case string:
+			paths = strings.Split(v, "\n")
+		default:
+			if b, ok := row["local_paths"].([]byte); ok {
+				paths = zedLocalPaths(b)
+			}
+		}
+		for _, p := range paths {
+			if p != "" {
+				recents = append(recents, Recent{Path: p})
+			}
+		}
+	}
+	return recents, nil
+}
+
+// zedLocalPaths decodes a bincode list of paths: a little-endian u64 count, then
+// each path as a u64 length and its bytes. A malformed list decodes as far as it can.
+func zedLocalPaths(b []byte) []string {
+	if len(b) < 8 {
+		return nil
+	}
+	count := binary.LittleEndian.Uint64(b)
+	b = b[8:]
+	var paths []string
+	for i := uint64(0); i < count && len(b) >= 8; i++ {
+		n := binary.LittleEndian.Uint64(b)
+		b = b[8:]
+		if n > uint64(len(b)) {
+			break
+		}
+		paths = append(paths, string(b[:n]))
+		b = b[n:]
+	}
+	return paths
+}
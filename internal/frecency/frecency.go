@@ -0,0 +1,193 @@
+// Package frecency records visits to directories and ranks them by how frequently
+// and how recently they were visited, using the same scoring as zoxide.
+package frecency
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/josephschmitt/pj/internal/fsutil"
+)
+
+// maxRank caps the sum of all ranks; past it, every rank is scaled down so old
+// entries fade out and the database stays small
+const maxRank = 10000
+
+// Entry is a visited directory
+type Entry struct {
+	Path      string    `json:"path"`
+	Rank      float64   `json:"rank"` // Grows by one per visit, shrinks as the database ages
+	LastVisit time.Time `json:"lastVisit"`
+}
+
+// Score weighs the entry's rank by how recently it was visited
+func (e Entry) Score(now time.Time) float64 {
+	age := now.Sub(e.LastVisit)
+	switch {
+	case age < time.Hour:
+		return e.Rank * 4
+	case age < 24*time.Hour:
+		return e.Rank * 2
+	case age < 7*24*time.Hour:
+		return e.Rank / 2
+	default:
+		return e.Rank / 4
+	}
+}
+
+// Store is the visit database
+type Store struct {
+	path    string
+	Entries []Entry `json:"entries"`
+}
+
+// DefaultPath returns the visit database path in pj's data directory
+func DefaultPath() string {
+	return filepath.Join(fsutil.DataHome(), "visits.json")
+}
+
+// Load reads the visit database at path; a missing file is an empty database
+func Load(path string) (*Store, error) {
+	s := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Lock waits for and takes the lock that serializes changes to the visit database
+// at path. Hold it from Load until Save: two shell hooks that load the database at
+// the same time would otherwise each save their own visit over the other's.
+func Lock(path string) (*fsutil.Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return fsutil.LockFile(path+".lock", true)
+}
+
+// Save writes the database back to the path it was loaded from. The file is
+// replaced atomically, so readers never see a partial file; writers must hold the
+// database's Lock to not lose each other's changes.
+func (s *Store) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(s.path, data)
+}
+
+// Visit records a visit to path at now
+func (s *Store) Visit(path string, now time.Time) {
+	path = filepath.Clean(path)
+	found := false
+	for i := range s.Entries {
+		if s.Entries[i].Path == path {
+			s.Entries[i].Rank++
+			s.Entries[i].LastVisit = now
+			found = true
+			break
+		}
+	}
+	if !found {
+		s.Entries = append(s.Entries, Entry{Path: path, Rank: 1, LastVisit: now})
+	}
+	s.age()
+}
+
+// age scales all ranks down once their sum passes maxRank, dropping entries whose
+// rank falls below one
+func (s *Store) age() {
+	total := 0.0
+	for _, e := range s.Entries {
+		total += e.Rank
+	}
+	if total <= maxRank {
+		return
+	}
+
+	factor := 0.9 * maxRank / total
+	kept := s.Entries[:0]
+	for _, e := range s.Entries {
+		e.Rank *= factor
+		if e.Rank >= 1 {
+			kept = append(kept, e)
+		}
+	}
+	s.Entries = kept
+}
+
+// Forget removes path from the database, reporting whether it was there
+func (s *Store) Forget(path string) bool {
+	path = filepath.Clean(path)
+	for i, e := range s.Entries {
+		if e.Path == path {
+			s.Entries = append(s.Entries[:i], s.Entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Ranked returns the entries ordered by score, highest first
+func (s *Store) Ranked(now time.Time) []Entry {
+	entries := make([]Entry, len(s.Entries))
+	copy(entries, s.Entries)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Score(now) > entries[j].Score(now)
+	})
+	return entries
+}
+
+// ProjectScores attributes the score of every visited path to the innermost of the
+// given project directories that contains it, so visits to a project's
+// subdirectories count towards the project
+func (s *Store) ProjectScores(projects []string, now time.Time) map[string]float64 {
+	enclosing := NewProjects(projects)
+	scores := make(map[string]float64)
+	for _, e := range s.Entries {
+		if project, ok := enclosing.Innermost(e.Path); ok {
+			scores[project] += e.Score(now)
+		}
+	}
+	return scores
+}
+
+// Projects is a set of project directories that visits are attributed to
+type Projects map[string]bool
+
+// NewProjects returns the set of the given project directories
+func NewProjects(paths []string) Projects {
+	projects := make(Projects, len(paths))
+	for _, p := range paths {
+		projects[p] = true
+	}
+	return projects
+}
+
+// Innermost returns the innermost project that contains path (or is path itself)
+func (p Projects) Innermost(path string) (string, bool) {
+	dir := filepath.Clean(path)
+	for {
+		if p[dir] {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
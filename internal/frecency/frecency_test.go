@@ -0,0 +1,121 @@
+package frecency
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScore(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		age  time.Duration
+		want float64
+	}{
+		{name: "within the hour", age: 10 * time.Minute, want: 8},
+		{name: "within the day", age: 3 * time.Hour, want: 4},
+		{name: "within the week", age: 3 * 24 * time.Hour, want: 1},
+		{name: "older", age: 30 * 24 * time.Hour, want: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Entry{Path: "/p", Rank: 2, LastVisit: now.Add(-tt.age)}
+			if got := e.Score(now); got != tt.want {
+				t.Errorf("Score() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pj", "visits.json")
+	now := time.Now().Truncate(time.Second)
+
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() of missing file error = %v", err)
+	}
+	s.Visit("/a", now.Add(-48*time.Hour))
+	s.Visit("/a/", now.Add(-48*time.Hour))
+	s.Visit("/b", now)
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(loaded.Entries) != 2 || loaded.Entries[0].Rank != 2 {
+		t.Fatalf("Entries = %+v, want /a visited twice and /b once", loaded.Entries)
+	}
+
+	// /b's single recent visit outweighs /a's two older ones
+	var ranked []string
+	for _, e := range loaded.Ranked(now) {
+		ranked = append(ranked, e.Path)
+	}
+	if want := []string{"/b", "/a"}; !reflect.DeepEqual(ranked, want) {
+		t.Errorf("Ranked() = %v, want %v", ranked, want)
+	}
+
+	if !loaded.Forget("/a") || loaded.Forget("/a") {
+		t.Error("Forget() should remove /a exactly once")
+	}
+}
+
+func TestAging(t *testing.T) {
+	now := time.Now()
+	s := &Store{Entries: []Entry{
+		{Path: "/busy", Rank: maxRank, LastVisit: now},
+		{Path: "/rare", Rank: 1, LastVisit: now},
+	}}
+	s.Visit("/busy", now)
+
+	if len(s.Entries) != 1 || s.Entries[0].Path != "/busy" {
+		t.Fatalf("Entries = %+v, want only /busy after aging", s.Entries)
+	}
+	if s.Entries[0].Rank > maxRank {
+		t.Errorf("rank = %v, want it scaled below %d", s.Entries[0].Rank, maxRank)
+	}
+}
+
+func TestProjectScores(t *testing.T) {
+	now := time.Now()
+	s := &Store{Entries: []Entry{
+		{Path: "/src/app", Rank: 1, LastVisit: now},
+		{Path: "/src/app/cmd", Rank: 2, LastVisit: now},
+		{Path: "/src/app/lib/x", Rank: 1, LastVisit: now},
+		{Path: "/elsewhere", Rank: 5, LastVisit: now},
+	}}
+
+	got := s.ProjectScores([]string{"/src/app", "/src/app/lib", "/src/other"}, now)
+	want := map[string]float64{"/src/app": 12, "/src/app/lib": 4}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ProjectScores() = %v, want %v", got, want)
+	}
+}
+
+func TestProjectsInnermost(t *testing.T) {
+	projects := NewProjects([]string{"/src/app", "/src/app/lib"})
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"/src/app", "/src/app", true},
+		{"/src/app/cmd/", "/src/app", true},
+		{"/src/app/lib/../lib/x", "/src/app/lib", true},
+		{"/src", "", false},
+		{"/elsewhere", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := projects.Innermost(tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Innermost(%q) = %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
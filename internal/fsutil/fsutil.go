@@ -0,0 +1,70 @@
+// Package fsutil holds the file system helpers shared by the packages that keep
+// pj's state on disk or read other tools' files: where per-user data lives,
+// replacing files atomically and advisory locks between pj processes.
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// DataHome returns the directory pj keeps its own data in, using XDG_DATA_HOME
+// like the config and cache directories use theirs on every platform
+func DataHome() string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "pj")
+}
+
+// PlatformDataDir returns the platform's per-user data directory, where other
+// tools (like Zed and zoxide) keep their databases
+func PlatformDataDir() string {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support")
+	case "windows":
+		return os.Getenv("LOCALAPPDATA")
+	}
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return dataHome
+	}
+	return filepath.Join(home, ".local", "share")
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it into
+// place, so concurrent readers see either the old file or the new one, never a
+// partially written one
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
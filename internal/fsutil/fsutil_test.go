@@ -0,0 +1,61 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache.json")
+
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFileAtomic(path, []byte(content)); err != nil {
+			t.Fatalf("WriteFileAtomic() error = %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("content = %q, want %q", data, content)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the cache file", len(entries))
+	}
+}
+
+func TestLocked(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+		t.Skip("locks are a no-op on this platform")
+	}
+	path := filepath.Join(t.TempDir(), "visits.json.lock")
+	if Locked(path) {
+		t.Error("Locked() on a missing file = true, want false")
+	}
+
+	lock, err := LockFile(path, false)
+	if err != nil || lock == nil {
+		t.Fatalf("LockFile() = %v, %v, want a lock", lock, err)
+	}
+	if !Locked(path) {
+		t.Error("Locked() while locked = false, want true")
+	}
+	if other, err := LockFile(path, false); err != nil || other != nil {
+		t.Errorf("LockFile() while locked = %v, %v, want nil, nil", other, err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if Locked(path) {
+		t.Error("Locked() after unlock = true, want false")
+	}
+}
@@ -0,0 +1,54 @@
+package fsutil
+
+import "os"
+
+// Lock is an advisory lock held on a file. Locks are released automatically if the
+// process holding them exits.
+type Lock struct {
+	f *os.File
+}
+
+// LockFile takes the lock on the file at path, creating the file if needed and
+// waiting for the lock if wait is set. It returns a nil Lock and no error if wait
+// isn't set and another process holds the lock.
+func LockFile(path string, wait bool) (*Lock, error) {
+	// Lock files are left in place: removing one while another process is waiting
+	// on it would let a third process lock a new file at the same path
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	locked, err := lockFile(f, wait)
+	if err != nil || !locked {
+		_ = f.Close()
+		return nil, err
+	}
+	return &Lock{f: f}, nil
+}
+
+// Unlock releases the lock
+func (l *Lock) Unlock() error {
+	if l == nil {
+		return nil
+	}
+	err := unlockFile(l.f)
+	if closeErr := l.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Locked reports whether another process holds the lock on the file at path
+func Locked(path string) bool {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	ok, err := lockFile(f, false)
+	if ok {
+		_ = unlockFile(f)
+	}
+	_ = f.Close()
+	return err != nil || !ok
+}
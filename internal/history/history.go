@@ -0,0 +1,131 @@
+// Package history imports navigation history from other directory jumpers (zoxide,
+// autojump and fasd) and keeps the resulting per-project scores.
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/josephschmitt/pj/internal/frecency"
+	"github.com/josephschmitt/pj/internal/fsutil"
+)
+
+// Visit is a directory from another tool's database with the score that tool gives it
+type Visit struct {
+	Path  string
+	Score float64
+}
+
+// Importer reads the database of a directory jumper
+type Importer struct {
+	Name string
+	// DefaultPath returns where the tool keeps its database
+	DefaultPath func() string
+	// Read parses the database
+	Read func(path string, now time.Time) ([]Visit, error)
+}
+
+// Importers lists the supported tools by name
+var Importers = map[string]Importer{
+	"zoxide":   {Name: "zoxide", DefaultPath: zoxidePath, Read: readZoxide},
+	"autojump": {Name: "autojump", DefaultPath: autojumpPath, Read: readAutojump},
+	"fasd":     {Name: "fasd", DefaultPath: fasdPath, Read: readFasd},
+}
+
+// Source is the result of importing one tool's history
+type Source struct {
+	Imported time.Time          `json:"imported"`
+	Database string             `json:"database"`
+	Projects map[string]float64 `json:"projects"` // Project path to aggregated score
+}
+
+// Store holds imported scores by tool name. Importing a tool again replaces its scores.
+type Store struct {
+	path    string
+	Sources map[string]Source `json:"sources"`
+}
+
+// DefaultPath returns the imported history path in pj's data directory
+func DefaultPath() string {
+	return filepath.Join(fsutil.DataHome(), "history.json")
+}
+
+// Load reads the imported history at path; a missing file is an empty history
+func Load(path string) (*Store, error) {
+	s := &Store{path: path, Sources: make(map[string]Source)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Sources == nil {
+		s.Sources = make(map[string]Source)
+	}
+	return s, nil
+}
+
+// Save writes the history back to the path it was loaded from
+func (s *Store) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(s.path, data)
+}
+
+// Import reads a tool's database and replaces its scores with the visits mapped to
+// the innermost enclosing project. It returns the number of visits that fell inside
+// a project and the total number read.
+func (s *Store) Import(importer Importer, database string, projects []string, now time.Time) (int, int, error) {
+	visits, err := importer.Read(database, now)
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading %s database %s: %w", importer.Name, database, err)
+	}
+
+	scores, matched := Attribute(visits, projects)
+	s.Sources[importer.Name] = Source{Imported: now, Database: database, Projects: scores}
+	return matched, len(visits), nil
+}
+
+// Scores sums the imported scores of each project across all tools
+func (s *Store) Scores() map[string]float64 {
+	scores := make(map[string]float64)
+	names := make([]string, 0, len(s.Sources))
+	for name := range s.Sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for path, score := range s.Sources[name].Projects {
+			scores[path] += score
+		}
+	}
+	return scores
+}
+
+// Attribute adds up the scores of visits per innermost enclosing project, and
+// returns how many visits were inside a project; the others are dropped
+func Attribute(visits []Visit, projects []string) (map[string]float64, int) {
+	enclosing := frecency.NewProjects(projects)
+	scores := make(map[string]float64)
+	matched := 0
+	for _, v := range visits {
+		if project, ok := enclosing.Innermost(v.Path); ok {
+			scores[project] += v.Score
+			matched++
+		}
+	}
+	return scores, matched
+}
@@ -0,0 +1,171 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeZoxide writes a database in zoxide's bincode format
+func writeZoxide(t *testing.T, path string, version uint32, entries []Visit, lastAccessed time.Time) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := func(v any) {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w(version)
+	w(uint64(len(entries)))
+	for _, e := range entries {
+		w(uint64(len(e.Path)))
+		buf.WriteString(e.Path)
+		w(e.Score)
+		w(uint64(lastAccessed.Unix()))
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReaders(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	zoxide := filepath.Join(dir, "db.zo")
+	writeZoxide(t, zoxide, zoxideVersion, []Visit{{Path: "/src/app", Score: 3}, {Path: "/tmp", Score: 1}}, now.Add(-2*time.Hour))
+
+	autojump := filepath.Join(dir, "autojump.txt")
+	if err := os.WriteFile(autojump, []byte("22.4\t/src/app\n\nbogus line\n10\t/src/other dir\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fasd := filepath.Join(dir, ".fasd")
+	content := "/src/app|4|" + strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10) + "\n" +
+		"/src/a|b|3|" + strconv.FormatInt(now.Add(-30*24*time.Hour).Unix(), 10) + "\n"
+	if err := os.WriteFile(fasd, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want []Visit
+	}{
+		// zoxide weights ranks visited within the day by 2
+		{name: "zoxide", path: zoxide, want: []Visit{{Path: "/src/app", Score: 6}, {Path: "/tmp", Score: 2}}},
+		{name: "autojump", path: autojump, want: []Visit{{Path: "/src/app", Score: 22.4}, {Path: "/src/other dir", Score: 10}}},
+		{name: "fasd", path: fasd, want: []Visit{{Path: "/src/app", Score: 16}, {Path: "/src/a|b", Score: 0.75}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Importers[tt.name].Read(tt.path, now)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZoxideErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	old := filepath.Join(dir, "old.zo")
+	writeZoxide(t, old, 2, nil, time.Now())
+	if _, err := readZoxide(old, time.Now()); err == nil || !strings.Contains(err.Error(), "version 2") {
+		t.Errorf("readZoxide() of version 2 error = %v, want unsupported version", err)
+	}
+
+	full := filepath.Join(dir, "full.zo")
+	writeZoxide(t, full, zoxideVersion, []Visit{{Path: "/src/app", Score: 1}}, time.Now())
+	data, err := os.ReadFile(full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cut := filepath.Join(dir, "cut.zo")
+	if err := os.WriteFile(cut, data[:len(data)-4], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readZoxide(cut, time.Now()); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("readZoxide() of truncated file error = %v, want truncated", err)
+	}
+
+	empty := filepath.Join(dir, "empty.zo")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if visits, err := readZoxide(empty, time.Now()); err != nil || len(visits) != 0 {
+		t.Errorf("readZoxide() of empty file = %v, %v, want no visits", visits, err)
+	}
+}
+
+func TestAttribute(t *testing.T) {
+	visits := []Visit{
+		{Path: "/src/app", Score: 1},
+		{Path: "/src/app/cmd/", Score: 2},
+		{Path: "/src/app/lib/x", Score: 4},
+		{Path: "/home", Score: 8},
+	}
+
+	scores, matched := Attribute(visits, []string{"/src/app", "/src/app/lib"})
+	want := map[string]float64{"/src/app": 3, "/src/app/lib": 4}
+	if !reflect.DeepEqual(scores, want) || matched != 3 {
+		t.Errorf("Attribute() = %v, %d, want %v, 3", scores, matched, want)
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pj", "history.json")
+	database := filepath.Join(dir, "autojump.txt")
+	projects := []string{"/src/app", "/src/lib"}
+	now := time.Now().Truncate(time.Second)
+
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() of missing file error = %v", err)
+	}
+
+	write := func(content string) {
+		if err := os.WriteFile(database, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("5\t/src/app\n1\t/elsewhere\n")
+	if matched, total, err := s.Import(Importers["autojump"], database, projects, now); err != nil || matched != 1 || total != 2 {
+		t.Fatalf("Import() = %d, %d, %v, want 1, 2, nil", matched, total, err)
+	}
+	s.Sources["fasd"] = Source{Projects: map[string]float64{"/src/app": 1, "/src/lib": 2}}
+
+	// Importing the same tool again replaces its scores instead of adding to them
+	write("3\t/src/app\n")
+	if _, _, err := s.Import(Importers["autojump"], database, projects, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := map[string]float64{"/src/app": 4, "/src/lib": 2}
+	if got := loaded.Scores(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Scores() = %v, want %v", got, want)
+	}
+
+	if _, _, err := s.Import(Importers["autojump"], filepath.Join(dir, "missing.txt"), projects, now); err == nil {
+		t.Error("Import() of a missing database should fail")
+	}
+}
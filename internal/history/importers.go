@@ -0,0 +1,182 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/josephschmitt/pj/internal/frecency"
+	"github.com/josephschmitt/pj/internal/fsutil"
+)
+
+// zoxideVersion is the database format version zoxide writes since 0.8
+const zoxideVersion = 3
+
+// zoxidePath returns zoxide's database, honouring _ZO_DATA_DIR
+func zoxidePath() string {
+	if dir := os.Getenv("_ZO_DATA_DIR"); dir != "" {
+		return filepath.Join(dir, "db.zo")
+	}
+	return filepath.Join(fsutil.PlatformDataDir(), "zoxide", "db.zo")
+}
+
+// readZoxide parses zoxide's bincode database: a u32 version followed by a u64
+// count of entries, each a u64-length-prefixed path, an f64 rank and a u64 last
+// access time in seconds, all little-endian. Scores use the same weighting zoxide
+// applies when querying.
+func readZoxide(path string, now time.Time) ([]Visit, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	r := bytes.NewReader(data)
+	var version uint32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	if version != zoxideVersion {
+		return nil, fmt.Errorf("unsupported zoxide database version %d", version)
+	}
+
+	var count uint64
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+
+	var visits []Visit
+	for i := uint64(0); i < count; i++ {
+		var length uint64
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return nil, truncated(err)
+		}
+		if length > uint64(r.Len()) {
+			return nil, truncated(io.ErrUnexpectedEOF)
+		}
+		dir := make([]byte, length)
+		if _, err := io.ReadFull(r, dir); err != nil {
+			return nil, truncated(err)
+		}
+
+		var entry struct {
+			Rank         float64
+			LastAccessed uint64
+		}
+		if err := binary.Read(r, binary.LittleEndian, &entry); err != nil {
+			return nil, truncated(err)
+		}
+
+		e := frecency.Entry{Path: string(dir), Rank: entry.Rank, LastVisit: time.Unix(int64(entry.LastAccessed), 0)}
+		visits = append(visits, Visit{Path: e.Path, Score: e.Score(now)})
+	}
+	return visits, nil
+}
+
+// truncated wraps read errors from a database that ends mid-entry
+func truncated(err error) error {
+	return fmt.Errorf("database is truncated: %w", err)
+}
+
+// autojumpPath returns autojump's database in its per-platform location
+func autojumpPath() string {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, "Library", "autojump", "autojump.txt")
+	case "windows":
+		return filepath.Join(os.Getenv("APPDATA"), "autojump", "autojump.txt")
+	default:
+		return filepath.Join(fsutil.PlatformDataDir(), "autojump", "autojump.txt")
+	}
+}
+
+// readAutojump parses autojump's text database, one "weight<TAB>path" per line
+func readAutojump(path string, now time.Time) ([]Visit, error) {
+	return readLines(path, func(line string) (Visit, bool) {
+		weight, dir, ok := strings.Cut(line, "\t")
+		if !ok {
+			return Visit{}, false
+		}
+		score, err := strconv.ParseFloat(weight, 64)
+		if err != nil {
+			return Visit{}, false
+		}
+		return Visit{Path: dir, Score: score}, true
+	})
+}
+
+// fasdPath returns fasd's database, honouring _FASD_DATA
+func fasdPath() string {
+	if path := os.Getenv("_FASD_DATA"); path != "" {
+		return path
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".fasd")
+}
+
+// readFasd parses fasd's text database, one "path|rank|time" per line. fasd tracks
+// files as well as directories; files are attributed to their enclosing project too.
+func readFasd(path string, now time.Time) ([]Visit, error) {
+	return readLines(path, func(line string) (Visit, bool) {
+		// Split from the right, since paths may contain '|'
+		rest, seconds, ok := cutLast(line, "|")
+		if !ok {
+			return Visit{}, false
+		}
+		dir, rank, ok := cutLast(rest, "|")
+		if !ok {
+			return Visit{}, false
+		}
+		r, err := strconv.ParseFloat(rank, 64)
+		if err != nil {
+			return Visit{}, false
+		}
+		t, err := strconv.ParseInt(seconds, 10, 64)
+		if err != nil {
+			return Visit{}, false
+		}
+		e := frecency.Entry{Path: dir, Rank: r, LastVisit: time.Unix(t, 0)}
+		return Visit{Path: dir, Score: e.Score(now)}, true
+	})
+}
+
+// readLines parses a line-based database, skipping blank and malformed lines
+func readLines(path string, parse func(line string) (Visit, bool)) ([]Visit, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var visits []Visit
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if v, ok := parse(line); ok {
+			visits = append(visits, v)
+		}
+	}
+	return visits, scanner.Err()
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
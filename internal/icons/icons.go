@@ -99,11 +99,16 @@ func (m *Mapper) GetDisplayLabel(marker string) string {
 // When ansi is true, the icon is wrapped as \033[<code>m<icon>\033[39m.
 // When ansi is false, the plain icon is returned.
 func (m *Mapper) Format(marker string, ansi bool) string {
-	icon := m.Get(marker)
+	return FormatColor(m.Get(marker), m.GetColor(marker), ansi)
+}
+
+// FormatColor returns the given icon, optionally wrapped in the ANSI codes of a
+// color name (blue if the name is unknown). This is used when a project overrides
+// its marker's color.
+func FormatColor(icon, color string, ansi bool) string {
 	if !ansi {
 		return icon
 	}
-	color := m.GetColor(marker)
 	code, ok := ansiColors[color]
 	if !ok {
 		code = ansiColors["blue"]
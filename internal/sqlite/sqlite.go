@@ -0,0 +1,416 @@
+// Package sqlite reads rows from SQLite database files without a database driver.
+// It only supports what pj needs to read editor state: scanning whole tables of a
+// database file, including transactions committed to its write-ahead log that
+// haven't been checkpointed into the file yet.
+package sqlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// Row maps column names to values: nil, int64, float64, string or []byte
+type Row map[string]any
+
+var errCorrupt = errors.New("malformed database file")
+
+// DB is a database file read into memory
+type DB struct {
+	data     []byte
+	wal      walLog
+	pageSize int
+	usable   int // Page size minus the bytes reserved at the end of each page
+}
+
+// Open reads the database file at path, along with its write-ahead log (path with
+// a -wal suffix) if there is one
+func Open(path string) (*DB, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	wal, err := readWAL(path + "-wal")
+	if err != nil {
+		return nil, err
+	}
+
+	// A database that was never checkpointed only has its header in the log
+	first := data
+	if page, ok := wal.pages[1]; ok {
+		first = page
+	}
+	if len(first) < 100 || !bytes.HasPrefix(first, []byte("SQLite format 3\x00")) {
+		return nil, fmt.Errorf("%s is not a SQLite database", path)
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(first[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, errCorrupt
+	}
+	if wal.pageSize != 0 && wal.pageSize != pageSize {
+		return nil, errCorrupt
+	}
+	return &DB{data: data, wal: wal, pageSize: pageSize, usable: pageSize - int(first[20])}, nil
+}
+
+// Rows returns every row of a table, with columns named as in its CREATE TABLE
+// statement. Rows written before a column was added lack that column.
+func (db *DB) Rows(table string) ([]Row, error) {
+	schema, err := db.scan(1)
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite_schema columns: type, name, tbl_name, rootpage, sql
+	for _, record := range schema {
+		if len(record) < 5 || record[0] != "table" || !strings.EqualFold(fmt.Sprint(record[1]), table) {
+			continue
+		}
+		root, ok := record[3].(int64)
+		sql, _ := record[4].(string)
+		if !ok {
+			return nil, errCorrupt
+		}
+		columns := parseColumns(sql)
+
+		records, err := db.scan(int(root))
+		if err != nil {
+			return nil, err
+		}
+		rows := make([]Row, 0, len(records))
+		for _, record := range records {
+			row := make(Row, len(record))
+			for i, value := range record {
+				if i >= len(columns) {
+					break
+				}
+				// Whole REAL values are stored as integers to save space
+				if v, ok := value.(int64); ok && columns[i].real {
+					value = float64(v)
+				}
+				row[columns[i].name] = value
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("no such table: %s", table)
+}
+
+// page returns the contents of a 1-based page number, preferring its image in the
+// write-ahead log
+func (db *DB) page(n int) ([]byte, error) {
+	if n < 1 || (db.wal.size != 0 && n > db.wal.size) {
+		return nil, errCorrupt
+	}
+	if page, ok := db.wal.pages[n]; ok {
+		return page, nil
+	}
+	start := (n - 1) * db.pageSize
+	if start+db.pageSize > len(db.data) {
+		return nil, errCorrupt
+	}
+	return db.data[start : start+db.pageSize], nil
+}
+
+// scan returns the records of the table b-tree rooted at page root, in rowid order
+func (db *DB) scan(root int) ([][]any, error) {
+	var records [][]any
+	var visit func(n, depth int) error
+	visit = func(n, depth int) error {
+		if depth > 64 {
+			return errCorrupt // A cycle between pages
+		}
+		page, err := db.page(n)
+		if err != nil {
+			return err
+		}
+		header := 0
+		if n == 1 {
+			header = 100 // The file header precedes the first page's b-tree header
+		}
+		if header+8 > len(page) {
+			return errCorrupt
+		}
+
+		kind := page[header]
+		cells := int(binary.BigEndian.Uint16(page[header+3:]))
+		pointers := header + 8
+		if kind == 0x05 {
+			pointers = header + 12
+		}
+		if pointers+2*cells > len(page) {
+			return errCorrupt
+		}
+
+		for i := 0; i < cells; i++ {
+			offset := int(binary.BigEndian.Uint16(page[pointers+2*i:]))
+			if offset >= len(page) {
+				return errCorrupt
+			}
+			switch kind {
+			case 0x05: // Interior table page: child page number, then a rowid key
+				if offset+4 > len(page) {
+					return errCorrupt
+				}
+				if err := visit(int(binary.BigEndian.Uint32(page[offset:])), depth+1); err != nil {
+					return err
+				}
+			case 0x0d: // Leaf table page: payload size, rowid, payload
+				record, err := db.leafCell(page, offset)
+				if err != nil {
+					return err
+				}
+				records = append(records, record)
+			default:
+				return fmt.Errorf("%w: page %d isn't a table page", errCorrupt, n)
+			}
+		}
+
+		if kind == 0x05 {
+			return visit(int(binary.BigEndian.Uint32(page[header+8:])), depth+1)
+		}
+		return nil
+	}
+
+	if err := visit(root, 0); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// leafCell decodes the record in the table leaf cell at offset, following its
+// overflow pages if the payload didn't fit on the page
+func (db *DB) leafCell(page []byte, offset int) ([]any, error) {
+	size, n := varint(page[offset:])
+	if n == 0 {
+		return nil, errCorrupt
+	}
+	offset += n
+	if _, n = varint(page[offset:]); n == 0 {
+		return nil, errCorrupt
+	}
+	offset += n
+
+	// How much of the payload is stored on the page itself, per the file format
+	total := int(size)
+	local := total
+	maxLocal := db.usable - 35
+	if total > maxLocal {
+		minLocal := (db.usable-12)*32/255 - 23
+		local = minLocal + (total-minLocal)%(db.usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if offset+local > len(page) {
+		return nil, errCorrupt
+	}
+
+	payload := make([]byte, 0, total)
+	payload = append(payload, page[offset:offset+local]...)
+	if local < total {
+		if offset+local+4 > len(page) {
+			return nil, errCorrupt
+		}
+		next := int(binary.BigEndian.Uint32(page[offset+local:]))
+		for len(payload) < total {
+			overflow, err := db.page(next)
+			if err != nil {
+				return nil, err
+			}
+			chunk := overflow[4:db.usable]
+			if remaining := total - len(payload); len(chunk) > remaining {
+				chunk = chunk[:remaining]
+			}
+			payload = append(payload, chunk...)
+			next = int(binary.BigEndian.Uint32(overflow))
+		}
+	}
+	return record(payload)
+}
+
+// record decodes a record: a header of serial types followed by the values
+func record(payload []byte) ([]any, error) {
+	headerSize, n := varint(payload)
+	if n == 0 || int(headerSize) > len(payload) {
+		return nil, errCorrupt
+	}
+
+	var types []uint64
+	for pos := n; pos < int(headerSize); {
+		t, n := varint(payload[pos:int(headerSize)])
+		if n == 0 {
+			return nil, errCorrupt
+		}
+		types = append(types, t)
+		pos += n
+	}
+
+	values := make([]any, len(types))
+	body := payload[headerSize:]
+	for i, t := range types {
+		var size int
+		switch {
+		case t == 0, t == 8, t == 9:
+			size = 0
+		case t <= 4:
+			size = int(t)
+		case t == 5:
+			size = 6
+		case t == 6, t == 7:
+			size = 8
+		case t >= 12:
+			size = int(t-12) / 2
+		default:
+			return nil, errCorrupt
+		}
+		if size > len(body) {
+			return nil, errCorrupt
+		}
+		value := body[:size]
+		body = body[size:]
+
+		switch {
+		case t == 0:
+			values[i] = nil
+		case t == 8:
+			values[i] = int64(0)
+		case t == 9:
+			values[i] = int64(1)
+		case t == 7:
+			values[i] = math.Float64frombits(binary.BigEndian.Uint64(value))
+		case t <= 6:
+			// Big-endian two's complement integer of 1 to 8 bytes
+			var v int64
+			if value[0]&0x80 != 0 {
+				v = -1
+			}
+			for _, b := range value {
+				v = v<<8 | int64(b)
+			}
+			values[i] = v
+		case t%2 == 0:
+			values[i] = append([]byte(nil), value...)
+		default:
+			values[i] = string(value)
+		}
+	}
+	return values, nil
+}
+
+// varint decodes a SQLite variable-length integer, returning 0 bytes read if b is too short
+func varint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return v, 9
+}
+
+// column is a table column as declared in its CREATE TABLE statement
+type column struct {
+	name string
+	real bool // REAL affinity, per SQLite's rules for declared types
+}
+
+// parseColumns extracts the columns from a CREATE TABLE statement, skipping table
+// constraints
+func parseColumns(sql string) []column {
+	start := strings.Index(sql, "(")
+	end := strings.LastIndex(sql, ")")
+	if start < 0 || end < start {
+		return nil
+	}
+
+	var columns []column
+	for _, def := range splitTopLevel(sql[start+1 : end]) {
+		fields := strings.Fields(def)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "CONSTRAINT", "PRIMARY", "FOREIGN", "UNIQUE", "CHECK":
+			continue
+		}
+		name := columnName(def)
+		declared := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(def), name)))
+		real := !strings.Contains(declared, "INT") && !strings.Contains(declared, "CHAR") &&
+			!strings.Contains(declared, "CLOB") && !strings.Contains(declared, "TEXT") &&
+			(strings.Contains(declared, "REAL") || strings.Contains(declared, "FLOA") || strings.Contains(declared, "DOUB"))
+		columns = append(columns, column{name: unquote(name), real: real})
+	}
+	return columns
+}
+
+// columnName returns the first token of a column definition, which may be quoted
+// and contain spaces
+func columnName(def string) string {
+	def = strings.TrimSpace(def)
+	if def == "" {
+		return ""
+	}
+	closing := map[byte]byte{'"': '"', '`': '`', '[': ']', '\'': '\''}
+	if end, ok := closing[def[0]]; ok {
+		if i := strings.IndexByte(def[1:], end); i >= 0 {
+			return def[:i+2]
+		}
+	}
+	return strings.Fields(def)[0]
+}
+
+// unquote strips identifier quotes
+func unquote(name string) string {
+	if len(name) >= 2 {
+		switch name[0] {
+		case '"', '`', '[', '\'':
+			return name[1 : len(name)-1]
+		}
+	}
+	return name
+}
+
+// splitTopLevel splits s on commas that aren't inside parentheses or quotes
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,175 @@
+package sqlite
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testdata/test.db was created with the sqlite3 shell using a 1 KiB page size, so
+// the 5000-byte value spills onto overflow pages and the 502 rows of items span
+// several levels of b-tree pages. items gained the extra column after all but its
+// last row were inserted.
+
+func TestRows(t *testing.T) {
+	db, err := Open(filepath.Join("testdata", "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	items, err := db.Rows("ItemTable")
+	if err != nil {
+		t.Fatalf("Rows(ItemTable) error = %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Rows(ItemTable) = %d rows, want 2", len(items))
+	}
+	if items[0]["key"] != "small" || items[0]["value"] != `{"a":1}` {
+		t.Errorf("first row = %v", items[0])
+	}
+	if big, _ := items[1]["value"].([]byte); string(big) != strings.Repeat("x", 5000)+"\n" {
+		t.Errorf("overflowing value has %d bytes, want 5001", len(big))
+	}
+
+	rows, err := db.Rows("items")
+	if err != nil {
+		t.Fatalf("Rows(items) error = %v", err)
+	}
+	if len(rows) != 502 {
+		t.Fatalf("Rows(items) = %d rows, want 502", len(rows))
+	}
+
+	tests := []struct {
+		index int
+		want  Row
+	}{
+		{index: 0, want: Row{"id": nil, "display name": "item 1", "score": 0.5, "n": int64(-249000), "data": nil}},
+		{index: 499, want: Row{"id": nil, "display name": "item 500", "score": 250.0, "n": int64(250000), "data": nil}},
+		{index: 500, want: Row{"id": nil, "display name": "edge", "score": -1.25, "n": int64(-9007199254740993), "data": []byte{0x00, 0xff}}},
+		{index: 501, want: Row{"id": nil, "display name": "last", "score": 0.0, "n": int64(0), "data": nil, "extra": "added"}},
+	}
+	for _, tt := range tests {
+		if got := rows[tt.index]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("row %d = %#v, want %#v", tt.index, got, tt.want)
+		}
+	}
+
+	if _, err := db.Rows("missing"); err == nil {
+		t.Error("Rows() of a missing table should fail")
+	}
+}
+
+// testdata/wal.db and its log wal.db-wal were copied from a connection in WAL mode
+// that inserted 20 rows of items and checkpointed them into wal.db, then committed
+// a transaction updating "item 1" and adding a 21st row. That transaction is only
+// in the log, followed by frames from before the checkpoint restarted it.
+
+func TestRowsWAL(t *testing.T) {
+	db, err := os.ReadFile(filepath.Join("testdata", "wal.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal, err := os.ReadFile(filepath.Join("testdata", "wal.db-wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const frame = 24 + 1024
+	corrupt := append([]byte(nil), wal...)
+	corrupt[32+frame+24+500] ^= 0xff // Inside the commit frame's page
+
+	tests := []struct {
+		name     string
+		wal      []byte // nil means no log
+		rows     int
+		firstRow string
+	}{
+		{name: "committed log", wal: wal, rows: 21, firstRow: "updated"},
+		{name: "no log", rows: 20, firstRow: strings.Repeat("x", 200)},
+		{name: "empty log", wal: []byte{}, rows: 20, firstRow: strings.Repeat("x", 200)},
+		{name: "uncommitted frame", wal: wal[:32+frame], rows: 20, firstRow: strings.Repeat("x", 200)},
+		{name: "bad checksum", wal: corrupt, rows: 20, firstRow: strings.Repeat("x", 200)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "wal.db")
+			if err := os.WriteFile(path, db, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wal != nil {
+				if err := os.WriteFile(path+"-wal", tt.wal, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			db, err := Open(path)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			rows, err := db.Rows("items")
+			if err != nil {
+				t.Fatalf("Rows() error = %v", err)
+			}
+			if len(rows) != tt.rows {
+				t.Fatalf("Rows() = %d rows, want %d", len(rows), tt.rows)
+			}
+			if rows[0]["note"] != tt.firstRow {
+				t.Errorf("first row = %v, want note %q", rows[0], tt.firstRow)
+			}
+			if tt.rows == 21 && rows[20]["name"] != "after checkpoint" {
+				t.Errorf("last row = %v, want the row committed to the log", rows[20])
+			}
+		})
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not.db")
+	if err := os.WriteFile(path, []byte(strings.Repeat("not a database ", 10)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Error("Open() of a non-database file should fail")
+	}
+
+	// A database cut short fails instead of panicking
+	data, err := os.ReadFile(filepath.Join("testdata", "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(t.TempDir(), "truncated.db")
+	if err := os.WriteFile(truncated, data[:3000], 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(truncated)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, err := db.Rows("items"); err == nil {
+		t.Error("Rows() of a truncated database should fail")
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want []column
+	}{
+		{sql: "CREATE TABLE t (a, b TEXT)", want: []column{{name: "a"}, {name: "b"}}},
+		{
+			sql:  "CREATE TABLE t (a INTEGER PRIMARY KEY, `b c` DOUBLE DEFAULT 'x,y', [d] BLOB, PRIMARY KEY(a, d))",
+			want: []column{{name: "a"}, {name: "b c", real: true}, {name: "d"}},
+		},
+		{
+			sql:  `CREATE TABLE "t" ("a" REAL, b CHECK (b IN (1, 2)), "real" TEXT, FOREIGN KEY(b) REFERENCES u(id))`,
+			want: []column{{name: "a", real: true}, {name: "b"}, {name: "real"}},
+		},
+	}
+	for _, tt := range tests {
+		if got := parseColumns(tt.sql); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseColumns(%q) = %+v, want %+v", tt.sql, got, tt.want)
+		}
+	}
+}
@@ -2,17 +2,27 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/josephschmitt/pj/internal/cache"
 	"github.com/josephschmitt/pj/internal/config"
+	"github.com/josephschmitt/pj/internal/daemon"
 	"github.com/josephschmitt/pj/internal/discover"
+	"github.com/josephschmitt/pj/internal/frecency"
+	"github.com/josephschmitt/pj/internal/fsutil"
+	"github.com/josephschmitt/pj/internal/history"
 	"github.com/josephschmitt/pj/internal/icons"
 )
 
@@ -41,6 +51,7 @@ func (l *LabelsFlag) Decode(ctx *kong.DecodeContext) error {
 
 type CLI struct {
 	Config     string   `short:"c" help:"Config file path" type:"path"`
+	Profile    string   `help:"Config profile to overlay on the config file" env:"PJ_PROFILE"`
 	Path       []string `short:"p" help:"Add search path (repeatable)"`
 	Marker     []string `short:"m" help:"Add project marker (repeatable)"`
 	Exclude    []string `short:"e" help:"Exclude pattern (repeatable)"`
@@ -55,15 +66,78 @@ type CLI struct {
 	Ansi       bool     `short:"a" help:"Colorize icons with ANSI codes"`
 	ColorMap   []string `help:"Override icon color (MARKER:COLOR)"`
 	Labels     LabelsFlag `short:"l" help:"Show marker label in output (label or display)"`
-	Format     string   `short:"f" help:"Custom output format (%p=path, %P=full-path, %n=name, %m=marker, %i=icon, %l=label, %L=display-label, %c=color, %w=worktree-parent)" default:""`
+	Format     string   `short:"f" help:"Custom output format (%p=path, %P=full-path, %n=name, %m=marker, %M=matched-file, %i=icon, %l=label, %L=display-label, %c=color, %w=worktree-parent, %v=vcs, %u=remote-url, %h=host, %o=owner, %r=repo, %d=description)" default:""`
 	Shorten     bool     `short:"s" help:"Shorten home directory to ~ in output paths"`
 	NoCache    bool     `help:"Skip cache, force fresh search"`
 	ClearCache bool     `help:"Clear cache and exit"`
-	Sort          string `help:"Sort order: alpha, priority, label (default: priority)" default:"priority" enum:"alpha,priority,label"`
-	SortDirection string `help:"Sort direction: asc, desc (default: desc for priority, asc for alpha/label)" default:"" enum:",asc,desc" name:"sort-direction"`
+	RefreshCache bool   `hidden:"" help:"Refresh the cache without printing results (used for background refreshes)"`
+	Sort          string `help:"Sort order: alpha, priority, label, frecency, history (default: priority)" default:"priority" enum:"alpha,priority,label,frecency,history"`
+	PinnedFirst   bool   `help:"List pinned projects before all others"`
+	Owner         string `help:"Only show projects whose git remote has this owner"`
+	Host          string `help:"Only show projects whose git remote is on this host"`
+	VCS           string `help:"Only show projects managed by this version control system (git, jj, hg, fossil, pijul, svn)" name:"vcs"`
+	SortDirection string `help:"Sort direction: asc, desc (default: desc for priority/frecency/history, asc for alpha/label)" default:"" enum:",asc,desc" name:"sort-direction"`
 	JSON       bool     `short:"j" help:"Output results in JSON format"`
+	Tree       bool     `help:"Render nested projects indented under their parents"`
 	Verbose    bool     `short:"v" help:"Enable debug output"`
 	Version    bool     `short:"V" help:"Show version"`
+
+	Find  struct{} `cmd:"" default:"1" hidden:"" help:"List projects (default command)"`
+	Pin   PinCmd   `cmd:"" help:"Pin a directory so it always appears in results"`
+	Unpin UnpinCmd `cmd:"" help:"Remove a pinned directory"`
+
+	Visit  VisitCmd  `cmd:"" help:"Record a visit to a directory (for --sort frecency)"`
+	Visits struct{}  `cmd:"" help:"List visited directories by frecency"`
+	Forget ForgetCmd `cmd:"" help:"Remove a directory from the visit history"`
+
+	ImportHistory ImportHistoryCmd `cmd:"" name:"import-history" help:"Import navigation history from zoxide, autojump or fasd (for --sort history)"`
+
+	Duplicates struct{} `cmd:"" help:"List repositories that are cloned in more than one place"`
+	Cache      CacheCmd `cmd:"" help:"Inspect and clean up the cache"`
+	Daemon     struct{} `cmd:"" help:"Keep the project index in memory and update it as directories change"`
+}
+
+// PinCmd adds a pinned project to the config file
+type PinCmd struct {
+	Path  string   `arg:"" type:"path" help:"Directory to pin"`
+	Name  string   `help:"Display name (default: directory name)"`
+	As    string   `help:"Treat the directory as having this marker (for icon, color and label)" placeholder:"MARKER"`
+	Label string   `help:"Label override"`
+	Icon  string   `help:"Icon override"`
+	Tag   []string `help:"Tag (repeatable)"`
+}
+
+// VisitCmd records a visit to a directory, usually from a shell or editor hook
+type VisitCmd struct {
+	Path string `arg:"" type:"path" help:"Visited directory"`
+}
+
+// ForgetCmd removes a directory from the visit history
+type ForgetCmd struct {
+	Path string `arg:"" type:"path" help:"Directory to forget"`
+}
+
+// ImportHistoryCmd imports another directory jumper's history into per-project scores
+type ImportHistoryCmd struct {
+	From string `required:"" enum:"zoxide,autojump,fasd" help:"Tool to import from: zoxide, autojump, fasd"`
+	DB   string `name:"db" type:"path" help:"Database to read (default: the tool's standard location)"`
+}
+
+// CacheCmd groups the cache maintenance subcommands
+type CacheCmd struct {
+	Info struct{}   `cmd:"" help:"List cache entries with their roots, age, size and project count"`
+	Gc   CacheGcCmd `cmd:"" name:"gc" help:"Delete stale cache entries and entries for other configs"`
+	Path struct{}   `cmd:"" help:"Print the cache directory"`
+}
+
+// CacheGcCmd removes cache entries that are old or no longer match the config
+type CacheGcCmd struct {
+	OlderThan int `help:"Delete entries not written within this many days" default:"30" placeholder:"DAYS"`
+}
+
+// UnpinCmd removes a pinned project from the config file
+type UnpinCmd struct {
+	Path string `arg:"" type:"path" help:"Pinned directory to remove"`
 }
 
 func shortenHome(path, homeDir string) string {
@@ -95,18 +169,19 @@ func readPathsFromStdin(verbose bool) []string {
 		if path == "" {
 			continue
 		}
-		if strings.HasPrefix(path, "~") {
-			if home, err := os.UserHomeDir(); err == nil {
-				path = filepath.Join(home, path[1:])
-			}
+		expanded := config.ExpandSearchPath(path)
+		if len(expanded) == 0 && verbose {
+			fmt.Fprintf(os.Stderr, "warning: no matches for path: %s\n", path)
 		}
-		if _, err := os.Stat(path); err != nil {
-			if verbose {
-				fmt.Fprintf(os.Stderr, "warning: skipping invalid path: %s\n", path)
+		for _, p := range expanded {
+			if _, err := os.Stat(p); err != nil {
+				if verbose {
+					fmt.Fprintf(os.Stderr, "warning: skipping invalid path: %s\n", p)
+				}
+				continue
 			}
-			continue
+			paths = append(paths, p)
 		}
-		paths = append(paths, path)
 	}
 	return paths
 }
@@ -115,7 +190,7 @@ func formatOutput(format string, values map[string]string) string {
 	const sentinel = "\x00PCT\x00"
 	result := strings.ReplaceAll(format, "%%", sentinel)
 	// Replace %P before %p to avoid %P being partially matched as %p + "P"
-	for _, placeholder := range []string{"%P", "%p", "%n", "%m", "%i", "%L", "%l", "%c", "%w"} {
+	for _, placeholder := range []string{"%P", "%p", "%n", "%m", "%M", "%i", "%L", "%l", "%c", "%w", "%v", "%u", "%h", "%o", "%r", "%d"} {
 		if val, ok := values[placeholder]; ok {
 			result = strings.ReplaceAll(result, placeholder, val)
 		}
@@ -124,9 +199,123 @@ func formatOutput(format string, values map[string]string) string {
 	return result
 }
 
-func sortProjects(projects []discover.Project, sortBy, direction string, mapper *icons.Mapper) {
+// buildTree orders projects so nested projects follow their parent and returns the
+// box-drawing prefix for each entry. Projects whose parent isn't in the list are
+// treated as roots; the relative order of siblings is preserved.
+func buildTree(projects []discover.Project) ([]discover.Project, []string) {
+	present := make(map[string]bool, len(projects))
+	for _, p := range projects {
+		present[p.Path] = true
+	}
+
+	children := make(map[string][]discover.Project)
+	var roots []discover.Project
+	for _, p := range projects {
+		if p.ParentProject != "" && present[p.ParentProject] {
+			children[p.ParentProject] = append(children[p.ParentProject], p)
+		} else {
+			roots = append(roots, p)
+		}
+	}
+
+	ordered := make([]discover.Project, 0, len(projects))
+	prefixes := make([]string, 0, len(projects))
+	var walk func(nodes []discover.Project, indent string, root bool)
+	walk = func(nodes []discover.Project, indent string, root bool) {
+		for i, p := range nodes {
+			prefix, childIndent := "", ""
+			if !root {
+				if i == len(nodes)-1 {
+					prefix, childIndent = indent+"└── ", indent+"    "
+				} else {
+					prefix, childIndent = indent+"├── ", indent+"│   "
+				}
+			}
+			ordered = append(ordered, p)
+			prefixes = append(prefixes, prefix)
+			walk(children[p.Path], childIndent, false)
+		}
+	}
+	walk(roots, "", true)
+
+	return ordered, prefixes
+}
+
+// projectName returns the project's display name, defaulting to the directory name
+func projectName(p discover.Project) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return filepath.Base(p.Path)
+}
+
+// projectIcon returns the project's icon, preferring per-project overrides over the
+// marker's icon and color
+func projectIcon(p discover.Project, mapper *icons.Mapper, ansi bool) string {
+	icon := p.Icon
+	if icon == "" {
+		icon = mapper.Get(p.Marker)
+	}
+	return icons.FormatColor(icon, projectColor(p, mapper), ansi)
+}
+
+// projectColor returns the project's color, preferring a per-project override over the marker color
+func projectColor(p discover.Project, mapper *icons.Mapper) string {
+	if p.Color != "" {
+		return p.Color
+	}
+	return mapper.GetColor(p.Marker)
+}
+
+// projectLabel returns the project's label, preferring a per-project override over the marker label
+func projectLabel(p discover.Project, mapper *icons.Mapper) string {
+	if p.Label != "" {
+		return p.Label
+	}
+	return mapper.GetLabel(p.Marker)
+}
+
+// projectDisplayLabel returns the project's display label; a per-project label override is used as-is
+func projectDisplayLabel(p discover.Project, mapper *icons.Mapper) string {
+	if p.Label != "" {
+		return p.Label
+	}
+	return mapper.GetDisplayLabel(p.Marker)
+}
+
+// filterProjects keeps projects whose git remote matches owner and host and whose
+// version control system matches vcs (all case-insensitive).
+// Empty values don't filter.
+func filterProjects(projects []discover.Project, owner, host, vcs string) []discover.Project {
+	if owner == "" && host == "" && vcs == "" {
+		return projects
+	}
+	filtered := projects[:0]
+	for _, p := range projects {
+		if owner != "" && !strings.EqualFold(p.Owner, owner) {
+			continue
+		}
+		if host != "" && !strings.EqualFold(p.Host, host) {
+			continue
+		}
+		if vcs != "" && !strings.EqualFold(p.VCS, vcs) {
+			continue
+		}
+		filtered = append(filtered, p)
+	}
+	return filtered
+}
+
+// pinnedFirst moves pinned projects ahead of the rest, preserving the existing order within each group
+func pinnedFirst(projects []discover.Project) {
+	sort.SliceStable(projects, func(i, j int) bool {
+		return projects[i].IsPinned && !projects[j].IsPinned
+	})
+}
+
+func sortProjects(projects []discover.Project, sortBy, direction string, mapper *icons.Mapper, scores map[string]float64) {
 	if direction == "" {
-		if sortBy == "priority" {
+		if sortBy == "priority" || sortBy == "frecency" || sortBy == "history" {
 			direction = "desc"
 		} else {
 			direction = "asc"
@@ -144,8 +333,8 @@ func sortProjects(projects []discover.Project, sortBy, direction string, mapper
 			}
 			return projects[i].Path < projects[j].Path
 		case "label":
-			labelI := mapper.GetLabel(projects[i].Marker)
-			labelJ := mapper.GetLabel(projects[j].Marker)
+			labelI := projectLabel(projects[i], mapper)
+			labelJ := projectLabel(projects[j], mapper)
 			if labelI != labelJ {
 				if desc {
 					return labelI > labelJ
@@ -153,6 +342,16 @@ func sortProjects(projects []discover.Project, sortBy, direction string, mapper
 				return labelI < labelJ
 			}
 			return projects[i].Path < projects[j].Path
+		case "frecency", "history":
+			scoreI := scores[projects[i].Path]
+			scoreJ := scores[projects[j].Path]
+			if scoreI != scoreJ {
+				if desc {
+					return scoreI > scoreJ
+				}
+				return scoreI < scoreJ
+			}
+			return projects[i].Path < projects[j].Path
 		default: // "alpha"
 			if desc {
 				return projects[i].Path > projects[j].Path
@@ -162,6 +361,391 @@ func sortProjects(projects []discover.Project, sortBy, direction string, mapper
 	})
 }
 
+// printDuplicates prints groups of duplicate clones as text or JSON.
+// homeDir is non-empty when paths should be shortened.
+func printDuplicates(groups []discover.DuplicateGroup, asJSON bool, homeDir string) {
+	type cloneJSON struct {
+		Path           string    `json:"path"`
+		DisplayPath    string    `json:"displayPath,omitempty"`
+		RemoteURL      string    `json:"remoteUrl"`
+		LastModified   time.Time `json:"lastModified"`
+		IsWorktree     bool      `json:"isWorktree,omitempty"`
+		WorktreeParent string    `json:"worktreeParent,omitempty"`
+	}
+	type groupJSON struct {
+		Repository string      `json:"repository"`
+		Clones     []cloneJSON `json:"clones"`
+	}
+
+	jsonGroups := make([]groupJSON, 0, len(groups))
+	for _, g := range groups {
+		group := groupJSON{Repository: g.Key}
+		for _, p := range g.Projects {
+			displayPath := ""
+			if homeDir != "" {
+				displayPath = shortenHome(p.Path, homeDir)
+			}
+			group.Clones = append(group.Clones, cloneJSON{
+				Path:           p.Path,
+				DisplayPath:    displayPath,
+				RemoteURL:      p.RemoteURL,
+				LastModified:   discover.LastModified(p.Path),
+				IsWorktree:     p.IsWorktree,
+				WorktreeParent: p.WorktreeParent,
+			})
+		}
+		jsonGroups = append(jsonGroups, group)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			Duplicates []groupJSON `json:"duplicates"`
+		}{jsonGroups}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	for i, g := range jsonGroups {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(g.Repository)
+		for _, c := range g.Clones {
+			path := c.Path
+			if c.DisplayPath != "" {
+				path = c.DisplayPath
+			}
+			status := ""
+			if c.IsWorktree {
+				parent := c.WorktreeParent
+				if homeDir != "" {
+					parent = shortenHome(parent, homeDir)
+				}
+				status = "  (worktree of " + parent + ")"
+			}
+			fmt.Printf("  %s  %s%s\n", c.LastModified.Format("2006-01-02 15:04"), path, status)
+		}
+	}
+}
+
+// runPin handles `pj pin`, adding the directory to the config file's projects list
+func runPin(cli *CLI) {
+	configPath, err := config.ResolvePath(cli.Config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving config path: %v\n", err)
+		os.Exit(1)
+	}
+
+	if info, err := os.Stat(cli.Pin.Path); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Error: %s is not a directory\n", cli.Pin.Path)
+		os.Exit(1)
+	}
+
+	project := config.PinnedProject{
+		Path:   cli.Pin.Path,
+		Name:   cli.Pin.Name,
+		Marker: cli.Pin.As,
+		Label:  cli.Pin.Label,
+		Icon:   cli.Pin.Icon,
+		Tags:   cli.Pin.Tag,
+	}
+	if err := config.Pin(configPath, project); err != nil {
+		fmt.Fprintf(os.Stderr, "Error pinning project: %v\n", err)
+		os.Exit(1)
+	}
+	if cli.Verbose {
+		fmt.Fprintf(os.Stderr, "Pinned %s in %s\n", cli.Pin.Path, configPath)
+	}
+	os.Exit(0)
+}
+
+// runUnpin handles `pj unpin`, removing the directory from the config file's projects list
+func runUnpin(cli *CLI) {
+	configPath, err := config.ResolvePath(cli.Config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving config path: %v\n", err)
+		os.Exit(1)
+	}
+
+	removed, err := config.Unpin(configPath, cli.Unpin.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error unpinning project: %v\n", err)
+		os.Exit(1)
+	}
+	if !removed {
+		fmt.Fprintf(os.Stderr, "Error: %s is not pinned\n", cli.Unpin.Path)
+		os.Exit(1)
+	}
+	if cli.Verbose {
+		fmt.Fprintf(os.Stderr, "Unpinned %s from %s\n", cli.Unpin.Path, configPath)
+	}
+	os.Exit(0)
+}
+
+// runVisit handles `pj visit`, recording a visit in the visit history
+func runVisit(cli *CLI) {
+	if info, err := os.Stat(cli.Visit.Path); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Error: %s is not a directory\n", cli.Visit.Path)
+		os.Exit(1)
+	}
+
+	lock := lockVisits()
+	store := loadVisits()
+	store.Visit(cli.Visit.Path, time.Now())
+	err := store.Save()
+	_ = lock.Unlock()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving visit history: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// runVisits handles `pj visits`, listing the visit history by frecency
+func runVisits(cli *CLI) {
+	now := time.Now()
+	entries := loadVisits().Ranked(now)
+
+	homeDir := ""
+	if cli.Shorten {
+		homeDir, _ = os.UserHomeDir()
+	}
+
+	if cli.JSON {
+		type visitJSON struct {
+			frecency.Entry
+			Score float64 `json:"score"`
+		}
+		visits := make([]visitJSON, 0, len(entries))
+		for _, e := range entries {
+			visits = append(visits, visitJSON{Entry: e, Score: e.Score(now)})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			Visits []visitJSON `json:"visits"`
+		}{visits}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	for _, e := range entries {
+		fmt.Printf("%8.1f  %s  %s\n", e.Score(now), e.LastVisit.Format("2006-01-02 15:04"), shortenHome(e.Path, homeDir))
+	}
+	os.Exit(0)
+}
+
+// runForget handles `pj forget`, removing a directory from the visit history
+func runForget(cli *CLI) {
+	lock := lockVisits()
+	store := loadVisits()
+	if !store.Forget(cli.Forget.Path) {
+		fmt.Fprintf(os.Stderr, "Error: %s is not in the visit history\n", cli.Forget.Path)
+		os.Exit(1)
+	}
+	err := store.Save()
+	_ = lock.Unlock()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving visit history: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// lockVisits takes the lock held while the visit history is changed, exiting if it
+// can't be taken. Exiting releases it too.
+func lockVisits() *fsutil.Lock {
+	lock, err := frecency.Lock(frecency.DefaultPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error locking visit history: %v\n", err)
+		os.Exit(1)
+	}
+	return lock
+}
+
+// loadVisits reads the visit history, exiting if it can't be read
+func loadVisits() *frecency.Store {
+	store, err := frecency.Load(frecency.DefaultPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading visit history: %v\n", err)
+		os.Exit(1)
+	}
+	return store
+}
+
+// visitScores returns each project's frecency; projects that were never visited score 0
+func visitScores(projects []discover.Project, verbose bool) map[string]float64 {
+	store, err := frecency.Load(frecency.DefaultPath())
+	if err != nil {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Warning: failed to load visit history: %v\n", err)
+		}
+		return nil
+	}
+	paths := make([]string, len(projects))
+	for i, p := range projects {
+		paths[i] = p.Path
+	}
+	return store.ProjectScores(paths, time.Now())
+}
+
+// runImportHistory handles `pj import-history`, scoring the discovered projects by
+// another tool's history
+func runImportHistory(cli *CLI, projects []discover.Project) {
+	importer := history.Importers[cli.ImportHistory.From]
+	database := cli.ImportHistory.DB
+	if database == "" {
+		database = importer.DefaultPath()
+	}
+
+	store, err := history.Load(history.DefaultPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading imported history: %v\n", err)
+		os.Exit(1)
+	}
+
+	paths := make([]string, len(projects))
+	for i, p := range projects {
+		paths[i] = p.Path
+	}
+	matched, total, err := store.Import(importer, database, paths, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error importing history: %v\n", err)
+		os.Exit(1)
+	}
+	if err := store.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving imported history: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Imported %d of %d %s entries into %d projects\n", matched, total, importer.Name, len(store.Sources[importer.Name].Projects))
+	os.Exit(0)
+}
+
+// historyScores returns each project's imported score; projects without history score 0
+func historyScores(verbose bool) map[string]float64 {
+	store, err := history.Load(history.DefaultPath())
+	if err != nil {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Warning: failed to load imported history: %v\n", err)
+		}
+		return nil
+	}
+	return store.Scores()
+}
+
+// runCacheInfo handles `pj cache info`, listing what the cache directory holds
+func runCacheInfo(cli *CLI, cacheManager *cache.Manager, homeDir string) {
+	entries, err := cacheManager.Entries()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading cache: %v\n", err)
+		os.Exit(1)
+	}
+
+	if cli.JSON {
+		if entries == nil {
+			entries = []cache.Entry{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			Dir     string        `json:"dir"`
+			Entries []cache.Entry `json:"entries"`
+		}{cacheManager.Dir(), entries}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+		roots := make([]string, len(e.Roots))
+		for i, root := range e.Roots {
+			roots[i] = shortenHome(root, homeDir)
+		}
+		status := ""
+		switch {
+		case e.Error != "":
+			status = "  (unreadable: " + e.Error + ")"
+		case e.Current:
+			status = "  (current)"
+		}
+		if e.Profile != "" {
+			status = "  [" + e.Profile + "]" + status
+		}
+		projects := "-"
+		if e.Kind == cache.KindResults || e.Kind == cache.KindShard {
+			projects = strconv.Itoa(e.Projects)
+		}
+		fmt.Printf("%-7s  %5s  %9s  %6s  %s%s\n", e.Kind, formatAge(time.Since(e.ModTime)), formatSize(e.Size), projects, strings.Join(roots, ", "), status)
+	}
+	fmt.Printf("%d entries, %s in %s\n", len(entries), formatSize(total), shortenHome(cacheManager.Dir(), homeDir))
+	os.Exit(0)
+}
+
+// runCacheGC handles `pj cache gc`, deleting stale entries and those for other configs
+func runCacheGC(cli *CLI, cacheManager *cache.Manager) {
+	removed, err := cacheManager.GC(time.Duration(cli.Cache.Gc.OlderThan) * 24 * time.Hour)
+	var freed int64
+	for _, e := range removed {
+		freed += e.Size
+	}
+	fmt.Printf("Removed %d cache entries (%s)\n", len(removed), formatSize(freed))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error cleaning cache: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// runDaemon handles `pj daemon`, serving the index until interrupted
+func runDaemon(cli *CLI, cfg *config.Config, cacheManager *cache.Manager) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := daemon.New(cfg, cacheManager, cli.Verbose).Run(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Error running daemon: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// formatAge renders a duration in its largest whole unit, e.g. 42s, 5m, 3h or 12d
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+// formatSize renders a byte count with a binary unit, e.g. 512 B or 12.4 KiB
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func main() {
 	var cli CLI
 	ctx := kong.Parse(&cli,
@@ -175,7 +759,20 @@ func main() {
 		os.Exit(0)
 	}
 
-	cfg, err := config.LoadWithVerbose(cli.Config, cli.Verbose)
+	switch ctx.Command() {
+	case "pin <path>":
+		runPin(&cli)
+	case "unpin <path>":
+		runUnpin(&cli)
+	case "visit <path>":
+		runVisit(&cli)
+	case "visits":
+		runVisits(&cli)
+	case "forget <path>":
+		runForget(&cli)
+	}
+
+	cfg, err := config.LoadProfile(cli.Config, cli.Profile, cli.Verbose)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 		os.Exit(1)
@@ -192,7 +789,7 @@ func main() {
 	}
 
 	stdinMode := false
-	if stdinIsPiped() {
+	if stdinIsPiped() && !strings.HasPrefix(ctx.Command(), "cache ") && ctx.Command() != "daemon" {
 		stdinPaths := readPathsFromStdin(cli.Verbose)
 		if len(stdinPaths) > 0 {
 			cfg.SearchPaths = stdinPaths
@@ -227,8 +824,21 @@ func main() {
 		}
 	}
 
+	cache.Version = version
 	cacheManager := cache.New(cfg, cli.Verbose)
 
+	switch ctx.Command() {
+	case "daemon":
+		runDaemon(&cli, cfg, cacheManager)
+	case "cache info":
+		runCacheInfo(&cli, cacheManager, homeDir)
+	case "cache gc":
+		runCacheGC(&cli, cacheManager)
+	case "cache path":
+		fmt.Println(cacheManager.Dir())
+		os.Exit(0)
+	}
+
 	if cli.ClearCache {
 		if err := cacheManager.Clear(); err != nil {
 			fmt.Fprintf(os.Stderr, "Error clearing cache: %v\n", err)
@@ -240,23 +850,118 @@ func main() {
 		os.Exit(0)
 	}
 
+	if cli.RefreshCache {
+		// Background refresher spawned by stale-while-revalidate. The lock is only held
+		// while this process runs, so exiting early can't leave it behind.
+		refresh, err := cacheManager.TryLockRefresh()
+		if err != nil || refresh == nil {
+			return // Another refresher got there first
+		}
+		defer func() { _ = refresh.Unlock() }()
+		lock, err := cacheManager.LockDiscovery()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error locking cache: %v\n", err)
+			return
+		}
+		defer func() { _ = lock.Unlock() }()
+		projects, walks, err := discover.New(cfg, cli.Verbose).DiscoverIncremental(cacheManager.LoadShard)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error discovering projects: %v\n", err)
+			return
+		}
+		for _, walk := range walks {
+			if err := cacheManager.SetShard(walk); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing cache shard: %v\n", err)
+			}
+		}
+		if err := cacheManager.Set(projects); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing cache: %v\n", err)
+		}
+		return
+	}
+
 	var projects []discover.Project
 
+	// A running daemon answers from memory; without one, fall back to the cache
 	if !cli.NoCache && !stdinMode {
+		if indexed, err := daemon.Query(daemon.SocketPath(cacheManager), cacheManager.Fingerprint()); err == nil {
+			if cli.Verbose {
+				fmt.Fprintf(os.Stderr, "Using daemon results (%d projects)\n", len(indexed))
+			}
+			projects = indexed
+		} else if cli.Verbose && !errors.Is(err, daemon.ErrNotRunning) {
+			fmt.Fprintf(os.Stderr, "Daemon unavailable: %v\n", err)
+		}
+	}
+
+	// Results for the whole set of search paths are cached together for the fast path.
+	// Piped paths change from run to run, so stdin mode only uses the per-root shards.
+	if projects == nil && !cli.NoCache && !stdinMode {
 		cached, err := cacheManager.Get()
 		if err == nil && cached != nil {
 			if cli.Verbose {
 				fmt.Fprintf(os.Stderr, "Using cached results (%d projects)\n", len(cached))
 			}
 			projects = cached
-		} else if cli.Verbose && err != nil {
-			fmt.Fprintf(os.Stderr, "Cache miss: %v\n", err)
+		} else {
+			if cli.Verbose && err != nil {
+				fmt.Fprintf(os.Stderr, "Cache miss: %v\n", err)
+			}
+			if cfg.CacheMode == config.CacheModeStaleWhileRevalidate {
+				if stale, err := cacheManager.GetStale(); err == nil {
+					if cli.Verbose {
+						fmt.Fprintf(os.Stderr, "Using stale cached results (%d projects)\n", len(stale))
+					}
+					projects = stale
+					if err := cacheManager.RefreshInBackground(append(os.Args[1:], "--refresh-cache")); err != nil && cli.Verbose {
+						fmt.Fprintf(os.Stderr, "Warning: failed to start background cache refresh: %v\n", err)
+					}
+				}
+			}
+		}
+	}
+
+	// Only one invocation rediscovers at a time. Others show the previous results if
+	// there are any, or wait for the rediscovery to finish and use what it cached.
+	var discoveryLock *cache.Lock
+	if projects == nil && !cli.NoCache {
+		lock, err := cacheManager.TryLockDiscovery()
+		if err != nil && cli.Verbose {
+			fmt.Fprintf(os.Stderr, "Warning: failed to lock cache: %v\n", err)
+		}
+		if lock == nil && err == nil {
+			if stale, err := cacheManager.GetStale(); err == nil && !stdinMode {
+				if cli.Verbose {
+					fmt.Fprintf(os.Stderr, "Another pj is rediscovering, using previous results (%d projects)\n", len(stale))
+				}
+				projects = stale
+			} else {
+				if cli.Verbose {
+					fmt.Fprintf(os.Stderr, "Waiting for another pj to finish rediscovering\n")
+				}
+				if lock, err = cacheManager.LockDiscovery(); err != nil && cli.Verbose {
+					fmt.Fprintf(os.Stderr, "Warning: failed to lock cache: %v\n", err)
+				}
+				if !stdinMode {
+					if cached, err := cacheManager.Get(); err == nil {
+						projects = cached
+					}
+				}
+			}
 		}
+		discoveryLock = lock
 	}
 
 	if projects == nil {
 		discoverer := discover.New(cfg, cli.Verbose)
-		projects, err = discoverer.Discover()
+		// Reuse each search root's cached shard: fresh shards as they are, expired ones
+		// revalidated against the filesystem
+		var loadShard discover.WalkLoader
+		if !cli.NoCache {
+			loadShard = cacheManager.LoadShard
+		}
+		var walks []discover.WalkState
+		projects, walks, err = discoverer.DiscoverIncremental(loadShard)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error discovering projects: %v\n", err)
 			os.Exit(1)
@@ -266,14 +971,41 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Discovered %d projects\n", len(projects))
 		}
 
+		for _, walk := range walks {
+			if err := cacheManager.SetShard(walk); err != nil && cli.Verbose {
+				fmt.Fprintf(os.Stderr, "Warning: failed to cache walk of %s: %v\n", walk.Root, err)
+			}
+		}
 		if !stdinMode {
 			if err := cacheManager.Set(projects); err != nil && cli.Verbose {
 				fmt.Fprintf(os.Stderr, "Warning: failed to cache results: %v\n", err)
 			}
 		}
 	}
+	_ = discoveryLock.Unlock()
+
+	projects = filterProjects(projects, cli.Owner, cli.Host, cli.VCS)
 
-	sortProjects(projects, cli.Sort, cli.SortDirection, iconMapper)
+	if ctx.Command() == "duplicates" {
+		printDuplicates(discover.FindDuplicates(projects), cli.JSON, homeDir)
+		ctx.Exit(0)
+	}
+
+	if ctx.Command() == "import-history" {
+		runImportHistory(&cli, projects)
+	}
+
+	var scores map[string]float64
+	switch cli.Sort {
+	case "frecency":
+		scores = visitScores(projects, cli.Verbose)
+	case "history":
+		scores = historyScores(cli.Verbose)
+	}
+	sortProjects(projects, cli.Sort, cli.SortDirection, iconMapper, scores)
+	if cli.PinnedFirst {
+		pinnedFirst(projects)
+	}
 
 	if cli.JSON {
 		type projectJSON struct {
@@ -281,13 +1013,25 @@ func main() {
 			DisplayPath         string `json:"displayPath,omitempty"`
 			Name                string `json:"name"`
 			Marker              string `json:"marker"`
+			MatchedFile         string `json:"matchedFile,omitempty"`
 			MarkerLabel         string `json:"markerLabel"`
 			MarkerDisplayLabel  string `json:"markerDisplayLabel,omitempty"`
 			Icon                string `json:"icon,omitempty"`
 			AnsiIcon            string `json:"ansiIcon,omitempty"`
 			Color               string `json:"color,omitempty"`
 			IsWorktree          bool   `json:"isWorktree,omitempty"`
+			IsPinned            bool     `json:"isPinned,omitempty"`
+			Tags                []string `json:"tags,omitempty"`
 			WorktreeParent      string `json:"worktreeParent,omitempty"`
+			VCS                 string `json:"vcs,omitempty"`
+			ParentProject       string `json:"parentProject,omitempty"`
+			RemoteURL           string `json:"remoteUrl,omitempty"`
+			Host                string `json:"host,omitempty"`
+			Owner               string `json:"owner,omitempty"`
+			Repo                string `json:"repo,omitempty"`
+			Depth               int    `json:"depth,omitempty"`
+			Source              string `json:"source,omitempty"`
+			Description         string `json:"description,omitempty"`
 		}
 		type outputJSON struct {
 			Projects []projectJSON `json:"projects"`
@@ -299,32 +1043,44 @@ func main() {
 			ansiIcon := ""
 			color := ""
 			if cli.Icons {
-				icon = iconMapper.Get(p.Marker)
-				color = iconMapper.GetColor(p.Marker)
+				icon = projectIcon(p, iconMapper, false)
+				color = projectColor(p, iconMapper)
 				if cli.Ansi {
-					ansiIcon = iconMapper.Format(p.Marker, true)
+					ansiIcon = projectIcon(p, iconMapper, true)
 				}
 			}
 			displayPath := ""
 			if cli.Shorten {
 				displayPath = shortenHome(p.Path, homeDir)
 			}
-			displayLabel := iconMapper.GetDisplayLabel(p.Marker)
+			displayLabel := projectDisplayLabel(p, iconMapper)
 			if p.IsWorktree && displayLabel != "" {
 				displayLabel += " (worktree)"
 			}
 			jsonProjects[i] = projectJSON{
 				Path:               p.Path,
 				DisplayPath:        displayPath,
-				Name:               filepath.Base(p.Path),
+				Name:               projectName(p),
 				Marker:             p.Marker,
-				MarkerLabel:        iconMapper.GetLabel(p.Marker),
+				MatchedFile:        p.MatchedFile,
+				MarkerLabel:        projectLabel(p, iconMapper),
 				MarkerDisplayLabel: displayLabel,
 				Icon:               icon,
 				AnsiIcon:           ansiIcon,
 				Color:              color,
 				IsWorktree:         p.IsWorktree,
+				IsPinned:           p.IsPinned,
+				Tags:               p.Tags,
 				WorktreeParent:     p.WorktreeParent,
+				VCS:                p.VCS,
+				ParentProject:      p.ParentProject,
+				RemoteURL:          p.RemoteURL,
+				Host:               p.Host,
+				Owner:              p.Owner,
+				Repo:               p.Repo,
+				Depth:              p.Depth,
+				Source:             p.Source,
+				Description:        p.Description,
 			}
 		}
 
@@ -334,46 +1090,52 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
 			os.Exit(1)
 		}
-	} else if cli.Format != "" {
-		for _, p := range projects {
-			icon := ""
-			if cli.Icons {
-				icon = iconMapper.Format(p.Marker, cli.Ansi)
-			}
-			displayPath := p.Path
-			if cli.Shorten {
-				displayPath = shortenHome(p.Path, homeDir)
-			}
-			displayLabel := iconMapper.GetDisplayLabel(p.Marker)
-			if p.IsWorktree && displayLabel != "" {
-				displayLabel += " (worktree)"
-			}
-			values := map[string]string{
-				"%p": displayPath,
-				"%P": p.Path,
-				"%n": filepath.Base(p.Path),
-				"%m": p.Marker,
-				"%i": icon,
-				"%l": icons.FormatLabel(iconMapper.GetLabel(p.Marker), cli.Ansi),
-				"%L": icons.FormatLabel(displayLabel, cli.Ansi),
-				"%c": iconMapper.GetColor(p.Marker),
-				"%w": p.WorktreeParent,
-			}
-			fmt.Println(formatOutput(cli.Format, values))
-		}
 	} else {
-		for _, p := range projects {
-			output := p.Path
-			if cli.Shorten {
-				output = shortenHome(output, homeDir)
+		// formatLine renders a single project using --format, or the default
+		// icon/label/path layout; path is the (possibly shortened) path to show
+		formatLine := func(p discover.Project, path string) string {
+			if cli.Format != "" {
+				icon := ""
+				if cli.Icons {
+					icon = projectIcon(p, iconMapper, cli.Ansi)
+				}
+				displayPath := p.Path
+				if cli.Shorten {
+					displayPath = shortenHome(p.Path, homeDir)
+				}
+				displayLabel := projectDisplayLabel(p, iconMapper)
+				if p.IsWorktree && displayLabel != "" {
+					displayLabel += " (worktree)"
+				}
+				values := map[string]string{
+					"%p": displayPath,
+					"%P": p.Path,
+					"%n": projectName(p),
+					"%m": p.Marker,
+					"%M": p.MatchedFile,
+					"%i": icon,
+					"%l": icons.FormatLabel(projectLabel(p, iconMapper), cli.Ansi),
+					"%L": icons.FormatLabel(displayLabel, cli.Ansi),
+					"%c": projectColor(p, iconMapper),
+					"%w": p.WorktreeParent,
+					"%v": p.VCS,
+					"%u": p.RemoteURL,
+					"%h": p.Host,
+					"%o": p.Owner,
+					"%r": p.Repo,
+					"%d": p.Description,
+				}
+				return formatOutput(cli.Format, values)
 			}
+
+			output := path
 			if cli.Labels != "" {
 				label := ""
 				switch string(cli.Labels) {
 				case "label":
-					label = iconMapper.GetLabel(p.Marker)
+					label = projectLabel(p, iconMapper)
 				case "display":
-					label = iconMapper.GetDisplayLabel(p.Marker)
+					label = projectDisplayLabel(p, iconMapper)
 				}
 				if p.IsWorktree && label != "" {
 					label += " (worktree)"
@@ -383,10 +1145,34 @@ func main() {
 				}
 			}
 			if cli.Icons && !cli.Strip {
-				icon := iconMapper.Format(p.Marker, cli.Ansi)
+				icon := projectIcon(p, iconMapper, cli.Ansi)
 				output = fmt.Sprintf("%s %s", icon, output)
 			}
-			fmt.Println(output)
+			return output
+		}
+
+		if cli.Tree {
+			ordered, prefixes := buildTree(projects)
+			for i, p := range ordered {
+				path := p.Path
+				if prefixes[i] != "" {
+					// Nested entries are shown relative to the parent drawn above them
+					if rel, err := filepath.Rel(p.ParentProject, p.Path); err == nil {
+						path = rel
+					}
+				} else if cli.Shorten {
+					path = shortenHome(path, homeDir)
+				}
+				fmt.Println(prefixes[i] + formatLine(p, path))
+			}
+		} else {
+			for _, p := range projects {
+				path := p.Path
+				if cli.Shorten {
+					path = shortenHome(path, homeDir)
+				}
+				fmt.Println(formatLine(p, path))
+			}
 		}
 	}
 
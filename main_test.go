@@ -2,15 +2,21 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/josephschmitt/pj/internal/cache"
+	"github.com/josephschmitt/pj/internal/config"
 	"github.com/josephschmitt/pj/internal/discover"
+	"github.com/josephschmitt/pj/internal/frecency"
 	"github.com/josephschmitt/pj/internal/icons"
 )
 
@@ -33,6 +39,9 @@ func TestMain(m *testing.M) {
 		os.Exit(1)
 	}
 
+	// The profile comes from the environment; don't let the developer's leak into tests
+	_ = os.Unsetenv("PJ_PROFILE")
+
 	// Run tests
 	code := m.Run()
 
@@ -45,6 +54,7 @@ func TestMain(m *testing.M) {
 type testEnv struct {
 	configDir string
 	cacheDir  string
+	dataDir   string
 	t         *testing.T
 }
 
@@ -53,6 +63,7 @@ func setupTestEnv(t *testing.T) *testEnv {
 	t.Helper()
 	tmpConfig := t.TempDir()
 	tmpCache := t.TempDir()
+	tmpData := t.TempDir()
 
 	// Create an empty config file to override defaults
 	configDir := filepath.Join(tmpConfig, "pj")
@@ -98,6 +109,7 @@ icons:
 	return &testEnv{
 		configDir: tmpConfig,
 		cacheDir:  tmpCache,
+		dataDir:   tmpData,
 		t:         t,
 	}
 }
@@ -110,6 +122,7 @@ func (env *testEnv) runPJ(args ...string) (string, string, error) {
 	cmd.Env = append(os.Environ(),
 		"XDG_CONFIG_HOME="+env.configDir,
 		"XDG_CACHE_HOME="+env.cacheDir,
+		"XDG_DATA_HOME="+env.dataDir,
 	)
 
 	// Capture stdout and stderr
@@ -129,6 +142,7 @@ func (env *testEnv) runPJWithStdin(stdin string, args ...string) (string, string
 	cmd.Env = append(os.Environ(),
 		"XDG_CONFIG_HOME="+env.configDir,
 		"XDG_CACHE_HOME="+env.cacheDir,
+		"XDG_DATA_HOME="+env.dataDir,
 	)
 
 	// Set up stdin
@@ -525,6 +539,27 @@ func TestCLI_StdinInvalidPaths(t *testing.T) {
 	}
 }
 
+func TestCLI_StdinGlobPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	env := setupTestEnv(t)
+
+	createTestProject(t, filepath.Join(tmpDir, "a", "code"), "proj-a", ".git/")
+	createTestProject(t, filepath.Join(tmpDir, "b", "code"), "proj-b", ".git/")
+
+	stdin := filepath.Join(tmpDir, "*", "code") + "\n" + filepath.Join(tmpDir, "missing-*") + "\n"
+	stdout, stderr, err := env.runPJWithStdin(stdin, "--no-cache", "-v")
+	if err != nil {
+		t.Fatalf("pj with stdin failed: %v\nStderr: %s", err, stderr)
+	}
+
+	if !strings.Contains(stdout, "proj-a") || !strings.Contains(stdout, "proj-b") {
+		t.Errorf("Output should contain both glob-matched projects\nStdout: %s", stdout)
+	}
+	if !strings.Contains(stderr, "no matches for path") {
+		t.Errorf("Stderr should report the unmatched glob\nStderr: %s", stderr)
+	}
+}
+
 func TestCLI_StdinInvalidPathsSilent(t *testing.T) {
 	tmpDir := t.TempDir()
 	env := setupTestEnv(t)
@@ -551,7 +586,158 @@ func TestCLI_StdinInvalidPathsSilent(t *testing.T) {
 	}
 }
 
-func TestCLI_StdinSkipsCache(t *testing.T) {
+func TestCLI_CacheRevalidation(t *testing.T) {
+	tmpDir := t.TempDir()
+	env := setupTestEnv(t)
+
+	createTestProject(t, tmpDir, "first", ".git/")
+	if _, stderr, err := env.runPJ("-p", tmpDir); err != nil {
+		t.Fatalf("First run failed: %v\nStderr: %s", err, stderr)
+	}
+
+	// Expire the cache and its per-root shards without losing the walk state they hold
+	expireCache := func() {
+		t.Helper()
+		files, _ := filepath.Glob(filepath.Join(env.cacheDir, "pj", "*.json"))
+		if len(files) == 0 {
+			t.Fatal("no cache file written")
+		}
+		old := time.Now().Add(-time.Hour)
+		for _, f := range files {
+			if err := os.Chtimes(f, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	expireCache()
+	_, stderr, err := env.runPJ("-p", tmpDir, "-v")
+	if err != nil {
+		t.Fatalf("Unchanged run failed: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stderr, "Unchanged since last walk") {
+		t.Errorf("expired cache with no changes should be revalidated without walking\nStderr: %s", stderr)
+	}
+
+	createTestProject(t, tmpDir, "second", "go.mod")
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(tmpDir, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	expireCache()
+	stdout, stderr, err := env.runPJ("-p", tmpDir, "-v")
+	if err != nil {
+		t.Fatalf("Changed run failed: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stderr, "Re-walking 1 changed subtree(s)") {
+		t.Errorf("expected the changed root to be re-walked\nStderr: %s", stderr)
+	}
+	if !strings.Contains(stdout, "first") || !strings.Contains(stdout, "second") {
+		t.Errorf("revalidated output = %q, want both projects", stdout)
+	}
+}
+
+func TestCLI_StaleWhileRevalidate(t *testing.T) {
+	tmpDir := t.TempDir()
+	env := setupTestEnv(t)
+
+	configContent := `search_paths: []
+markers:
+  - .git
+  - go.mod
+max_depth: 3
+cache_mode: stale-while-revalidate
+`
+	configPath := filepath.Join(env.configDir, "pj", "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	createTestProject(t, tmpDir, "first", ".git/")
+	if _, stderr, err := env.runPJ("-p", tmpDir); err != nil {
+		t.Fatalf("First run failed: %v\nStderr: %s", err, stderr)
+	}
+
+	cacheFiles, _ := filepath.Glob(filepath.Join(env.cacheDir, "pj", "cache-*.json"))
+	if len(cacheFiles) != 1 {
+		t.Fatalf("expected one cache file, found %v", cacheFiles)
+	}
+	allFiles, _ := filepath.Glob(filepath.Join(env.cacheDir, "pj", "*.json"))
+	old := time.Now().Add(-time.Hour)
+	for _, f := range allFiles {
+		if err := os.Chtimes(f, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createTestProject(t, tmpDir, "second", "go.mod")
+
+	// Hold the refresh lock so the expired cache is served without spawning a refresher
+	t.Setenv("XDG_CACHE_HOME", env.cacheDir)
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.SearchPaths = append(cfg.SearchPaths, tmpDir)
+	cacheManager := cache.New(cfg, false)
+	if want := "cache-" + cacheManager.Key() + ".json"; filepath.Base(cacheFiles[0]) != want {
+		t.Fatalf("cache file = %s, want %s for the settings pj ran with", cacheFiles[0], want)
+	}
+	lock, err := cacheManager.TryLockRefresh()
+	if err != nil || lock == nil {
+		t.Fatalf("TryLockRefresh() = %v, %v", lock, err)
+	}
+	stdout, stderr, err := env.runPJ("-p", tmpDir, "-v")
+	if err != nil {
+		t.Fatalf("Locked run failed: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stderr, "Cache refresh already in progress") {
+		t.Errorf("expected no second refresher while locked\nStderr: %s", stderr)
+	}
+	if strings.Contains(stdout, "second") {
+		t.Errorf("stale run should print cached results only, got %q", stdout)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err = env.runPJ("-p", tmpDir, "-v")
+	if err != nil {
+		t.Fatalf("Stale run failed: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stderr, "Using stale cached results") || !strings.Contains(stderr, "Refreshing cache in background") {
+		t.Errorf("expected stale results and a background refresh\nStderr: %s", stderr)
+	}
+	if !strings.Contains(stdout, "first") || strings.Contains(stdout, "second") {
+		t.Errorf("stale run output = %q, want only the cached project", stdout)
+	}
+
+	// The refresher releases its lock once the new cache is written. Give it a moment
+	// to take the lock first.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if cached, err := cacheManager.Get(); err == nil && cached != nil {
+			if lock, err := cacheManager.TryLockRefresh(); err == nil && lock != nil {
+				_ = lock.Unlock()
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background refresh didn't finish")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	stdout, stderr, err = env.runPJ("-p", tmpDir, "-v")
+	if err != nil {
+		t.Fatalf("Refreshed run failed: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stderr, "Using cached results") || !strings.Contains(stdout, "second") {
+		t.Errorf("expected refreshed cache to include the new project\nStdout: %s\nStderr: %s", stdout, stderr)
+	}
+}
+
+func TestCLI_StdinReusesShards(t *testing.T) {
 	tmpDir := t.TempDir()
 	env := setupTestEnv(t)
 
@@ -567,7 +753,7 @@ func TestCLI_StdinSkipsCache(t *testing.T) {
 		t.Error("First run should find project")
 	}
 
-	if strings.Contains(stderr1, "Using cached results") {
+	if strings.Contains(stderr1, "Using cached") {
 		t.Error("stdin mode should not use cache on first run")
 	}
 
@@ -583,7 +769,151 @@ func TestCLI_StdinSkipsCache(t *testing.T) {
 	}
 
 	if strings.Contains(stderr2, "Using cached results") {
-		t.Error("stdin mode should never use cache, even on subsequent runs")
+		t.Error("stdin mode should never use the combined results cache")
+	}
+	if !strings.Contains(stderr2, "Using cached shard for "+tmpDir) {
+		t.Errorf("stdin mode should reuse the shard for a piped root\nStderr: %s", stderr2)
+	}
+}
+
+func TestCLI_CacheShardsPerRoot(t *testing.T) {
+	rootA := t.TempDir()
+	rootB := t.TempDir()
+	env := setupTestEnv(t)
+
+	createTestProject(t, rootA, "a", ".git/")
+	createTestProject(t, rootB, "b", ".git/")
+
+	if _, stderr, err := env.runPJ("-p", rootA); err != nil {
+		t.Fatalf("First run failed: %v\nStderr: %s", err, stderr)
+	}
+
+	// Adding a search path walks only the new root
+	stdout, stderr, err := env.runPJ("-p", rootA, "-p", rootB, "-v")
+	if err != nil {
+		t.Fatalf("Second run failed: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stderr, "Using cached shard for "+rootA) {
+		t.Errorf("expected the existing root's shard to be reused\nStderr: %s", stderr)
+	}
+	if strings.Contains(stderr, "Searching "+rootA) || !strings.Contains(stderr, "Searching "+rootB) {
+		t.Errorf("expected only the new root to be walked\nStderr: %s", stderr)
+	}
+	if !strings.Contains(stdout, "/a\n") || !strings.Contains(stdout, "/b\n") {
+		t.Errorf("output = %q, want projects from both roots", stdout)
+	}
+}
+
+func TestCLI_CacheSubcommands(t *testing.T) {
+	rootA := t.TempDir()
+	rootB := t.TempDir()
+	env := setupTestEnv(t)
+
+	createTestProject(t, rootA, "a", ".git/")
+	createTestProject(t, rootB, "b", ".git/")
+
+	stdout, stderr, err := env.runPJ("cache", "path")
+	if err != nil {
+		t.Fatalf("cache path failed: %v\nStderr: %s", err, stderr)
+	}
+	if want := filepath.Join(env.cacheDir, "pj"); strings.TrimSpace(stdout) != want {
+		t.Errorf("cache path = %q, want %q", strings.TrimSpace(stdout), want)
+	}
+
+	for _, root := range []string{rootA, rootB} {
+		if _, stderr, err := env.runPJ("-p", root); err != nil {
+			t.Fatalf("run with -p %s failed: %v\nStderr: %s", root, err, stderr)
+		}
+	}
+
+	stdout, stderr, err = env.runPJ("cache", "info", "--json", "-p", rootA)
+	if err != nil {
+		t.Fatalf("cache info failed: %v\nStderr: %s", err, stderr)
+	}
+	var info struct {
+		Entries []struct {
+			Kind     string   `json:"kind"`
+			Roots    []string `json:"roots"`
+			Projects int      `json:"projects"`
+			Current  bool     `json:"current"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &info); err != nil {
+		t.Fatalf("cache info output isn't JSON: %v\n%s", err, stdout)
+	}
+	current := map[string]bool{}
+	for _, e := range info.Entries {
+		if e.Kind == "results" {
+			current[strings.Join(e.Roots, ",")] = e.Current
+			if e.Projects != 1 {
+				t.Errorf("results entry for %v has %d projects, want 1", e.Roots, e.Projects)
+			}
+		}
+	}
+	if len(current) != 2 || !current[rootA] || current[rootB] {
+		t.Errorf("results entries current = %v, want only %s", current, rootA)
+	}
+
+	// gc keeps what the current config uses, including shards of other roots
+	stdout, stderr, err = env.runPJ("cache", "gc", "-p", rootA)
+	if err != nil {
+		t.Fatalf("cache gc failed: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Removed 2 cache entries") {
+		t.Errorf("cache gc output = %q, want the other config's results and lock removed", stdout)
+	}
+	_, stderr, err = env.runPJ("-p", rootA, "-v")
+	if err != nil {
+		t.Fatalf("run after gc failed: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stderr, "Using cached results") {
+		t.Errorf("expected the current config's cache to survive gc\nStderr: %s", stderr)
+	}
+}
+
+func TestCLI_Daemon(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stopping the daemon with an interrupt isn't supported on Windows")
+	}
+	tmpDir := t.TempDir()
+	env := setupTestEnv(t)
+	createTestProject(t, tmpDir, "project", ".git/")
+
+	server := exec.Command(binaryPath, "daemon", "-p", tmpDir)
+	server.Env = append(os.Environ(), "XDG_CONFIG_HOME="+env.configDir, "XDG_CACHE_HOME="+env.cacheDir, "XDG_DATA_HOME="+env.dataDir)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = server.Process.Signal(os.Interrupt)
+		_ = server.Wait()
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stdout, stderr, err := env.runPJ("-p", tmpDir, "-v")
+		if err != nil {
+			t.Fatalf("pj failed: %v\nStderr: %s", err, stderr)
+		}
+		if strings.Contains(stderr, "Using daemon results (1 projects)") {
+			if !strings.Contains(stdout, "project") {
+				t.Errorf("output = %q, want the daemon's project", stdout)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pj never used the daemon\nStderr: %s", stderr)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Other settings fall back to the cache
+	stdout, stderr, err := env.runPJ("-p", tmpDir, "-d", "2", "-v")
+	if err != nil {
+		t.Fatalf("pj with other settings failed: %v\nStderr: %s", err, stderr)
+	}
+	if strings.Contains(stderr, "Using daemon results") || !strings.Contains(stdout, "project") {
+		t.Errorf("expected a fallback to normal discovery\nStdout: %s\nStderr: %s", stdout, stderr)
 	}
 }
 
@@ -848,6 +1178,65 @@ func TestCLI_JSONOutput(t *testing.T) {
 	}
 }
 
+func TestCLI_GlobMarkerIconAndLabel(t *testing.T) {
+	tmpDir := t.TempDir()
+	env := setupTestEnv(t)
+
+	configContent := `search_paths: []
+markers:
+  - marker: "*.csproj"
+    icon: "C#"
+    color: magenta
+    label: dotnet
+    display_label: .NET
+max_depth: 3
+`
+	configPath := filepath.Join(env.configDir, "pj", "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	createTestProject(t, tmpDir, "dotnet-app", "MyApp.csproj")
+
+	stdout, stderr, err := env.runPJ("-p", tmpDir, "--no-cache", "--json", "--icons")
+	if err != nil {
+		t.Fatalf("pj --json failed: %v\nStderr: %s", err, stderr)
+	}
+
+	var result struct {
+		Projects []struct {
+			Marker             string `json:"marker"`
+			MatchedFile        string `json:"matchedFile"`
+			MarkerLabel        string `json:"markerLabel"`
+			MarkerDisplayLabel string `json:"markerDisplayLabel"`
+			Icon               string `json:"icon"`
+			Color              string `json:"color"`
+		} `json:"projects"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("Failed to parse JSON output: %v\nOutput: %s", err, stdout)
+	}
+	if len(result.Projects) != 1 {
+		t.Fatalf("Expected 1 project, got %d", len(result.Projects))
+	}
+
+	p := result.Projects[0]
+	if p.Marker != "*.csproj" || p.MatchedFile != "MyApp.csproj" {
+		t.Errorf("marker = %q, matchedFile = %q; want '*.csproj' and 'MyApp.csproj'", p.Marker, p.MatchedFile)
+	}
+	if p.Icon != "C#" || p.Color != "magenta" || p.MarkerLabel != "dotnet" || p.MarkerDisplayLabel != ".NET" {
+		t.Errorf("glob marker should resolve icon/color/labels by pattern, got %+v", p)
+	}
+
+	stdout, stderr, err = env.runPJ("-p", tmpDir, "--no-cache", "--format", "%l %M")
+	if err != nil {
+		t.Fatalf("pj --format failed: %v\nStderr: %s", err, stderr)
+	}
+	if strings.TrimSpace(stdout) != "dotnet MyApp.csproj" {
+		t.Errorf("--format '%%l %%M' = %q, want 'dotnet MyApp.csproj'", strings.TrimSpace(stdout))
+	}
+}
+
 func TestCLI_JSONOutputWithIcons(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -1360,6 +1749,12 @@ func TestFormatOutput(t *testing.T) {
 			values:   map[string]string{"%i": "X", "%l": "go", "%L": "Go", "%n": "myproj", "%m": "go.mod", "%c": "cyan", "%p": "~/dev/myproj", "%P": "/home/user/dev/myproj"},
 			expected: "X [go] Go myproj go.mod cyan ~/dev/myproj /home/user/dev/myproj",
 		},
+		{
+			name:     "marker and matched file",
+			format:   "%m %M",
+			values:   map[string]string{"%m": "*.csproj", "%M": "MyApp.csproj"},
+			expected: "*.csproj MyApp.csproj",
+		},
 		{
 			name:     "P before p ordering",
 			format:   "%P %p",
@@ -1703,13 +2098,33 @@ func TestSortProjects(t *testing.T) {
 			direction: "desc",
 			expected:  []string{"/m/project", "/z/project", "/a/project"},
 		},
+		{
+			name:      "frecency default",
+			sortBy:    "frecency",
+			direction: "",
+			expected:  []string{"/m/project", "/a/project", "/z/project"},
+		},
+		{
+			name:      "frecency asc",
+			sortBy:    "frecency",
+			direction: "asc",
+			expected:  []string{"/z/project", "/a/project", "/m/project"},
+		},
+		{
+			name:      "history default",
+			sortBy:    "history",
+			direction: "",
+			expected:  []string{"/m/project", "/a/project", "/z/project"},
+		},
 	}
 
+	scores := map[string]float64{"/m/project": 8, "/a/project": 2}
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := make([]discover.Project, len(projects))
 			copy(p, projects)
-			sortProjects(p, tt.sortBy, tt.direction, mapper)
+			sortProjects(p, tt.sortBy, tt.direction, mapper, scores)
 			for i, proj := range p {
 				if proj.Path != tt.expected[i] {
 					t.Errorf("position %d: got %q, want %q", i, proj.Path, tt.expected[i])
@@ -1719,6 +2134,135 @@ func TestSortProjects(t *testing.T) {
 	}
 }
 
+func TestCLI_Frecency(t *testing.T) {
+	tmpDir := t.TempDir()
+	env := setupTestEnv(t)
+
+	often := createTestProject(t, tmpDir, "often", ".git/")
+	once := createTestProject(t, tmpDir, "once", ".git/")
+	createTestProject(t, tmpDir, "never", ".git/")
+	if err := os.MkdirAll(filepath.Join(often, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Visits to a subdirectory count towards its project
+	for _, dir := range []string{once, often, filepath.Join(often, "src"), often} {
+		if _, stderr, err := env.runPJ("visit", dir); err != nil {
+			t.Fatalf("visit %s failed: %v\nStderr: %s", dir, err, stderr)
+		}
+	}
+
+	stdout, stderr, err := env.runPJ("-p", tmpDir, "--sort", "frecency")
+	if err != nil {
+		t.Fatalf("pj --sort frecency failed: %v\nStderr: %s", err, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	want := []string{often, once, filepath.Join(tmpDir, "never")}
+	if len(lines) != len(want) {
+		t.Fatalf("output = %q, want %d projects", stdout, len(want))
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("position %d: got %q, want %q", i, lines[i], want[i])
+		}
+	}
+
+	stdout, _, err = env.runPJ("visits")
+	if err != nil {
+		t.Fatalf("visits failed: %v", err)
+	}
+	if got := strings.Count(stdout, "\n"); got != 3 {
+		t.Errorf("visits listed %d entries, want 3\n%s", got, stdout)
+	}
+	if !strings.HasSuffix(strings.SplitN(stdout, "\n", 2)[0], often) {
+		t.Errorf("visits should list %s first\n%s", often, stdout)
+	}
+
+	if _, stderr, err := env.runPJ("forget", once); err != nil {
+		t.Fatalf("forget failed: %v\nStderr: %s", err, stderr)
+	}
+	if _, _, err := env.runPJ("forget", once); err == nil {
+		t.Error("forgetting a path twice should fail")
+	}
+	stdout, _, _ = env.runPJ("visits")
+	if strings.Contains(stdout, once) {
+		t.Errorf("forgotten path still listed\n%s", stdout)
+	}
+}
+
+func TestCLI_ConcurrentVisits(t *testing.T) {
+	tmpDir := t.TempDir()
+	env := setupTestEnv(t)
+
+	// Shell hooks in several terminals record visits at the same time; none of them
+	// may save over another's
+	const visits = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, visits)
+	for i := 0; i < visits; i++ {
+		dir := filepath.Join(tmpDir, fmt.Sprintf("dir%d", i))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, stderr, err := env.runPJ("visit", dir); err != nil {
+				errs <- fmt.Errorf("visit %s failed: %v\nStderr: %s", dir, err, stderr)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	store, err := frecency.Load(filepath.Join(env.dataDir, "pj", "visits.json"))
+	if err != nil {
+		t.Fatalf("loading visits: %v", err)
+	}
+	if len(store.Entries) != visits {
+		t.Errorf("visit history has %d entries, want %d", len(store.Entries), visits)
+	}
+}
+
+func TestCLI_ImportHistory(t *testing.T) {
+	tmpDir := t.TempDir()
+	env := setupTestEnv(t)
+
+	app := createTestProject(t, tmpDir, "app", ".git/")
+	lib := createTestProject(t, tmpDir, "lib", ".git/")
+	createTestProject(t, tmpDir, "unused", ".git/")
+
+	database := filepath.Join(t.TempDir(), "autojump.txt")
+	content := "5\t" + filepath.Join(app, "src") + "\n20\t" + lib + "\n8\t" + app + "\n3\t/not/a/project\n"
+	if err := os.WriteFile(database, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := env.runPJ("import-history", "--from", "autojump", "--db", database, "-p", tmpDir)
+	if err != nil {
+		t.Fatalf("import-history failed: %v\nStderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Imported 3 of 4 autojump entries into 2 projects") {
+		t.Errorf("import-history output = %q", stdout)
+	}
+
+	stdout, stderr, err = env.runPJ("-p", tmpDir, "--sort", "history")
+	if err != nil {
+		t.Fatalf("pj --sort history failed: %v\nStderr: %s", err, stderr)
+	}
+	want := []string{lib, app, filepath.Join(tmpDir, "unused")}
+	if got := strings.Split(strings.TrimSpace(stdout), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("--sort history = %v, want %v", got, want)
+	}
+
+	if _, _, err := env.runPJ("import-history", "--from", "autojump", "--db", filepath.Join(tmpDir, "missing"), "-p", tmpDir); err == nil {
+		t.Error("import-history from a missing database should fail")
+	}
+}
+
 func TestCLI_SortAlpha(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -1835,3 +2379,435 @@ func TestCLI_SortDirectionInvalidValue(t *testing.T) {
 		t.Error("Invalid sort-direction value should produce an error")
 	}
 }
+
+func TestBuildTree(t *testing.T) {
+	projects := []discover.Project{
+		{Path: "/dev/mono"},
+		{Path: "/dev/mono/packages/api", ParentProject: "/dev/mono", Depth: 1},
+		{Path: "/dev/mono/packages/api/plugin", ParentProject: "/dev/mono/packages/api", Depth: 2},
+		{Path: "/dev/mono/packages/web", ParentProject: "/dev/mono", Depth: 1},
+		{Path: "/dev/orphan", ParentProject: "/dev/filtered-out", Depth: 1},
+	}
+
+	ordered, prefixes := buildTree(projects)
+
+	var lines []string
+	for i, p := range ordered {
+		lines = append(lines, prefixes[i]+p.Path)
+	}
+	expected := []string{
+		"/dev/mono",
+		"├── /dev/mono/packages/api",
+		"│   └── /dev/mono/packages/api/plugin",
+		"└── /dev/mono/packages/web",
+		"/dev/orphan",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("buildTree() =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestCLI_Tree(t *testing.T) {
+	tmpDir := t.TempDir()
+	env := setupTestEnv(t)
+
+	monoDir := createTestProject(t, tmpDir, "mono", ".git/")
+	createTestProject(t, filepath.Join(monoDir, "packages"), "api", "go.mod")
+	createTestProject(t, filepath.Join(monoDir, "packages"), "web", "package.json")
+
+	stdout, stderr, err := env.runPJ("-p", tmpDir, "--no-cache", "--tree", "--sort", "alpha")
+	if err != nil {
+		t.Fatalf("pj --tree failed: %v\nStderr: %s", err, stderr)
+	}
+
+	expected := monoDir + "\n" +
+		"├── " + filepath.Join("packages", "api") + "\n" +
+		"└── " + filepath.Join("packages", "web") + "\n"
+	if stdout != expected {
+		t.Errorf("--tree output =\n%s\nwant\n%s", stdout, expected)
+	}
+
+	stdout, stderr, err = env.runPJ("-p", tmpDir, "--json")
+	if err != nil {
+		t.Fatalf("pj --json failed: %v\nStderr: %s", err, stderr)
+	}
+
+	var result struct {
+		Projects []struct {
+			Path          string `json:"path"`
+			ParentProject string `json:"parentProject"`
+			Depth         int    `json:"depth"`
+		} `json:"projects"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("Failed to parse JSON output: %v\nOutput: %s", err, stdout)
+	}
+	for _, p := range result.Projects {
+		if p.Path == monoDir {
+			if p.ParentProject != "" || p.Depth != 0 {
+				t.Errorf("mono should be a root project, got parent %q depth %d", p.ParentProject, p.Depth)
+			}
+		} else if p.ParentProject != monoDir || p.Depth != 1 {
+			t.Errorf("%s: parent = %q, depth = %d; want %q, 1", p.Path, p.ParentProject, p.Depth, monoDir)
+		}
+	}
+}
+
+func TestCLI_PinUnpin(t *testing.T) {
+	tmpDir := t.TempDir()
+	outsideDir := t.TempDir()
+	env := setupTestEnv(t)
+
+	createTestProject(t, tmpDir, "app", "go.mod")
+	dotfiles := createTestProject(t, outsideDir, "dotfiles")
+
+	_, stderr, err := env.runPJ("pin", dotfiles, "--name", "dots", "--as", ".git", "--tag", "config")
+	if err != nil {
+		t.Fatalf("pj pin failed: %v\nStderr: %s", err, stderr)
+	}
+
+	stdout, stderr, err := env.runPJ("-p", tmpDir, "--pinned-first", "--format", "%n %m")
+	if err != nil {
+		t.Fatalf("pj failed: %v\nStderr: %s", err, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 2 || lines[0] != "dots .git" || lines[1] != "app go.mod" {
+		t.Errorf("--pinned-first output = %q, want pinned project first", lines)
+	}
+
+	stdout, stderr, err = env.runPJ("-p", tmpDir, "--json")
+	if err != nil {
+		t.Fatalf("pj --json failed: %v\nStderr: %s", err, stderr)
+	}
+	var result struct {
+		Projects []struct {
+			Path     string   `json:"path"`
+			IsPinned bool     `json:"isPinned"`
+			Tags     []string `json:"tags"`
+		} `json:"projects"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("Failed to parse JSON output: %v\nOutput: %s", err, stdout)
+	}
+	pinned := 0
+	for _, p := range result.Projects {
+		if p.IsPinned {
+			pinned++
+			if p.Path != dotfiles || len(p.Tags) != 1 || p.Tags[0] != "config" {
+				t.Errorf("pinned project = %+v, want %s with tag config", p, dotfiles)
+			}
+		}
+	}
+	if pinned != 1 {
+		t.Errorf("Expected 1 pinned project in JSON, got %d", pinned)
+	}
+
+	_, stderr, err = env.runPJ("unpin", dotfiles)
+	if err != nil {
+		t.Fatalf("pj unpin failed: %v\nStderr: %s", err, stderr)
+	}
+
+	stdout, _, err = env.runPJ("-p", tmpDir)
+	if err != nil {
+		t.Fatalf("pj failed: %v", err)
+	}
+	if strings.Contains(stdout, "dotfiles") {
+		t.Errorf("Unpinned project should not appear in results\nStdout: %s", stdout)
+	}
+
+	_, stderr, err = env.runPJ("unpin", dotfiles)
+	if err == nil || !strings.Contains(stderr, "is not pinned") {
+		t.Errorf("Unpinning twice should fail with 'is not pinned', got err=%v stderr=%s", err, stderr)
+	}
+}
+
+func TestCLI_RemoteFieldsAndFilters(t *testing.T) {
+	tmpDir := t.TempDir()
+	env := setupTestEnv(t)
+
+	writeRemote := func(dir, url string) {
+		t.Helper()
+		content := "[remote \"origin\"]\n\turl = " + url + "\n"
+		if err := os.WriteFile(filepath.Join(dir, ".git", "config"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mine := createTestProject(t, tmpDir, "mine", ".git/")
+	writeRemote(mine, "git@github.com:me/app.git")
+	fork := createTestProject(t, tmpDir, "fork", ".git/")
+	writeRemote(fork, "https://gitlab.com/someone/app.git")
+
+	stdout, stderr, err := env.runPJ("-p", tmpDir, "--no-cache", "--sort", "alpha", "--format", "%n %h %o %r")
+	if err != nil {
+		t.Fatalf("pj --format failed: %v\nStderr: %s", err, stderr)
+	}
+	expected := "fork gitlab.com someone app\nmine github.com me app\n"
+	if stdout != expected {
+		t.Errorf("--format output = %q, want %q", stdout, expected)
+	}
+
+	stdout, stderr, err = env.runPJ("-p", tmpDir, "--owner", "ME", "--format", "%n")
+	if err != nil {
+		t.Fatalf("pj --owner failed: %v\nStderr: %s", err, stderr)
+	}
+	if strings.TrimSpace(stdout) != "mine" {
+		t.Errorf("--owner me output = %q, want mine", stdout)
+	}
+
+	stdout, stderr, err = env.runPJ("-p", tmpDir, "--host", "gitlab.com", "--json")
+	if err != nil {
+		t.Fatalf("pj --host failed: %v\nStderr: %s", err, stderr)
+	}
+	var result struct {
+		Projects []struct {
+			Name      string `json:"name"`
+			RemoteURL string `json:"remoteUrl"`
+			Host      string `json:"host"`
+			Owner     string `json:"owner"`
+			Repo      string `json:"repo"`
+		} `json:"projects"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("Failed to parse JSON output: %v\nOutput: %s", err, stdout)
+	}
+	if len(result.Projects) != 1 || result.Projects[0].Name != "fork" || result.Projects[0].RemoteURL != "https://gitlab.com/someone/app.git" {
+		t.Errorf("--host gitlab.com JSON = %+v, want only fork with its remote URL", result.Projects)
+	}
+}
+
+func TestCLI_VCSFieldAndFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	env := setupTestEnv(t)
+
+	createTestProject(t, tmpDir, "colocated", ".jj/", ".git/", "package.json")
+	createTestProject(t, tmpDir, "legacy", ".hg/", "go.mod")
+	createTestProject(t, tmpDir, "old", ".svn/")
+
+	stdout, stderr, err := env.runPJ("-p", tmpDir, "--no-cache", "--sort", "alpha", "--format", "%n %v %l")
+	if err != nil {
+		t.Fatalf("pj --format failed: %v\nStderr: %s", err, stderr)
+	}
+	expected := "colocated jj nodejs\nlegacy hg go\nold svn svn\n"
+	if stdout != expected {
+		t.Errorf("--format output = %q, want %q", stdout, expected)
+	}
+
+	stdout, stderr, err = env.runPJ("-p", tmpDir, "--vcs", "hg", "--json")
+	if err != nil {
+		t.Fatalf("pj --vcs failed: %v\nStderr: %s", err, stderr)
+	}
+	var result struct {
+		Projects []struct {
+			Name   string `json:"name"`
+			Marker string `json:"marker"`
+			VCS    string `json:"vcs"`
+		} `json:"projects"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("Failed to parse JSON output: %v\nOutput: %s", err, stdout)
+	}
+	if len(result.Projects) != 1 || result.Projects[0].Name != "legacy" || result.Projects[0].Marker != "go.mod" || result.Projects[0].VCS != "hg" {
+		t.Errorf("--vcs hg JSON = %+v, want only legacy (go.mod, hg)", result.Projects)
+	}
+}
+
+func TestCLI_Duplicates(t *testing.T) {
+	tmpDir := t.TempDir()
+	env := setupTestEnv(t)
+
+	for _, dir := range []string{"a/pj", "b/pj-copy"} {
+		repo := createTestProject(t, tmpDir, dir, ".git/")
+		config := "[remote \"origin\"]\n\turl = git@github.com:josephschmitt/pj.git\n"
+		if dir == "b/pj-copy" {
+			config = "[remote \"origin\"]\n\turl = https://github.com/josephschmitt/pj\n"
+		}
+		if err := os.WriteFile(filepath.Join(repo, ".git", "config"), []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createTestProject(t, tmpDir, "unique", ".git/")
+
+	stdout, stderr, err := env.runPJ("duplicates", "-p", tmpDir, "--no-cache")
+	if err != nil {
+		t.Fatalf("pj duplicates failed: %v\nStderr: %s", err, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 3 || lines[0] != "github.com/josephschmitt/pj" {
+		t.Fatalf("pj duplicates output = %q, want a header and two clones", stdout)
+	}
+	if !strings.HasSuffix(lines[1], filepath.Join(tmpDir, "a", "pj")) || !strings.HasSuffix(lines[2], filepath.Join(tmpDir, "b", "pj-copy")) {
+		t.Errorf("pj duplicates clone lines = %q", lines[1:])
+	}
+
+	stdout, stderr, err = env.runPJ("duplicates", "-p", tmpDir, "--json")
+	if err != nil {
+		t.Fatalf("pj duplicates --json failed: %v\nStderr: %s", err, stderr)
+	}
+	var result struct {
+		Duplicates []struct {
+			Repository string `json:"repository"`
+			Clones     []struct {
+				Path         string    `json:"path"`
+				LastModified time.Time `json:"lastModified"`
+			} `json:"clones"`
+		} `json:"duplicates"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("Failed to parse JSON output: %v\nOutput: %s", err, stdout)
+	}
+	if len(result.Duplicates) != 1 || len(result.Duplicates[0].Clones) != 2 {
+		t.Fatalf("duplicates JSON = %+v, want one group with two clones", result.Duplicates)
+	}
+	if result.Duplicates[0].Clones[0].LastModified.IsZero() {
+		t.Error("clones should include lastModified")
+	}
+}
+
+func TestCLI_Profiles(t *testing.T) {
+	personalDir := t.TempDir()
+	workDir := t.TempDir()
+	env := setupTestEnv(t)
+
+	personal := createTestProject(t, personalDir, "blog", ".git/")
+	work := createTestProject(t, workDir, "api", ".git/")
+	createTestProject(t, workDir, "node_modules", ".git/")
+
+	configContent := fmt.Sprintf(`search_paths: [%q]
+markers: [.git]
+max_depth: 3
+profiles:
+  work:
+    search_paths: [%q]
+    excludes: [node_modules]
+`, personalDir, workDir)
+	configPath := filepath.Join(env.configDir, "pj", "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Run each twice so the second run comes from each profile's own cache
+	for i := 0; i < 2; i++ {
+		stdout, stderr, err := env.runPJ()
+		if err != nil {
+			t.Fatalf("pj failed: %v\nStderr: %s", err, stderr)
+		}
+		if strings.TrimSpace(stdout) != personal {
+			t.Errorf("base config output = %q, want %s", stdout, personal)
+		}
+
+		stdout, stderr, err = env.runPJ("--profile", "work")
+		if err != nil {
+			t.Fatalf("pj --profile work failed: %v\nStderr: %s", err, stderr)
+		}
+		if strings.TrimSpace(stdout) != work {
+			t.Errorf("--profile work output = %q, want %s", stdout, work)
+		}
+	}
+
+	cacheFiles, _ := filepath.Glob(filepath.Join(env.cacheDir, "pj", "cache-*.json"))
+	if len(cacheFiles) != 2 {
+		t.Errorf("cache files = %v, want one per profile", cacheFiles)
+	}
+
+	t.Setenv("PJ_PROFILE", "work")
+	stdout, stderr, err := env.runPJ()
+	if err != nil {
+		t.Fatalf("PJ_PROFILE=work pj failed: %v\nStderr: %s", err, stderr)
+	}
+	if strings.TrimSpace(stdout) != work {
+		t.Errorf("PJ_PROFILE=work output = %q, want %s", stdout, work)
+	}
+
+	_, stderr, err = env.runPJ("--profile", "home")
+	if err == nil || !strings.Contains(stderr, `unknown profile "home" (defined: work)`) {
+		t.Errorf("unknown profile: err = %v, stderr = %q", err, stderr)
+	}
+}
+
+func TestCLI_LocalConfig(t *testing.T) {
+	searchDir := t.TempDir()
+	env := setupTestEnv(t)
+
+	api := createTestProject(t, searchDir, "api", "go.mod")
+	localConfig := "name: API\ncolor: red\ndescription: The API\n"
+	if err := os.WriteFile(filepath.Join(api, ".pj.yaml"), []byte(localConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	secret := createTestProject(t, searchDir, "secret", "go.mod")
+	if err := os.WriteFile(filepath.Join(secret, ".pj.yaml"), []byte("hidden: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Run twice so the second run reads the overrides back from the cache
+	for i := 0; i < 2; i++ {
+		stdout, stderr, err := env.runPJ("-p", searchDir, "--format", "%n|%c|%d")
+		if err != nil {
+			t.Fatalf("pj failed: %v\nStderr: %s", err, stderr)
+		}
+		if got := strings.TrimSpace(stdout); got != "API|red|The API" {
+			t.Errorf("run %d output = %q, want only api with its .pj.yaml overrides", i+1, got)
+		}
+	}
+
+	stdout, stderr, err := env.runPJ("-p", searchDir, "--json", "--icons")
+	if err != nil {
+		t.Fatalf("pj --json failed: %v\nStderr: %s", err, stderr)
+	}
+	var result struct {
+		Projects []struct {
+			Name        string `json:"name"`
+			Color       string `json:"color"`
+			Description string `json:"description"`
+		} `json:"projects"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	if len(result.Projects) != 1 || result.Projects[0].Description != "The API" || result.Projects[0].Color != "red" {
+		t.Errorf("--json projects = %+v, want api with its description and color", result.Projects)
+	}
+}
+
+func TestCLI_SearchPathExpansionChangesCache(t *testing.T) {
+	base := t.TempDir()
+	env := setupTestEnv(t)
+
+	one := createTestProject(t, filepath.Join(base, "one"), "app", ".git/")
+	two := createTestProject(t, filepath.Join(base, "two"), "app", ".git/")
+	createTestProject(t, filepath.Join(base, "clients", "acme", "code"), "site", ".git/")
+
+	configContent := fmt.Sprintf(`search_paths: ["$PJ_TEST_WORK", %q]
+markers: [.git]
+max_depth: 3
+`, filepath.Join(base, "clients", "*", "code"))
+	configPath := filepath.Join(env.configDir, "pj", "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func() string {
+		t.Helper()
+		stdout, stderr, err := env.runPJ()
+		if err != nil {
+			t.Fatalf("pj failed: %v\nStderr: %s", err, stderr)
+		}
+		return stdout
+	}
+
+	t.Setenv("PJ_TEST_WORK", filepath.Join(base, "one"))
+	if out := run(); !strings.Contains(out, one) {
+		t.Fatalf("output = %q, want %s", out, one)
+	}
+
+	// The cache was written for the other value of the variable
+	t.Setenv("PJ_TEST_WORK", filepath.Join(base, "two"))
+	if out := run(); !strings.Contains(out, two) || strings.Contains(out, one) {
+		t.Errorf("output after changing PJ_TEST_WORK = %q, want %s and not %s", out, two, one)
+	}
+
+	// A new directory matching the glob shows up before the cache expires
+	globex := createTestProject(t, filepath.Join(base, "clients", "globex", "code"), "portal", ".git/")
+	if out := run(); !strings.Contains(out, globex) {
+		t.Errorf("output after adding a client = %q, want %s", out, globex)
+	}
+}